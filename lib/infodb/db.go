@@ -1,6 +1,12 @@
 package infodb
 
 import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
 	log "github.com/Sirupsen/logrus"
 	"trie/lib/storage/driver"
 	_ "trie/lib/storage/driver/filesystem"
@@ -9,11 +15,26 @@ import (
 
 type InfoDb struct {
 	Driver driver.StorageDriver
-	MemDb  *trie.Trie
+	MemDb  *trie.RefTrie
 	Trash  []string
 	DbFile string
+	// Codec writes DbFile, nil for trie.GobCodec. Save records its name
+	// in the meta file next to DbFile, so Load picks it up again.
+	Codec trie.Codec
 }
 
+const (
+	// metaSuffix names the file next to DbFile that records how DbFile
+	// was saved, a "field value" line per field. DbFile itself is nothing
+	// but the output of its codec, so other tools can read it.
+	metaSuffix = ".meta"
+	// metaCodec is the field naming the codec of DbFile.
+	metaCodec = "codec"
+	// tmpSuffix names the files Save writes before they replace DbFile and
+	// its meta file.
+	tmpSuffix = ".tmp"
+)
+
 func (db *InfoDb) Add(prefix string) error {
 	return db.MemDb.Insert(prefix)
 }
@@ -32,33 +53,214 @@ func (db *InfoDb) Delete(prefix string) error {
 	return err
 }
 
+// AddBatch adds prefixes as Add does, taking the trie lock once.
+func (db *InfoDb) AddBatch(prefixes []string) ([]trie.BatchResult, error) {
+	return db.MemDb.InsertBatch(prefixes)
+}
+
+// DeleteBatch deletes prefixes as Delete does, taking the trie lock once.
+// The prefixes dropped go to the trash in the order given.
+func (db *InfoDb) DeleteBatch(prefixes []string) ([]trie.BatchResult, error) {
+	results, err := db.MemDb.DeleteBatch(prefixes)
+	for _, r := range results {
+		if r.Deleted {
+			db.Trash = append(db.Trash, r.Key)
+		}
+	}
+	if err != nil {
+		log.Errorf("Failed to delete batch, err: %v", err)
+	}
+	return results, err
+}
+
+func (db *InfoDb) AddBytes(digest []byte) error {
+	return db.MemDb.InsertBytes(digest)
+}
+
+// DeleteBytes releases a binary digest; it goes to the trash in hex form.
+func (db *InfoDb) DeleteBytes(digest []byte) error {
+	prefix, err := db.MemDb.Alphabet().EncodeBytes(digest)
+	if err != nil {
+		return err
+	}
+	return db.Delete(prefix)
+}
+
+// AddRef references prefix for holder, see trie.WithHolders. Adding the
+// same holder again changes nothing.
+func (db *InfoDb) AddRef(prefix, holder string) (bool, error) {
+	return db.MemDb.AddRef(prefix, holder)
+}
+
+// Release drops the reference of holder to prefix, which goes to the
+// trash when it was the last.
+func (db *InfoDb) Release(prefix, holder string) error {
+	deleted, err := db.MemDb.Release(prefix, holder)
+	if err != nil {
+		log.Errorf("Failed to release %s held by %s, err: %v", prefix, holder, err)
+		return err
+	}
+	if deleted {
+		db.Trash = append(db.Trash, prefix)
+	}
+	return nil
+}
+
+func (db *InfoDb) Holders(prefix string) ([]string, error) {
+	return db.MemDb.Holders(prefix)
+}
+
+func (db *InfoDb) HeldBy(holder string) ([]string, error) {
+	return db.MemDb.HeldBy(holder)
+}
+
+// SetMeta records the size and media type of the blob behind a prefix.
+func (db *InfoDb) SetMeta(prefix string, size int64, mediaType string) error {
+	return db.MemDb.SetMeta(prefix, size, mediaType)
+}
+
+// Select runs selector over the prefixes, see trie.MetaSelector for
+// picking them by size and age.
+func (db *InfoDb) Select(selector trie.Selector[struct{}]) error {
+	return db.MemDb.Select(selector)
+}
+
+func (db *InfoDb) Resolve(abbrev string) (string, error) {
+	return db.MemDb.Resolve(abbrev)
+}
+
+func (db *InfoDb) Len() int {
+	return db.MemDb.Len()
+}
+
+func (db *InfoDb) CountPrefix(prefix string) (int, error) {
+	return db.MemDb.CountPrefix(prefix)
+}
+
+// EnableHash makes the db keep a root hash, see trie.Trie.EnableHash.
+func (db *InfoDb) EnableHash() error {
+	return db.MemDb.EnableHash()
+}
+
+func (db *InfoDb) RootHash() []byte {
+	return db.MemDb.RootHash()
+}
+
+func (db *InfoDb) Diff(other *InfoDb, fn trie.DiffFunc[struct{}]) error {
+	return db.MemDb.Diff(other.MemDb, fn)
+}
+
+func (db *InfoDb) Match(pattern string, fn trie.MatchFunc[struct{}]) error {
+	return db.MemDb.Match(pattern, fn)
+}
+
+func (db *InfoDb) Merge(other *InfoDb, policy trie.MergePolicy) error {
+	return db.MemDb.Merge(other.MemDb, policy)
+}
+
+// Observe lets observer follow the refs of the prefixes, for instance to
+// queue orphans for collection instead of polling GetTrash.
+func (db *InfoDb) Observe(observer trie.Observer) {
+	db.MemDb.Observe(observer)
+}
+
 func (db *InfoDb) GetTrash() []string {
 	return db.Trash
 }
 
+// Save writes the snapshot and the meta file naming its codec to temp
+// files, which then replace DbFile and the meta file. A crash leaves the
+// last save whole, unless it comes between the two renames of a save
+// changing the codec.
 func (db *InfoDb) Save() error {
-	writer, err := db.Driver.Writer(db.DbFile, true)
-	if err != nil {
-		log.Errorf("Cannot get writer for %s, err: %v", db.DbFile, err)
-		return err
+	if db.Driver == nil {
+		return trie.ErrClosed
+	}
+	codec := db.Codec
+	if codec == nil {
+		codec = trie.GobCodec
+	}
+	err := db.writeTemp(db.DbFile, func(writer io.Writer) error {
+		return db.MemDb.SaveCodec(writer, codec)
+	})
+	if err == nil {
+		err = db.writeTemp(db.DbFile+metaSuffix, func(writer io.Writer) error {
+			_, err := fmt.Fprintf(writer, "%s %s\n", metaCodec, codec.Name())
+			return err
+		})
 	}
-	defer writer.Close()
-	if err = db.MemDb.Save(writer); err != nil {
+	if err != nil {
 		log.Errorf("Failed to save %s, err: %v", db.DbFile, err)
 		return err
 	}
-	log.Debugf("Succeed to save %s", db.DbFile)
+	for _, file := range []string{db.DbFile, db.DbFile + metaSuffix} {
+		if err = db.Driver.Rename(file+tmpSuffix, file); err != nil {
+			log.Errorf("Failed to replace %s, err: %v", file, err)
+			return err
+		}
+	}
+	log.Debugf("Succeed to save %s with codec %s", db.DbFile, codec.Name())
 	return nil
 }
 
+// writeTemp writes the temp file of file, which is removed again when
+// write fails.
+func (db *InfoDb) writeTemp(file string, write func(io.Writer) error) error {
+	tmp := file + tmpSuffix
+	writer, err := db.Driver.Writer(tmp, false)
+	if err != nil {
+		log.Errorf("Cannot get writer for %s, err: %v", tmp, err)
+		return err
+	}
+	if err = write(writer); err != nil {
+		writer.Cancel()
+		return err
+	}
+	return writer.Close()
+}
+
+// readCodec returns the codec named in the meta file of DbFile, or
+// trie.GobCodec for dbs saved before codecs were recorded.
+func (db *InfoDb) readCodec() (trie.Codec, error) {
+	file := db.DbFile + metaSuffix
+	reader, err := db.Driver.Reader(file, int64(0))
+	if errors.Is(err, trie.ErrNotFound) {
+		return trie.GobCodec, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		field, value, _ := strings.Cut(strings.TrimSpace(scanner.Text()), " ")
+		if field == metaCodec {
+			return trie.CodecByName(strings.TrimSpace(value))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("%w, no codec in %s", trie.ErrCorrupt, file)
+}
+
 func (db *InfoDb) Load() error {
+	if db.Driver == nil {
+		return trie.ErrClosed
+	}
+	codec, err := db.readCodec()
+	if err != nil {
+		log.Errorf("Failed to load codec of %s, err: %v", db.DbFile, err)
+		return err
+	}
 	reader, err := db.Driver.Reader(db.DbFile, int64(0))
 	if err != nil {
 		log.Errorf("Cannot get reader for %s, err: %v", db.DbFile, err)
 		return err
 	}
 	defer reader.Close()
-	if err = db.MemDb.Load(reader); err != nil {
+	db.Codec = codec
+	if err = db.MemDb.LoadCodec(reader, codec); err != nil {
 		log.Errorf("Failed to load %s, err: %v", db.DbFile, err)
 		return err
 	}
@@ -66,14 +268,16 @@ func (db *InfoDb) Load() error {
 	return nil
 }
 
+// FreeInfoDb frees the keys of db, which answers ErrClosed from then on.
 func FreeInfoDb(db *InfoDb) {
 	db.MemDb.Cleanup()
-	db.MemDb = nil
 	db.Driver = nil
 	db.Trash = nil
 }
 
-func CreateInfoDb(root, file string) (*InfoDb, error) {
+// CreateInfoDb creates a db on the filesystem below root. The options pick
+// the backend of the in-memory trie.
+func CreateInfoDb(root, file string, options ...trie.Option) (*InfoDb, error) {
 	opts := make(map[string]interface{})
 	opts["root"] = root
 	driver, err := driver.Create("filesystem", opts)
@@ -84,7 +288,7 @@ func CreateInfoDb(root, file string) (*InfoDb, error) {
 
 	db := &InfoDb{
 		Driver: driver,
-		MemDb:  trie.CreateTrie(),
+		MemDb:  trie.CreateTrie(options...),
 		DbFile: file,
 	}
 
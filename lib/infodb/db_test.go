@@ -1,11 +1,17 @@
 package infodb
 
 import (
+	"compress/gzip"
+	"errors"
+	"io"
 	"io/ioutil"
 	"os"
+	"path"
+	"strings"
 	"testing"
 
 	"gopkg.in/check.v1"
+	"trie/lib/trie"
 	"trie/lib/util"
 )
 
@@ -99,6 +105,21 @@ func (dbs *InfoDbSuites) TestSaveLoadOne(c *check.C) {
 	c.Assert(dbs.db.GetTrash()[0] == prefix, check.Equals, true)
 }
 
+func (dbs *InfoDbSuites) TestSaveTwice(c *check.C) {
+	c.Assert(dbs.db.Add("3FA9"), check.IsNil)
+	c.Assert(dbs.db.Save(), check.IsNil)
+	c.Assert(dbs.db.Add("3FA9"), check.IsNil)
+	c.Assert(dbs.db.Add("3FA9"), check.IsNil)
+	c.Assert(dbs.db.Save(), check.IsNil)
+
+	loaded, err := CreateInfoDb(dbs.root, "db")
+	c.Assert(err, check.IsNil)
+	c.Assert(loaded.Load(), check.IsNil)
+	ref, err := loaded.MemDb.GetRef("3FA9")
+	c.Assert(err, check.IsNil)
+	c.Assert(ref, check.Equals, 3)
+}
+
 func (dbs *InfoDbSuites) TestSaveLoadMany(c *check.C) {
 	prefixes := make([]string, 2048)
 	for i := 0; i < 2048; i++ {
@@ -125,6 +146,175 @@ func (dbs *InfoDbSuites) TestSaveLoadMany(c *check.C) {
 	}
 }
 
+func (dbs *InfoDbSuites) TestBackends(c *check.C) {
+	prefixes := make([]string, 256)
+	for i := range prefixes {
+		prefixes[i] = dbs.rand.String()
+	}
+	db, err := CreateInfoDb(dbs.root, "db", trie.WithBackend(trie.PatriciaBackend))
+	c.Assert(err, check.IsNil)
+	for _, prefix := range prefixes {
+		c.Assert(db.Add(prefix), check.IsNil)
+	}
+	c.Assert(db.Save(), check.IsNil)
+
+	loaded, err := CreateInfoDb(dbs.root, "db", trie.WithBackend(trie.SortedMapBackend))
+	c.Assert(err, check.IsNil)
+	c.Assert(loaded.Load(), check.IsNil)
+	c.Assert(loaded.Len(), check.Equals, len(prefixes))
+	for _, prefix := range prefixes {
+		key, err := loaded.Resolve(prefix[:20])
+		c.Assert(err, check.IsNil)
+		c.Assert(key, check.Equals, prefix)
+		c.Assert(loaded.Delete(prefix), check.IsNil)
+	}
+	c.Assert(loaded.GetTrash(), check.HasLen, len(prefixes))
+}
+
+func (dbs *InfoDbSuites) TestCodec(c *check.C) {
+	db, err := CreateInfoDb(dbs.root, "codecdb")
+	c.Assert(err, check.IsNil)
+	c.Assert(db.Add("3FA9"), check.IsNil)
+	file := path.Join(dbs.root, "codecdb")
+	// dbs saved before the codec was recorded are gob.
+	f, err := os.Create(file)
+	c.Assert(err, check.IsNil)
+	c.Assert(db.MemDb.Save(f), check.IsNil)
+	c.Assert(f.Close(), check.IsNil)
+	loaded, err := CreateInfoDb(dbs.root, "codecdb")
+	c.Assert(err, check.IsNil)
+	c.Assert(loaded.Load(), check.IsNil)
+	c.Assert(loaded.Codec, check.Equals, trie.GobCodec)
+
+	// DbFile holds nothing but the output of the codec.
+	db.Codec = trie.CSVCodec
+	c.Assert(db.Save(), check.IsNil)
+	data, err := os.ReadFile(file)
+	c.Assert(err, check.IsNil)
+	c.Assert(strings.HasPrefix(string(data), "key,ref,"), check.Equals, true)
+	meta, err := os.ReadFile(file + metaSuffix)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(meta), check.Equals, "codec csv\n")
+
+	db.Codec = trie.Gzip(trie.JSONLCodec)
+	c.Assert(db.Save(), check.IsNil)
+	f, err = os.Open(file)
+	c.Assert(err, check.IsNil)
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	c.Assert(err, check.IsNil)
+	data, err = io.ReadAll(zr)
+	c.Assert(err, check.IsNil)
+	c.Assert(strings.HasPrefix(string(data), "{"), check.Equals, true)
+
+	loaded, err = CreateInfoDb(dbs.root, "codecdb")
+	c.Assert(err, check.IsNil)
+	c.Assert(loaded.Load(), check.IsNil)
+	c.Assert(loaded.Codec.Name(), check.Equals, "jsonl+gzip")
+	c.Assert(loaded.Len(), check.Equals, 1)
+
+	c.Assert(os.WriteFile(file+metaSuffix, []byte("size 1\n"), 0644), check.IsNil)
+	err = loaded.Load()
+	c.Assert(errors.Is(err, trie.ErrCorrupt), check.Equals, true)
+}
+
+func (dbs *InfoDbSuites) TestSaveCrash(c *check.C) {
+	db, err := CreateInfoDb(dbs.root, "crashdb")
+	c.Assert(err, check.IsNil)
+	c.Assert(db.Add("3FA9"), check.IsNil)
+	db.Codec = trie.JSONLCodec
+	c.Assert(db.Save(), check.IsNil)
+
+	// a save cut short leaves its temp files, the last save stays whole.
+	file := path.Join(dbs.root, "crashdb")
+	c.Assert(os.WriteFile(file+tmpSuffix, []byte("key,r"), 0644), check.IsNil)
+	c.Assert(os.WriteFile(file+metaSuffix+tmpSuffix, []byte("codec csv\n"), 0644), check.IsNil)
+	loaded, err := CreateInfoDb(dbs.root, "crashdb")
+	c.Assert(err, check.IsNil)
+	c.Assert(loaded.Load(), check.IsNil)
+	c.Assert(loaded.Codec, check.Equals, trie.JSONLCodec)
+	c.Assert(loaded.Len(), check.Equals, 1)
+
+	c.Assert(loaded.Add("00"), check.IsNil)
+	c.Assert(loaded.Save(), check.IsNil)
+	for _, tmp := range []string{file + tmpSuffix, file + metaSuffix + tmpSuffix} {
+		_, err = os.Stat(tmp)
+		c.Assert(os.IsNotExist(err), check.Equals, true)
+	}
+	c.Assert(loaded.Load(), check.IsNil)
+	c.Assert(loaded.Len(), check.Equals, 2)
+}
+
+func (dbs *InfoDbSuites) TestErrors(c *check.C) {
+	db, err := CreateInfoDb(dbs.root, "strictdb", trie.WithStrict())
+	c.Assert(err, check.IsNil)
+	err = db.Load()
+	c.Assert(errors.Is(err, trie.ErrNotFound), check.Equals, true)
+	c.Assert(db.Add("3FA9"), check.IsNil)
+	c.Assert(db.Delete("3FA9"), check.IsNil)
+	err = db.Delete("3FA9")
+	c.Assert(errors.Is(err, trie.ErrNotFound), check.Equals, true)
+	c.Assert(db.GetTrash(), check.DeepEquals, []string{"3FA9"})
+	err = db.Add("XY")
+	c.Assert(errors.Is(err, trie.ErrInvalidKey), check.Equals, true)
+
+	FreeInfoDb(db)
+	c.Assert(errors.Is(db.Add("3FA9"), trie.ErrClosed), check.Equals, true)
+	c.Assert(errors.Is(db.Save(), trie.ErrClosed), check.Equals, true)
+}
+
+func (dbs *InfoDbSuites) TestObserve(c *check.C) {
+	var orphans []string
+	dbs.db.Observe(trie.ObserverFuncs{Orphaned: func(key string) {
+		orphans = append(orphans, key)
+	}})
+	c.Assert(dbs.db.Add("3FA9"), check.IsNil)
+	c.Assert(dbs.db.Add("3FA9"), check.IsNil)
+	c.Assert(dbs.db.Add("00"), check.IsNil)
+	c.Assert(dbs.db.Delete("3FA9"), check.IsNil)
+	c.Assert(orphans, check.HasLen, 0)
+	_, err := dbs.db.DeleteBatch([]string{"3FA9", "00"})
+	c.Assert(err, check.IsNil)
+	c.Assert(orphans, check.DeepEquals, []string{"3FA9", "00"})
+	c.Assert(dbs.db.GetTrash(), check.DeepEquals, []string{"3FA9", "00"})
+}
+
+func (dbs *InfoDbSuites) TestHolders(c *check.C) {
+	db, err := CreateInfoDb(dbs.root, "holderdb", trie.WithHolders())
+	c.Assert(err, check.IsNil)
+	_, err = db.AddRef("3FA9", "build-1")
+	c.Assert(err, check.IsNil)
+	_, err = db.AddRef("3FA9", "build-2")
+	c.Assert(err, check.IsNil)
+	c.Assert(db.Save(), check.IsNil)
+
+	loaded, err := CreateInfoDb(dbs.root, "holderdb", trie.WithHolders())
+	c.Assert(err, check.IsNil)
+	c.Assert(loaded.Load(), check.IsNil)
+	holders, err := loaded.Holders("3FA9")
+	c.Assert(err, check.IsNil)
+	c.Assert(holders, check.DeepEquals, []string{"build-1", "build-2"})
+	c.Assert(loaded.Release("3FA9", "build-1"), check.IsNil)
+	c.Assert(loaded.Release("3FA9", "build-1"), check.IsNil)
+	c.Assert(loaded.GetTrash(), check.HasLen, 0)
+	c.Assert(loaded.Release("3FA9", "build-2"), check.IsNil)
+	c.Assert(loaded.GetTrash(), check.DeepEquals, []string{"3FA9"})
+	held, err := loaded.HeldBy("build-2")
+	c.Assert(err, check.IsNil)
+	c.Assert(held, check.HasLen, 0)
+}
+
+func (dbs *InfoDbSuites) TestBatch(c *check.C) {
+	prefixes := []string{dbs.rand.String(), dbs.rand.String()}
+	results, err := dbs.db.AddBatch([]string{prefixes[0], prefixes[1], prefixes[0]})
+	c.Assert(err, check.IsNil)
+	c.Assert(results[2].Ref, check.Equals, 2)
+	results, err = dbs.db.DeleteBatch([]string{prefixes[0], prefixes[1], prefixes[0]})
+	c.Assert(err, check.IsNil)
+	c.Assert(results[2].Deleted, check.Equals, true)
+	c.Assert(dbs.db.GetTrash(), check.DeepEquals, []string{prefixes[1], prefixes[0]})
+}
+
 func (dbs *InfoDbSuites) addDeleteMem(c *check.C, db *InfoDb, num int) {
 	prefixes := make(map[string]int)
 
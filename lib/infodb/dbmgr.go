@@ -1,11 +1,17 @@
 package infodb
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"path"
-	"runtime"
+	"sort"
+	"strings"
+	"sync"
 
 	log "github.com/Sirupsen/logrus"
+	"trie/lib/suffix"
+	"trie/lib/trie"
 )
 
 type InfoDbMgr struct {
@@ -30,6 +36,364 @@ func (dbm *InfoDbMgr) Delete(prefix string) error {
 	return db.Delete(prefix)
 }
 
+// AddBatch adds prefixes shard by shard, every shard in parallel and
+// under its lock once. The results follow the order of prefixes; those
+// without a shard fail alone.
+func (dbm *InfoDbMgr) AddBatch(prefixes []string) ([]trie.BatchResult, error) {
+	return dbm.batch(prefixes, (*InfoDb).AddBatch)
+}
+
+// DeleteBatch deletes prefixes shard by shard like AddBatch.
+func (dbm *InfoDbMgr) DeleteBatch(prefixes []string) ([]trie.BatchResult, error) {
+	return dbm.batch(prefixes, (*InfoDb).DeleteBatch)
+}
+
+func (dbm *InfoDbMgr) batch(prefixes []string, op func(*InfoDb, []string) ([]trie.BatchResult, error)) ([]trie.BatchResult, error) {
+	results := make([]trie.BatchResult, len(prefixes))
+	groups := make(map[*InfoDb][]int)
+	for i, prefix := range prefixes {
+		results[i].Key = prefix
+		db, err := dbm.getDb(prefix)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		groups[db] = append(groups[db], i)
+	}
+
+	var wg sync.WaitGroup
+	for db, idxs := range groups {
+		wg.Add(1)
+		go func(db *InfoDb, idxs []int) {
+			defer wg.Done()
+			keys := make([]string, len(idxs))
+			for j, i := range idxs {
+				keys[j] = prefixes[i]
+			}
+			shardResults, _ := op(db, keys)
+			for j, i := range idxs {
+				results[i] = shardResults[j]
+			}
+		}(db, idxs)
+	}
+	wg.Wait()
+	return results, trie.BatchErr(results)
+}
+
+func (dbm *InfoDbMgr) AddBytes(digest []byte) error {
+	db, err := dbm.getDbBytes(digest)
+	if err != nil {
+		return err
+	}
+	return db.AddBytes(digest)
+}
+
+func (dbm *InfoDbMgr) DeleteBytes(digest []byte) error {
+	db, err := dbm.getDbBytes(digest)
+	if err != nil {
+		return err
+	}
+	return db.DeleteBytes(digest)
+}
+
+// SetMeta records the size and media type of a prefix in its shard.
+func (dbm *InfoDbMgr) SetMeta(prefix string, size int64, mediaType string) error {
+	db, err := dbm.getDb(prefix)
+	if err != nil {
+		return err
+	}
+	return db.SetMeta(prefix, size, mediaType)
+}
+
+func (dbm *InfoDbMgr) AddRef(prefix, holder string) (bool, error) {
+	db, err := dbm.getDb(prefix)
+	if err != nil {
+		return false, err
+	}
+	return db.AddRef(prefix, holder)
+}
+
+func (dbm *InfoDbMgr) Release(prefix, holder string) error {
+	db, err := dbm.getDb(prefix)
+	if err != nil {
+		return err
+	}
+	return db.Release(prefix, holder)
+}
+
+func (dbm *InfoDbMgr) Holders(prefix string) ([]string, error) {
+	db, err := dbm.getDb(prefix)
+	if err != nil {
+		return nil, err
+	}
+	return db.Holders(prefix)
+}
+
+// HeldBy returns the prefixes holder references in all shards in key
+// order.
+func (dbm *InfoDbMgr) HeldBy(holder string) ([]string, error) {
+	var prefixes []string
+	for _, id := range dbm.getDbIds("") {
+		held, err := dbm.Dbs[id].HeldBy(holder)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, held...)
+	}
+	return prefixes, nil
+}
+
+// Select runs selector over the shards in key order. StopWalk ends the
+// selection in all of them.
+func (dbm *InfoDbMgr) Select(selector trie.Selector[struct{}]) error {
+	ss := &shardSelector{Selector: selector}
+	for _, id := range dbm.getDbIds("") {
+		if err := dbm.Dbs[id].Select(ss); err != nil || ss.stopped {
+			return err
+		}
+	}
+	return nil
+}
+
+// shardSelector notes when the selector it wraps stopped a shard.
+type shardSelector struct {
+	trie.Selector[struct{}]
+	stopped bool
+}
+
+func (ss *shardSelector) Get(prefix string, node *trie.RefNodeInfo) error {
+	err := ss.Selector.Get(prefix, node)
+	ss.stopped = err == trie.StopWalk
+	return err
+}
+
+// Resolve expands an abbreviated digest. Abbreviations shorter than the
+// shard id are resolved against every shard they can fall into.
+func (dbm *InfoDbMgr) Resolve(abbrev string) (string, error) {
+	if len(abbrev) >= 2 {
+		db, err := dbm.getDb(abbrev)
+		if err != nil {
+			return "", err
+		}
+		return db.Resolve(abbrev)
+	}
+
+	var candidates []string
+	for _, id := range dbm.getDbIds(abbrev) {
+		key, err := dbm.Dbs[id].Resolve(abbrev)
+		var aerr *trie.AmbiguousError
+		switch {
+		case err == nil:
+			candidates = append(candidates, key)
+		case errors.As(err, &aerr):
+			candidates = append(candidates, aerr.Candidates...)
+		case errors.Is(err, trie.ErrNotFound):
+		default:
+			return "", err
+		}
+		if len(candidates) >= trie.MaxCandidates {
+			candidates = candidates[:trie.MaxCandidates]
+			break
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		return "", fmt.Errorf("%w %s", trie.ErrNotFound, abbrev)
+	case 1:
+		return candidates[0], nil
+	}
+	return "", &trie.AmbiguousError{Abbrev: abbrev, Candidates: candidates}
+}
+
+// Len returns the number of digests over all shards.
+func (dbm *InfoDbMgr) Len() int {
+	total := 0
+	for _, db := range dbm.Dbs {
+		total += db.Len()
+	}
+	return total
+}
+
+// CountPrefix returns the number of digests starting with prefix over all
+// shards. A prefix outside the alphabet is an ErrInvalidKey, also one too
+// short to pick a shard.
+func (dbm *InfoDbMgr) CountPrefix(prefix string) (int, error) {
+	prefix, err := suffix.HexAlphabet.Canonical(prefix)
+	if err != nil {
+		return 0, err
+	}
+	if len(prefix) >= 2 {
+		db, err := dbm.getDb(prefix)
+		if err != nil {
+			return 0, err
+		}
+		return db.CountPrefix(prefix)
+	}
+	total := 0
+	for _, id := range dbm.getDbIds(prefix) {
+		total += dbm.Dbs[id].Len()
+	}
+	return total, nil
+}
+
+// Rank returns the number of digests sorting before prefix over all
+// shards. Prefixes shorter than the shard id only count whole shards.
+func (dbm *InfoDbMgr) Rank(prefix string) (int, error) {
+	prefix, err := suffix.HexAlphabet.Canonical(prefix)
+	if err != nil {
+		return 0, err
+	}
+	rank := 0
+	id := prefix
+	if len(prefix) >= 2 {
+		db, err := dbm.getDb(prefix)
+		if err != nil {
+			return 0, err
+		}
+		if rank, err = db.MemDb.Rank(prefix); err != nil {
+			return 0, err
+		}
+		id = dbm.getPrefix(prefix, 2)
+	}
+	for _, other := range dbm.getDbIds("") {
+		if other >= id {
+			break
+		}
+		rank += dbm.Dbs[other].Len()
+	}
+	return rank, nil
+}
+
+// Nth returns the digest at offset k over all shards in key order, and its
+// ref.
+func (dbm *InfoDbMgr) Nth(k int) (string, int, error) {
+	if k >= 0 {
+		for _, id := range dbm.getDbIds("") {
+			db := dbm.Dbs[id]
+			if n := db.Len(); k >= n {
+				k -= n
+				continue
+			}
+			return db.MemDb.Nth(k)
+		}
+	}
+	return "", -1, fmt.Errorf("%w offset %d", trie.ErrNotFound, k)
+}
+
+// Sample returns up to num distinct digests picked uniformly at random over
+// all shards, each shard drawing in proportion to its size.
+func (dbm *InfoDbMgr) Sample(num int) []string {
+	ids := dbm.getDbIds("")
+	lens := make([]int, len(ids))
+	total := 0
+	for i, id := range ids {
+		lens[i] = dbm.Dbs[id].Len()
+		total += lens[i]
+	}
+
+	// draw distinct offsets in order, then count how many fall into each
+	// shard.
+	perShard := make([]int, len(ids))
+	i, start := 0, 0
+	for _, k := range suffix.PickRanks(total, num, nil) {
+		for k >= start+lens[i] {
+			start += lens[i]
+			i++
+		}
+		perShard[i]++
+	}
+
+	var sample []string
+	for i, id := range ids {
+		if perShard[i] > 0 {
+			sample = append(sample, dbm.Dbs[id].MemDb.Sample(perShard[i])...)
+		}
+	}
+	return sample
+}
+
+// Match calls fn for the digests matching a glob such as "AB??3*" in
+// digest order. Only the shards whose id the pattern can start with are
+// searched.
+func (dbm *InfoDbMgr) Match(pattern string, fn trie.MatchFunc[struct{}]) error {
+	p, err := trie.CompilePattern(pattern)
+	if err != nil {
+		return err
+	}
+	stopped := false
+	match := func(key string, node *trie.RefNodeInfo) error {
+		err := fn(key, node)
+		stopped = err == trie.StopWalk
+		return err
+	}
+	for _, id := range dbm.getDbIds("") {
+		if !p.MatchPrefix(id) {
+			continue
+		}
+		if err := dbm.Dbs[id].Match(pattern, match); err != nil || stopped {
+			return err
+		}
+	}
+	return nil
+}
+
+// EnableHash makes every shard keep a root hash, so two managers can be
+// compared shard by shard without dumping them.
+func (dbm *InfoDbMgr) EnableHash() error {
+	for id, db := range dbm.Dbs {
+		if err := db.EnableHash(); err != nil {
+			return fmt.Errorf("Failed to enable hash of db %s, err: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// RootHashes returns the root hash of every shard by shard id.
+func (dbm *InfoDbMgr) RootHashes() map[string][]byte {
+	hashes := make(map[string][]byte, len(dbm.Dbs))
+	for id, db := range dbm.Dbs {
+		hashes[id] = db.RootHash()
+	}
+	return hashes
+}
+
+// Diff calls fn for every digest whose ref differs between dbm and other,
+// in digest order. Shards with equal root hashes are skipped.
+func (dbm *InfoDbMgr) Diff(other *InfoDbMgr, fn trie.DiffFunc[struct{}]) error {
+	for _, id := range dbm.getDbIds("") {
+		db, odb := dbm.Dbs[id], other.Dbs[id]
+		if odb == nil {
+			return fmt.Errorf("Cannot find db %s to diff with", id)
+		}
+		if hash := db.RootHash(); hash != nil && bytes.Equal(hash, odb.RootHash()) {
+			continue
+		}
+		if err := db.Diff(odb, fn); err != nil {
+			return fmt.Errorf("Failed to diff db %s, err: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// Merge adds the digests of other shard by shard, combining the refs of
+// digests both hold by policy. Empty shards of other are skipped.
+func (dbm *InfoDbMgr) Merge(other *InfoDbMgr, policy trie.MergePolicy) error {
+	for _, id := range other.getDbIds("") {
+		db, odb := dbm.Dbs[id], other.Dbs[id]
+		if db == nil {
+			return fmt.Errorf("Cannot find db %s to merge into", id)
+		}
+		if odb.Len() == 0 {
+			continue
+		}
+		if err := db.Merge(odb, policy); err != nil {
+			return fmt.Errorf("Failed to merge db %s, err: %w", id, err)
+		}
+	}
+	return nil
+}
+
 func (dbm *InfoDbMgr) GetTrash() []string {
 	var trash []string
 	for _, db := range dbm.Dbs {
@@ -39,11 +403,26 @@ func (dbm *InfoDbMgr) GetTrash() []string {
 	return trash
 }
 
+// Observe adds observer to every shard. Shards deliver their changes
+// independently, in order within a shard.
+func (dbm *InfoDbMgr) Observe(observer trie.Observer) {
+	for _, db := range dbm.Dbs {
+		db.Observe(observer)
+	}
+}
+
+// SetCodec picks the codec every shard is saved with.
+func (dbm *InfoDbMgr) SetCodec(codec trie.Codec) {
+	for _, db := range dbm.Dbs {
+		db.Codec = codec
+	}
+}
+
 func (dbm *InfoDbMgr) Save() error {
 	for id, db := range dbm.Dbs {
 		if err := db.Save(); err != nil {
 			log.Errorf("Failed to save db %s, err: %v", id, err)
-			return fmt.Errorf("Failed to save db %s, err: %v", id, err)
+			return fmt.Errorf("Failed to save db %s, err: %w", id, err)
 		}
 	}
 
@@ -56,7 +435,7 @@ func (dbm *InfoDbMgr) Load() error {
 	for id, db := range dbm.Dbs {
 		if err := db.Load(); err != nil {
 			log.Errorf("Failed to load db %s, err: %v", id, err)
-			return fmt.Errorf("Failed to load db %s, err: %v", id, err)
+			return fmt.Errorf("Failed to load db %s, err: %w", id, err)
 		}
 	}
 	log.Debugf("Succeed to load all dbs")
@@ -64,12 +443,32 @@ func (dbm *InfoDbMgr) Load() error {
 }
 
 func (dbm *InfoDbMgr) getDb(prefix string) (*InfoDb, error) {
-	id := dbm.getPrefix(prefix, 2)
+	id := strings.ToUpper(dbm.getPrefix(prefix, 2))
 	if db, ok := dbm.Dbs[id]; ok {
 		return db, nil
 	}
 	log.Errorf("Cannot find db for prefix %s, id %s", prefix, id)
-	return nil, fmt.Errorf("Cannot find db for %s, id %s", prefix, id)
+	return nil, fmt.Errorf("%w %s, cannot find db for id %s", trie.ErrInvalidKey, prefix, id)
+}
+
+func (dbm *InfoDbMgr) getDbBytes(digest []byte) (*InfoDb, error) {
+	if len(digest) == 0 {
+		return nil, fmt.Errorf("%w, cannot find db for empty digest", trie.ErrInvalidKey)
+	}
+	return dbm.getDb(fmt.Sprintf("%02X", digest[0]))
+}
+
+// getDbIds returns the sorted ids of the shards whose id starts with prefix.
+func (dbm *InfoDbMgr) getDbIds(prefix string) []string {
+	prefix = strings.ToUpper(prefix)
+	var ids []string
+	for id := range dbm.Dbs {
+		if strings.HasPrefix(id, prefix) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
 }
 
 func (dbm *InfoDbMgr) getPrefix(prefix string, bound int) string {
@@ -90,11 +489,11 @@ func FreeInfoDbMgr(mgr *InfoDbMgr) {
 		db = nil
 		delete(mgr.Dbs, k)
 	}
-
-	runtime.GC()
 }
 
-func CreateInfoDbMgr(root, file string) (*InfoDbMgr, error) {
+// CreateInfoDbMgr creates the 256 shards of a manager below root, passing
+// options to every shard.
+func CreateInfoDbMgr(root, file string, options ...trie.Option) (*InfoDbMgr, error) {
 	var err error
 	set := "0123456789ABCDEF"
 	dbm := &InfoDbMgr{
@@ -106,7 +505,7 @@ func CreateInfoDbMgr(root, file string) (*InfoDbMgr, error) {
 		for _, cc := range set {
 			id := fmt.Sprintf("%c%c", c, cc)
 			bucket := path.Join(root, "sha256", id)
-			if dbm.Dbs[id], err = CreateInfoDb(bucket, file); err != nil {
+			if dbm.Dbs[id], err = CreateInfoDb(bucket, file, options...); err != nil {
 				log.Errorf("Failed to CreateInfoDb(%s, %s), err: %v", bucket, file, err)
 				return nil, err
 			}
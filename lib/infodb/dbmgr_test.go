@@ -1,12 +1,18 @@
 package infodb
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"io/ioutil"
 	"os"
+	"sort"
+	"strings"
 	"time"
 	//"testing"
 
 	"gopkg.in/check.v1"
+	"trie/lib/trie"
 	"trie/lib/util"
 )
 
@@ -63,6 +69,175 @@ func (dbms *InfoDbMgrSuites) TestAddDeleteSame(c *check.C) {
 	c.Assert(dbms.dbm.GetTrash()[0] == prefix, check.Equals, true)
 }
 
+func (dbms *InfoDbMgrSuites) TestAddDeleteLowerCase(c *check.C) {
+	prefix := dbms.rand.String()
+	lower := strings.ToLower(prefix)
+	err := dbms.dbm.Add(lower)
+	c.Assert(err, check.IsNil)
+	err = dbms.dbm.Delete(prefix)
+	c.Assert(err, check.IsNil)
+	c.Assert(len(dbms.dbm.GetTrash()), check.Equals, 1)
+
+	err = dbms.dbm.Add("sha256:" + prefix)
+	c.Assert(err, check.NotNil)
+}
+
+func (dbms *InfoDbMgrSuites) TestAddDeleteBytes(c *check.C) {
+	sum := sha256.Sum256([]byte(dbms.rand.String()))
+	err := dbms.dbm.AddBytes(sum[:])
+	c.Assert(err, check.IsNil)
+	err = dbms.dbm.Add(hex.EncodeToString(sum[:]))
+	c.Assert(err, check.IsNil)
+	err = dbms.dbm.DeleteBytes(sum[:])
+	c.Assert(err, check.IsNil)
+	c.Assert(len(dbms.dbm.GetTrash()), check.Equals, 0)
+	err = dbms.dbm.DeleteBytes(sum[:])
+	c.Assert(err, check.IsNil)
+	c.Assert(dbms.dbm.GetTrash(), check.DeepEquals, []string{strings.ToUpper(hex.EncodeToString(sum[:]))})
+
+	err = dbms.dbm.AddBytes(nil)
+	c.Assert(err, check.NotNil)
+}
+
+func (dbms *InfoDbMgrSuites) TestResolve(c *check.C) {
+	keys := []string{"3FA9C1AA", "3FA9C2BB", "3FB0", "4F00"}
+	for _, k := range keys {
+		err := dbms.dbm.Add(k)
+		c.Assert(err, check.IsNil)
+	}
+
+	key, err := dbms.dbm.Resolve("3fa9c1")
+	c.Assert(err, check.IsNil)
+	c.Assert(key, check.Equals, "3FA9C1AA")
+	key, err = dbms.dbm.Resolve("4")
+	c.Assert(err, check.IsNil)
+	c.Assert(key, check.Equals, "4F00")
+
+	_, err = dbms.dbm.Resolve("3")
+	var aerr *trie.AmbiguousError
+	c.Assert(errors.As(err, &aerr), check.Equals, true)
+	c.Assert(aerr.Candidates, check.DeepEquals, []string{"3FA9C1AA", "3FA9C2BB", "3FB0"})
+	_, err = dbms.dbm.Resolve("3FA")
+	c.Assert(errors.Is(err, trie.ErrAmbiguous), check.Equals, true)
+
+	_, err = dbms.dbm.Resolve("5")
+	c.Assert(errors.Is(err, trie.ErrNotFound), check.Equals, true)
+	_, err = dbms.dbm.Resolve("3FA9C3")
+	c.Assert(errors.Is(err, trie.ErrNotFound), check.Equals, true)
+}
+
+func (dbms *InfoDbMgrSuites) TestCounts(c *check.C) {
+	keys := []string{"00AA", "0F11", "3FA9", "3FA9C1", "3FB0", "A000"}
+	for _, k := range keys {
+		err := dbms.dbm.Add(k)
+		c.Assert(err, check.IsNil)
+	}
+	c.Assert(dbms.dbm.Len(), check.Equals, len(keys))
+	count, err := dbms.dbm.CountPrefix("3")
+	c.Assert(err, check.IsNil)
+	c.Assert(count, check.Equals, 3)
+	count, err = dbms.dbm.CountPrefix("3fa")
+	c.Assert(err, check.IsNil)
+	c.Assert(count, check.Equals, 2)
+
+	for i, k := range keys {
+		rank, err := dbms.dbm.Rank(k)
+		c.Assert(err, check.IsNil)
+		c.Assert(rank, check.Equals, i)
+		key, ref, err := dbms.dbm.Nth(i)
+		c.Assert(err, check.IsNil)
+		c.Assert(key, check.Equals, k)
+		c.Assert(ref, check.Equals, 1)
+	}
+	for prefix, want := range map[string]int{"": 0, "0": 0, "3": 2, "4": 5, "a": 5, "F": 6} {
+		rank, err := dbms.dbm.Rank(prefix)
+		c.Assert(err, check.IsNil)
+		c.Assert(rank, check.Equals, want, check.Commentf("prefix %q", prefix))
+	}
+	for _, prefix := range []string{"g", "3g", "3FAg"} {
+		_, err = dbms.dbm.CountPrefix(prefix)
+		c.Assert(errors.Is(err, trie.ErrInvalidKey), check.Equals, true, check.Commentf("prefix %q", prefix))
+		_, err = dbms.dbm.Rank(prefix)
+		c.Assert(errors.Is(err, trie.ErrInvalidKey), check.Equals, true, check.Commentf("prefix %q", prefix))
+	}
+	_, _, err = dbms.dbm.Nth(len(keys))
+	c.Assert(errors.Is(err, trie.ErrNotFound), check.Equals, true)
+
+	sample := dbms.dbm.Sample(100)
+	sort.Strings(sample)
+	c.Assert(sample, check.DeepEquals, keys)
+	c.Assert(dbms.dbm.Sample(2), check.HasLen, 2)
+}
+
+func (dbms *InfoDbMgrSuites) TestHashDiff(c *check.C) {
+	backup, err := CreateInfoDbMgr(dbms.root+"/backup", "db")
+	c.Assert(err, check.IsNil)
+	defer FreeInfoDbMgr(backup)
+	c.Assert(dbms.dbm.EnableHash(), check.IsNil)
+	c.Assert(backup.EnableHash(), check.IsNil)
+
+	keys := []string{"00AA", "0F11", "3FA9", "3FA9C1", "A000"}
+	for _, k := range keys {
+		c.Assert(dbms.dbm.Add(k), check.IsNil)
+		c.Assert(backup.Add(k), check.IsNil)
+	}
+	c.Assert(dbms.dbm.RootHashes(), check.DeepEquals, backup.RootHashes())
+
+	c.Assert(backup.Add("3FA9"), check.IsNil)
+	c.Assert(backup.Delete("A000"), check.IsNil)
+	c.Assert(backup.Add("FF01"), check.IsNil)
+	hashes, bhashes := dbms.dbm.RootHashes(), backup.RootHashes()
+	c.Assert(hashes, check.HasLen, 256)
+	c.Assert(hashes["00"], check.DeepEquals, bhashes["00"])
+	c.Assert(hashes["3F"], check.Not(check.DeepEquals), bhashes["3F"])
+
+	refs := make(map[string][2]int)
+	err = dbms.dbm.Diff(backup, func(key string, a, b *trie.RefNodeInfo) error {
+		var r [2]int
+		if a != nil {
+			r[0] = a.Ref()
+		}
+		if b != nil {
+			r[1] = b.Ref()
+		}
+		refs[key] = r
+		return nil
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(refs, check.DeepEquals, map[string][2]int{
+		"3FA9": {1, 2},
+		"A000": {1, 0},
+		"FF01": {0, 1},
+	})
+}
+
+func (dbms *InfoDbMgrSuites) TestMatch(c *check.C) {
+	keys := []string{"00AA", "0F11", "3FA9", "3FA9C1", "3FB0", "A000", "AF01"}
+	for _, k := range keys {
+		c.Assert(dbms.dbm.Add(k), check.IsNil)
+	}
+	var matched []string
+	collect := func(key string, node *trie.RefNodeInfo) error {
+		matched = append(matched, key)
+		return nil
+	}
+	c.Assert(dbms.dbm.Match("?F*", collect), check.IsNil)
+	c.Assert(matched, check.DeepEquals, []string{"0F11", "3FA9", "3FA9C1", "3FB0", "AF01"})
+
+	matched = nil
+	c.Assert(dbms.dbm.Match("3f[a-b]?", collect), check.IsNil)
+	c.Assert(matched, check.DeepEquals, []string{"3FA9", "3FB0"})
+
+	matched = nil
+	err := dbms.dbm.Match("*", func(key string, node *trie.RefNodeInfo) error {
+		matched = append(matched, key)
+		return trie.StopWalk
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(matched, check.DeepEquals, []string{"00AA"})
+	c.Assert(dbms.dbm.Match("[", collect), check.NotNil)
+}
+
 func (dbms *InfoDbMgrSuites) TestAddDeleteDiff(c *check.C) {
 	prefixes := make([]string, 2048)
 
@@ -248,3 +423,120 @@ func (dbms *InfoDbMgrSuites) getRandStrings(num int, diff bool) map[string]int {
 
 	return strings
 }
+
+func (dbms *InfoDbMgrSuites) TestMerge(c *check.C) {
+	other, err := CreateInfoDbMgr(dbms.root+"/other", "db")
+	c.Assert(err, check.IsNil)
+	defer FreeInfoDbMgr(other)
+
+	for _, k := range []string{"00AA", "3FA9", "3FA9", "A000"} {
+		c.Assert(dbms.dbm.Add(k), check.IsNil)
+	}
+	for _, k := range []string{"0F11", "3FA9", "A000", "A000", "A000"} {
+		c.Assert(other.Add(k), check.IsNil)
+	}
+	c.Assert(dbms.dbm.Merge(other, trie.MergeMax), check.IsNil)
+	c.Assert(dbms.dbm.Len(), check.Equals, 4)
+	for key, ref := range map[string]int{"00AA": 1, "0F11": 1, "3FA9": 2, "A000": 3} {
+		got, err := dbms.dbm.Dbs[key[:2]].MemDb.GetRef(key)
+		c.Assert(err, check.IsNil)
+		c.Assert(got, check.Equals, ref, check.Commentf("key %s", key))
+	}
+
+	c.Assert(dbms.dbm.Merge(other, trie.MergeSum), check.IsNil)
+	got, err := dbms.dbm.Dbs["A0"].MemDb.GetRef("A000")
+	c.Assert(err, check.IsNil)
+	c.Assert(got, check.Equals, 6)
+	c.Assert(other.Len(), check.Equals, 3)
+}
+
+func (dbms *InfoDbMgrSuites) TestBatch(c *check.C) {
+	keys := []string{"00AA", "3FA9", "00AA", "Z1", "3FA9C1", "A000"}
+	results, err := dbms.dbm.AddBatch(keys)
+	var berr *trie.BatchError
+	c.Assert(errors.As(err, &berr), check.Equals, true)
+	c.Assert(berr.Failed, check.Equals, 1)
+	c.Assert(results, check.HasLen, len(keys))
+	for i, r := range results {
+		c.Assert(r.Key, check.Equals, keys[i])
+	}
+	c.Assert(results[2].Ref, check.Equals, 2)
+	c.Assert(results[3].Err, check.NotNil)
+	c.Assert(dbms.dbm.Len(), check.Equals, 4)
+
+	results, err = dbms.dbm.DeleteBatch([]string{"00AA", "3FA9", "A000", "A000"})
+	c.Assert(err, check.IsNil)
+	c.Assert(results[0].Ref, check.Equals, 1)
+	c.Assert(results[1].Deleted, check.Equals, true)
+	c.Assert(results[3].Deleted, check.Equals, false)
+	trash := dbms.dbm.GetTrash()
+	sort.Strings(trash)
+	c.Assert(trash, check.DeepEquals, []string{"3FA9", "A000"})
+	c.Assert(dbms.dbm.Len(), check.Equals, 2)
+}
+
+func (dbms *InfoDbMgrSuites) TestSelectMeta(c *check.C) {
+	for i, k := range []string{"00AA", "3FA9", "A000", "A0FF"} {
+		c.Assert(dbms.dbm.Add(k), check.IsNil)
+		c.Assert(dbms.dbm.SetMeta(k, int64(i), "application/octet-stream"), check.IsNil)
+	}
+	c.Assert(dbms.dbm.SetMeta("B0", 1, ""), check.NotNil)
+	var keys []string
+	err := dbms.dbm.Select(&trie.MetaSelector[struct{}]{
+		MinSize: 1,
+		Visit: func(prefix string, node *trie.RefNodeInfo) error {
+			keys = append(keys, prefix)
+			if node.Size() == 2 {
+				return trie.StopWalk
+			}
+			return nil
+		},
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(keys, check.DeepEquals, []string{"3FA9", "A000"})
+}
+
+func (dbms *InfoDbMgrSuites) TestErrors(c *check.C) {
+	err := dbms.dbm.Add("Z1")
+	c.Assert(errors.Is(err, trie.ErrInvalidKey), check.Equals, true)
+	err = dbms.dbm.AddBytes(nil)
+	c.Assert(errors.Is(err, trie.ErrInvalidKey), check.Equals, true)
+	_, err = dbms.dbm.Resolve("3FA9")
+	c.Assert(errors.Is(err, trie.ErrNotFound), check.Equals, true)
+}
+
+func (dbms *InfoDbMgrSuites) TestHolders(c *check.C) {
+	dbm, err := CreateInfoDbMgr(dbms.root+"/holders", "db", trie.WithHolders())
+	c.Assert(err, check.IsNil)
+	defer FreeInfoDbMgr(dbm)
+	for _, prefix := range []string{"A0B1", "00C2", "3FA9"} {
+		added, err := dbm.AddRef(prefix, "build-1")
+		c.Assert(err, check.IsNil)
+		c.Assert(added, check.Equals, true)
+	}
+	added, err := dbm.AddRef("3FA9", "build-1")
+	c.Assert(err, check.IsNil)
+	c.Assert(added, check.Equals, false)
+	_, err = dbm.AddRef("3FA9", "build-2")
+	c.Assert(err, check.IsNil)
+
+	held, err := dbm.HeldBy("build-1")
+	c.Assert(err, check.IsNil)
+	c.Assert(held, check.DeepEquals, []string{"00C2", "3FA9", "A0B1"})
+	holders, err := dbm.Holders("3FA9")
+	c.Assert(err, check.IsNil)
+	c.Assert(holders, check.DeepEquals, []string{"build-1", "build-2"})
+	_, err = dbm.Holders("Z1")
+	c.Assert(errors.Is(err, trie.ErrInvalidKey), check.Equals, true)
+
+	c.Assert(dbm.Release("3FA9", "build-1"), check.IsNil)
+	c.Assert(dbm.Release("00C2", "build-1"), check.IsNil)
+	c.Assert(dbm.Release("00C2", "build-1"), check.IsNil)
+	c.Assert(dbm.GetTrash(), check.DeepEquals, []string{"00C2"})
+	held, err = dbm.HeldBy("build-1")
+	c.Assert(err, check.IsNil)
+	c.Assert(held, check.DeepEquals, []string{"A0B1"})
+
+	_, err = dbms.dbm.HeldBy("build-1")
+	c.Assert(err, check.Equals, trie.ErrNoHolders)
+}
@@ -21,6 +21,8 @@ type StorageDriver interface {
 	Writer(file string, append bool) (StorageWriter, error)
 	Reader(file string, pos int64) (io.ReadCloser, error)
 	Remove(file string) error
+	// Rename moves from over to, replacing it in one step.
+	Rename(from, to string) error
 	Name() string
 }
 
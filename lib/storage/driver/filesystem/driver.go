@@ -9,6 +9,7 @@ import (
 
 	log "github.com/Sirupsen/logrus"
 	"trie/lib/storage/driver"
+	"trie/lib/util"
 )
 
 const (
@@ -19,6 +20,7 @@ type FileWriter struct {
 	file   *os.File
 	offset int64
 	bw     *bufio.Writer
+	closed bool
 }
 
 type FileSystem struct {
@@ -33,6 +35,9 @@ func (fs *FileSystem) Reader(path string, pos int64) (io.ReadCloser, error) {
 	file, err := os.OpenFile(fs.fullpath(path), os.O_RDONLY, 0644)
 	if err != nil {
 		log.Errorf("Failed to open %s, err: %v", fs.fullpath(path), err)
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w %s: %w", util.ErrNotFound, path, err)
+		}
 		return nil, err
 	}
 	seekPos, err := file.Seek(int64(pos), os.SEEK_SET)
@@ -83,6 +88,14 @@ func (fs *FileSystem) Remove(file string) error {
 	return os.RemoveAll(file)
 }
 
+func (fs *FileSystem) Rename(from, to string) error {
+	if err := os.Rename(fs.fullpath(from), fs.fullpath(to)); err != nil {
+		log.Errorf("Failed to rename %s to %s, err: %v", from, to, err)
+		return err
+	}
+	return nil
+}
+
 func (fs *FileSystem) fullpath(subpath string) string {
 	return path.Join(fs.root, subpath)
 }
@@ -97,6 +110,9 @@ func (fs *FileSystem) newFileWriter(fp *os.File, offset int64) *FileWriter {
 
 // FileWriter member functions
 func (fw *FileWriter) Commit() error {
+	if fw.closed {
+		return util.ErrClosed
+	}
 	if err := fw.bw.Flush(); err != nil {
 		return err
 	}
@@ -107,12 +123,19 @@ func (fw *FileWriter) Commit() error {
 }
 
 func (fw *FileWriter) Write(p []byte) (int, error) {
+	if fw.closed {
+		return 0, util.ErrClosed
+	}
 	n, err := fw.bw.Write(p)
 	fw.offset += int64(n)
 	return n, err
 }
 
 func (fw *FileWriter) Close() error {
+	if fw.closed {
+		return util.ErrClosed
+	}
+	fw.closed = true
 	if err := fw.bw.Flush(); err != nil {
 		return err
 	}
@@ -126,6 +149,10 @@ func (fw *FileWriter) Close() error {
 }
 
 func (fw *FileWriter) Cancel() error {
+	if fw.closed {
+		return util.ErrClosed
+	}
+	fw.closed = true
 	if err := fw.file.Close(); err != nil {
 		return err
 	}
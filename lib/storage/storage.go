@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"io"
 	"path"
+	"strings"
 
 	"trie/lib/storage/driver"
+	"trie/lib/util"
 )
 
 type StorageMgr struct {
@@ -43,7 +45,7 @@ func (s *StorageMgr) GetWriter(prefix string, bound int) (driver.StorageWriter,
 		return writer, err
 	}
 
-	return nil, fmt.Errorf("GetWriter: Cannot find driver for prefix %s with bound %d", prefix, bound)
+	return nil, fmt.Errorf("GetWriter: %w driver for prefix %s with bound %d", util.ErrNotFound, prefix, bound)
 }
 
 func (s *StorageMgr) GetReader(prefix string, bound int) (io.ReadCloser, error) {
@@ -53,7 +55,7 @@ func (s *StorageMgr) GetReader(prefix string, bound int) (io.ReadCloser, error)
 		return reader, err
 	}
 
-	return nil, fmt.Errorf("GetReader: Cannot find driver for prefix %s with bound %d", prefix, bound)
+	return nil, fmt.Errorf("GetReader: %w driver for prefix %s with bound %d", util.ErrNotFound, prefix, bound)
 }
 
 func (s *StorageMgr) getPrefix(prefix string, bound int) string {
@@ -64,7 +66,7 @@ func (s *StorageMgr) getPrefix(prefix string, bound int) string {
 		}
 		id = fmt.Sprintf("%s%c", id, c)
 	}
-	root := path.Join(s.Root, "sha256", id)
+	root := path.Join(s.Root, "sha256", strings.ToLower(id))
 	return root
 }
 
@@ -0,0 +1,184 @@
+package suffix
+
+import (
+	"fmt"
+
+	"trie/lib/util"
+)
+
+// Alphabet describes the characters a Trie accepts in its keys. Every
+// symbol has an index which fixes the order of keys in Walk; with case
+// folding the other case of a letter maps onto the same symbol, and keys
+// are always reported in the case the symbols were declared with.
+type Alphabet struct {
+	name    string
+	symbols string
+	index   [256]int16
+}
+
+var (
+	// HexAlphabet accepts upper and lower case hex digits and reports keys
+	// in upper case.
+	HexAlphabet = mustAlphabet("hex", "0123456789ABCDEF", true)
+	// Base32Alphabet is the RFC 4648 base32 alphabet without padding.
+	Base32Alphabet = mustAlphabet("base32", "ABCDEFGHIJKLMNOPQRSTUVWXYZ234567", true)
+	// ByteAlphabet accepts every byte value.
+	ByteAlphabet = mustAlphabet("byte", byteSymbols(), false)
+)
+
+// InvalidKeyError is returned when a key holds a character outside the
+// alphabet of the trie.
+type InvalidKeyError struct {
+	Key string
+	Pos int
+}
+
+func (e *InvalidKeyError) Error() string {
+	return fmt.Sprintf("Invalid character %q at %d in key %s", e.Key[e.Pos], e.Pos, e.Key)
+}
+
+// Unwrap makes the error match util.ErrInvalidKey.
+func (e *InvalidKeyError) Unwrap() error {
+	return util.ErrInvalidKey
+}
+
+// NewAlphabet builds a custom alphabet. The order of symbols is the order
+// keys are walked in. A symbol may not appear twice, also not in another
+// case when foldCase is set.
+func NewAlphabet(name, symbols string, foldCase bool) (*Alphabet, error) {
+	if len(symbols) == 0 {
+		return nil, fmt.Errorf("Alphabet %s has no symbols", name)
+	}
+	a := &Alphabet{
+		name:    name,
+		symbols: symbols,
+	}
+	for i := range a.index {
+		a.index[i] = -1
+	}
+	for i := 0; i < len(symbols); i++ {
+		b := symbols[i]
+		if err := a.set(b, i); err != nil {
+			return nil, err
+		}
+		if !foldCase {
+			continue
+		}
+		if o, ok := otherCase(b); ok {
+			if err := a.set(o, i); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return a, nil
+}
+
+func (a *Alphabet) Name() string {
+	return a.name
+}
+
+func (a *Alphabet) Size() int {
+	return len(a.symbols)
+}
+
+func (a *Alphabet) Symbols() string {
+	return a.symbols
+}
+
+// Validate reports the first character of key outside the alphabet.
+func (a *Alphabet) Validate(key string) error {
+	_, err := a.canonical(key)
+	return err
+}
+
+// Index returns the position of symbol b in the alphabet, or -1 when b
+// is not a symbol.
+func (a *Alphabet) Index(b byte) int {
+	return int(a.index[b])
+}
+
+// Canonical returns key spelled with the declared symbols, the way a trie
+// stores it.
+func (a *Alphabet) Canonical(key string) (string, error) {
+	return a.canonical(key)
+}
+
+// Compare orders two canonical keys the way a trie walks them.
+func (a *Alphabet) Compare(x, y string) int {
+	return a.compare(x, y)
+}
+
+// canonical rewrites key with the declared symbols. It only allocates when
+// key holds characters in the folded case.
+func (a *Alphabet) canonical(key string) (string, error) {
+	var buf []byte
+	for i := 0; i < len(key); i++ {
+		idx := a.index[key[i]]
+		if idx < 0 {
+			return "", &InvalidKeyError{Key: key, Pos: i}
+		}
+		sym := a.symbols[idx]
+		if sym == key[i] && buf == nil {
+			continue
+		}
+		if buf == nil {
+			buf = []byte(key)
+		}
+		buf[i] = sym
+	}
+	if buf == nil {
+		return key, nil
+	}
+	return string(buf), nil
+}
+
+// compare orders two canonical keys by the index of their symbols.
+func (a *Alphabet) compare(x, y string) int {
+	n := commonPrefix(x, y)
+	switch {
+	case n < len(x) && n < len(y):
+		if a.index[x[n]] < a.index[y[n]] {
+			return -1
+		}
+		return 1
+	case len(x) < len(y):
+		return -1
+	case len(x) > len(y):
+		return 1
+	}
+	return 0
+}
+
+func (a *Alphabet) set(b byte, idx int) error {
+	if a.index[b] >= 0 {
+		return fmt.Errorf("Alphabet %s has duplicated symbol %q", a.name, b)
+	}
+	a.index[b] = int16(idx)
+	return nil
+}
+
+func otherCase(b byte) (byte, bool) {
+	switch {
+	case b >= 'a' && b <= 'z':
+		return b - 'a' + 'A', true
+	case b >= 'A' && b <= 'Z':
+		return b - 'A' + 'a', true
+	}
+	return 0, false
+}
+
+func byteSymbols() string {
+	bs := make([]byte, 256)
+	for i := range bs {
+		bs[i] = byte(i)
+	}
+	return string(bs)
+}
+
+func mustAlphabet(name, symbols string, foldCase bool) *Alphabet {
+	a, err := NewAlphabet(name, symbols, foldCase)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
@@ -0,0 +1,82 @@
+package suffix
+
+import (
+	"errors"
+
+	"gopkg.in/check.v1"
+	"trie/lib/util"
+)
+
+var _ = check.Suite(&AlphabetSuites{})
+
+type AlphabetSuites struct {
+}
+
+func (as *AlphabetSuites) TestHexFoldCase(c *check.C) {
+	trie := NewTrie[interface{}](HexAlphabet)
+	c.Assert(mustPut(c, trie, "abcdef0123", 1), check.Equals, true)
+	c.Assert(mustPut(c, trie, "ABCDEF0123", 2), check.Equals, false)
+	c.Assert(mustGet(c, trie, "AbCdEf0123"), check.Equals, 2)
+
+	var keys []string
+	err := trie.Walk(func(key string, value interface{}) error {
+		keys = append(keys, key)
+		return nil
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(keys, check.DeepEquals, []string{"ABCDEF0123"})
+	c.Assert(mustDelete(c, trie, "abcdef0123"), check.Equals, true)
+}
+
+func (as *AlphabetSuites) TestInvalidKey(c *check.C) {
+	trie := NewTrie[interface{}](HexAlphabet)
+	key := "sha256:ABCD"
+	_, err := trie.Put(key, 1)
+	c.Assert(err, check.FitsTypeOf, &InvalidKeyError{})
+	ierr := err.(*InvalidKeyError)
+	c.Assert(ierr.Key, check.Equals, key)
+	c.Assert(ierr.Pos, check.Equals, 0)
+
+	_, _, err = trie.Get("G")
+	c.Assert(err, check.FitsTypeOf, &InvalidKeyError{})
+	_, err = trie.Delete("0x1")
+	c.Assert(err, check.FitsTypeOf, &InvalidKeyError{})
+	c.Assert(errors.Is(err, util.ErrInvalidKey), check.Equals, true)
+	c.Assert(HexAlphabet.Validate("00ff"), check.IsNil)
+}
+
+func (as *AlphabetSuites) TestByteAndBase32(c *check.C) {
+	trie := NewTrie[interface{}](ByteAlphabet)
+	c.Assert(mustPut(c, trie, "sha256:\x00\xff", 1), check.Equals, true)
+	c.Assert(mustGet(c, trie, "sha256:\x00\xff"), check.Equals, 1)
+	c.Assert(mustGet(c, trie, "SHA256:\x00\xff"), check.IsNil)
+
+	trie = NewTrie[interface{}](Base32Alphabet)
+	c.Assert(mustPut(c, trie, "mfrgg", 1), check.Equals, true)
+	c.Assert(mustGet(c, trie, "MFRGG"), check.Equals, 1)
+	_, err := trie.Put("MFRG1", 1)
+	c.Assert(err, check.FitsTypeOf, &InvalidKeyError{})
+}
+
+func (as *AlphabetSuites) TestCustomAlphabet(c *check.C) {
+	_, err := NewAlphabet("dup", "ABA", false)
+	c.Assert(err, check.NotNil)
+	_, err = NewAlphabet("fold", "Aa", true)
+	c.Assert(err, check.NotNil)
+	_, err = NewAlphabet("empty", "", false)
+	c.Assert(err, check.NotNil)
+
+	dna, err := NewAlphabet("dna", "TGCA", false)
+	c.Assert(err, check.IsNil)
+	c.Assert(dna.Size(), check.Equals, 4)
+	trie := NewTrie[interface{}](dna)
+	for _, k := range []string{"AC", "TT", "GA", "CG"} {
+		c.Assert(mustPut(c, trie, k, k), check.Equals, true)
+	}
+	var keys []string
+	trie.Walk(func(key string, value interface{}) error {
+		keys = append(keys, key)
+		return nil
+	})
+	c.Assert(keys, check.DeepEquals, []string{"TT", "GA", "CG", "AC"})
+}
@@ -0,0 +1,308 @@
+package suffix
+
+import (
+	"crypto/sha256"
+	"math"
+	"math/bits"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// nodeRef addresses a node in the arena of a trie, 0 is no node.
+type nodeRef uint32
+
+const (
+	slabShift = 10
+	slabSize  = 1 << slabShift
+	// labelChunk, listChunk and hashChunk are the lengths of the chunks
+	// the pools of labels, child lists and hashes are cut from.
+	labelChunk = 1 << 16
+	listChunk  = 4096
+	hashChunk  = 1024
+	// poolClasses are the capacities a pool hands out, 1 << class for
+	// every class a uint32 length needs.
+	poolClasses = 33
+)
+
+// arena hands out the nodes of a trie from slabs of slabSize nodes, and
+// their labels, child lists and hashes from pools that address them by
+// offset. A node holds no pointer but those in its value, so a trie of
+// millions of keys is a few thousand allocations, and for values without
+// pointers the garbage collector has nothing in them to scan. Nodes
+// dropped by Delete are reused by later writes along with their runs.
+//
+// Snapshots read the nodes through a copy of the slab list. Slabs never
+// move and are only appended, so the copy stays valid while the trie
+// grows. A node a snapshot may still read is retired instead of freed and
+// reused only once every snapshot that could see it is released.
+type arena[V any] struct {
+	slabs  [][]node[V]
+	next   nodeRef
+	free   []nodeRef
+	labels pool[byte]
+	lists  pool[nodeRef]
+	hashes pool[[sha256.Size]byte]
+
+	retired []retiredNode
+	snaps   *snapshotSet
+}
+
+// run addresses len items of a pool from off in chunk. class is the
+// capacity class plus one, 0 is no run.
+type run struct {
+	chunk uint32
+	off   uint32
+	len   uint32
+	class uint8
+}
+
+func (r run) cap() int {
+	if r.class == 0 {
+		return 0
+	}
+	return 1 << (r.class - 1)
+}
+
+// pool hands out runs of items from chunks of size items, in capacities
+// of a power of two which are reused once given back. A run longer than a
+// chunk gets a chunk of its own. Chunks never move, so the copy of the
+// chunk list a snapshot takes stays valid.
+type pool[T any] struct {
+	chunks [][]T
+	size   int
+	// cur is the chunk runs are cut from, up to used.
+	cur  int
+	used int
+	free [poolClasses][]run
+}
+
+func newPool[T any](size int) pool[T] {
+	return pool[T]{size: size, cur: -1}
+}
+
+// view returns the pool as a snapshot reads it.
+func (p *pool[T]) view() pool[T] {
+	return pool[T]{chunks: p.chunks, size: p.size, cur: -1}
+}
+
+// alloc returns a run of n items, no run if n is 0.
+func (p *pool[T]) alloc(n int) run {
+	if n == 0 {
+		return run{}
+	}
+	class := bits.Len(uint(n - 1))
+	if free := p.free[class]; len(free) > 0 {
+		r := free[len(free)-1]
+		p.free[class] = free[:len(free)-1]
+		r.len = uint32(n)
+		return r
+	}
+	size := 1 << class
+	if size > p.size {
+		p.chunks = append(p.chunks, make([]T, size))
+		return run{chunk: uint32(len(p.chunks) - 1), len: uint32(n), class: uint8(class + 1)}
+	}
+	if p.cur < 0 || p.used+size > p.size {
+		p.chunks = append(p.chunks, make([]T, p.size))
+		p.cur, p.used = len(p.chunks)-1, 0
+	}
+	r := run{chunk: uint32(p.cur), off: uint32(p.used), len: uint32(n), class: uint8(class + 1)}
+	p.used += size
+	return r
+}
+
+// get returns the items of a run, nil for no run.
+func (p *pool[T]) get(r run) []T {
+	if r.class == 0 {
+		return nil
+	}
+	return p.chunks[r.chunk][r.off : int(r.off)+int(r.len) : int(r.off)+r.cap()]
+}
+
+// release gives a run back for reuse, its items are overwritten later.
+func (p *pool[T]) release(r run) {
+	if r.class == 0 {
+		return
+	}
+	p.free[r.class-1] = append(p.free[r.class-1], r)
+}
+
+// retiredNode is a node dropped by the trie at generation gen, which the
+// snapshots of older generations may still read.
+type retiredNode struct {
+	ref nodeRef
+	gen uint64
+}
+
+// snapshotSet counts the snapshots in use by generation. Snapshots are
+// released by Release, or by the garbage collector when one was dropped
+// without it, on any goroutine, so the writer only picks up the change on
+// its next allocation.
+type snapshotSet struct {
+	mutex    sync.Mutex
+	live     map[uint64]int
+	count    atomic.Int64
+	released atomic.Bool
+}
+
+// snapshotToken releases the generation of one snapshot once.
+type snapshotToken struct {
+	set  *snapshotSet
+	gen  uint64
+	done atomic.Bool
+}
+
+func newArena[V any]() *arena[V] {
+	return &arena[V]{
+		// ref 0 stands for no node, so it is never handed out.
+		next:   1,
+		labels: newPool[byte](labelChunk),
+		lists:  newPool[nodeRef](listChunk),
+		hashes: newPool[[sha256.Size]byte](hashChunk),
+		snaps:  &snapshotSet{live: make(map[uint64]int)},
+	}
+}
+
+func (a *arena[V]) node(ref nodeRef) *node[V] {
+	return &a.slabs[ref>>slabShift][ref&(slabSize-1)]
+}
+
+// view returns the arena as a snapshot of generation gen sees it. The
+// generation stays in use until the snapshot is released.
+func (a *arena[V]) view(snap *Trie[V], gen uint64) *arena[V] {
+	token := &snapshotToken{set: a.snaps, gen: gen}
+	a.snaps.add(gen)
+	snap.token = token
+	releaseLost(snap, token)
+	return &arena[V]{
+		slabs:  a.slabs,
+		next:   a.next,
+		labels: a.labels.view(),
+		lists:  a.lists.view(),
+		hashes: a.hashes.view(),
+		snaps:  a.snaps,
+	}
+}
+
+// alloc returns a free node, or ErrTooManyNodes once every nodeRef is
+// taken.
+func (a *arena[V]) alloc() (nodeRef, error) {
+	if a.snaps.released.Load() {
+		a.reclaim()
+	}
+	if n := len(a.free); n > 0 {
+		ref := a.free[n-1]
+		a.free = a.free[:n-1]
+		return ref, nil
+	}
+	if a.next == math.MaxUint32 {
+		return 0, ErrTooManyNodes
+	}
+	if int(a.next>>slabShift) == len(a.slabs) {
+		a.slabs = append(a.slabs, make([]node[V], slabSize))
+	}
+	ref := a.next
+	a.next++
+	return ref, nil
+}
+
+// release clears a node no snapshot can read and keeps it for reuse.
+func (a *arena[V]) release(ref nodeRef) {
+	n := a.node(ref)
+	a.labels.release(n.label)
+	a.lists.release(n.children)
+	a.hashes.release(n.hash)
+	*n = node[V]{}
+	a.free = append(a.free, ref)
+}
+
+// label returns the label of n. It is a view of the pool, valid as long as
+// n keeps its label, so keys handed out are built with extend.
+func (a *arena[V]) label(n *node[V]) string {
+	b := a.labels.get(n.label)
+	if len(b) == 0 {
+		return ""
+	}
+	return unsafe.String(&b[0], len(b))
+}
+
+// setLabel gives the writable node n a copy of label, which may be a view
+// of its old one.
+func (a *arena[V]) setLabel(n *node[V], label string) {
+	old := n.label
+	n.label = a.labels.alloc(len(label))
+	copy(a.labels.get(n.label), label)
+	a.labels.release(old)
+}
+
+// hash returns the hash of n, nil unless it has one.
+func (a *arena[V]) hash(n *node[V]) []byte {
+	if h := a.hashes.get(n.hash); h != nil {
+		return h[0][:]
+	}
+	return nil
+}
+
+// retire drops a node of an older generation than gen, the generation of
+// the trie.
+func (a *arena[V]) retire(ref nodeRef, gen uint64) {
+	if a.snaps.count.Load() == 0 {
+		a.release(ref)
+		return
+	}
+	a.retired = append(a.retired, retiredNode{ref: ref, gen: gen})
+}
+
+// reclaim releases the retired nodes no snapshot in use can read: those
+// retired at a generation no later than the oldest snapshot.
+func (a *arena[V]) reclaim() {
+	a.snaps.released.Store(false)
+	oldest, ok := a.snaps.oldest()
+	kept := a.retired[:0]
+	for _, rn := range a.retired {
+		if ok && rn.gen > oldest {
+			kept = append(kept, rn)
+			continue
+		}
+		a.release(rn.ref)
+	}
+	for i := len(kept); i < len(a.retired); i++ {
+		a.retired[i] = retiredNode{}
+	}
+	a.retired = kept
+}
+
+func (s *snapshotSet) add(gen uint64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.live[gen]++
+	s.count.Add(1)
+}
+
+// oldest returns the oldest generation of a snapshot in use.
+func (s *snapshotSet) oldest() (uint64, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	oldest, ok := uint64(0), false
+	for gen := range s.live {
+		if !ok || gen < oldest {
+			oldest, ok = gen, true
+		}
+	}
+	return oldest, ok
+}
+
+func (token *snapshotToken) release() {
+	if !token.done.CompareAndSwap(false, true) {
+		return
+	}
+	s := token.set
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.live[token.gen]--; s.live[token.gen] <= 0 {
+		delete(s.live, token.gen)
+	}
+	s.count.Add(-1)
+	s.released.Store(true)
+}
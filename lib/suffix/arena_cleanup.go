@@ -0,0 +1,16 @@
+//go:build go1.24
+
+package suffix
+
+import (
+	"runtime"
+)
+
+// releaseLost has the garbage collector release a snapshot dropped without
+// Release, so a forgotten one does not keep its nodes for good. It is a
+// backstop against leaks only: reads still running on a snapshot nobody
+// refers to any more are not protected, which is why Release is required.
+// runtime.AddCleanup needs Go 1.24.
+func releaseLost[V any](snap *Trie[V], token *snapshotToken) {
+	runtime.AddCleanup(snap, (*snapshotToken).release, token)
+}
@@ -0,0 +1,23 @@
+//go:build go1.24
+
+package suffix
+
+import (
+	"runtime"
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+func (as *ArenaSuites) TestReleaseByCollector(c *check.C) {
+	t := NewTrie[int](HexAlphabet)
+	putAll(c, t, arenaKeys(100), 1)
+	t.Snapshot()
+	c.Assert(t.arena.snaps.count.Load(), check.Equals, int64(1))
+	for i := 0; i < 100 && t.arena.snaps.count.Load() > 0; i++ {
+		runtime.GC()
+		time.Sleep(time.Millisecond)
+	}
+	c.Assert(t.arena.snaps.count.Load(), check.Equals, int64(0))
+	c.Assert(t.arena.snaps.released.Load(), check.Equals, true)
+}
@@ -0,0 +1,8 @@
+//go:build !go1.24
+
+package suffix
+
+// releaseLost does nothing before Go 1.24, which brought runtime.AddCleanup:
+// a snapshot dropped without Release keeps its nodes as long as the trie.
+func releaseLost[V any](snap *Trie[V], token *snapshotToken) {
+}
@@ -0,0 +1,181 @@
+package suffix
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"runtime"
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+var _ = check.Suite(&ArenaSuites{})
+
+type ArenaSuites struct {
+}
+
+func putAll(c *check.C, t *Trie[int], keys []string, value int) {
+	for _, k := range keys {
+		_, err := t.Put(k, value)
+		c.Assert(err, check.IsNil)
+	}
+}
+
+func arenaKeys(num int) []string {
+	keys := make([]string, num)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("%06X", i*7919)
+	}
+	return keys
+}
+
+func (as *ArenaSuites) TestReuseAfterDelete(c *check.C) {
+	t := NewTrie[int](HexAlphabet)
+	keys := arenaKeys(2000)
+	putAll(c, t, keys, 1)
+	used := t.arena.next
+	for _, k := range keys {
+		_, err := t.Delete(k)
+		c.Assert(err, check.IsNil)
+	}
+	c.Assert(t.Len(), check.Equals, 0)
+	c.Assert(len(t.arena.free), check.Equals, int(used)-2)
+
+	putAll(c, t, keys, 2)
+	c.Assert(t.arena.next, check.Equals, used)
+	c.Assert(t.Len(), check.Equals, len(keys))
+	v, ok, err := t.Get(keys[10])
+	c.Assert(err, check.IsNil)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(v, check.Equals, 2)
+}
+
+func (as *ArenaSuites) TestRetireUntilRelease(c *check.C) {
+	t := NewTrie[int](HexAlphabet)
+	keys := arenaKeys(2000)
+	putAll(c, t, keys, 1)
+
+	snap := t.Snapshot()
+	putAll(c, t, keys, 2)
+	retired := len(t.arena.retired)
+	c.Assert(retired > 0, check.Equals, true)
+	c.Assert(t.arena.free, check.HasLen, 0)
+	err := snap.Walk(func(key string, v int) error {
+		c.Assert(v, check.Equals, 1)
+		return nil
+	})
+	c.Assert(err, check.IsNil)
+
+	// the nodes the released snapshot read are taken by the next copies.
+	snap.Release()
+	snap.Release()
+	used := t.arena.next
+	snap = t.Snapshot()
+	putAll(c, t, keys, 3)
+	c.Assert(t.arena.next, check.Equals, used)
+	c.Assert(len(t.arena.retired), check.Equals, retired)
+	v, _, _ := snap.Get(keys[0])
+	c.Assert(v, check.Equals, 2)
+	v, _, _ = t.Get(keys[0])
+	c.Assert(v, check.Equals, 3)
+}
+
+func (as *ArenaSuites) TestTooManyNodes(c *check.C) {
+	t := NewTrie[int](HexAlphabet)
+	keys := arenaKeys(100)
+	putAll(c, t, keys, 1)
+	snap := t.Snapshot()
+	defer snap.Release()
+	t.arena.next = math.MaxUint32
+
+	_, err := t.Put("FFFFFFF", 1)
+	c.Assert(errors.Is(err, ErrTooManyNodes), check.Equals, true)
+	_, err = t.Delete(keys[3])
+	c.Assert(errors.Is(err, ErrTooManyNodes), check.Equals, true)
+	c.Assert(t.Len(), check.Equals, len(keys))
+	_, ok, _ := t.Get(keys[3])
+	c.Assert(ok, check.Equals, true)
+
+	empty := NewTrie[int](HexAlphabet)
+	defer empty.Snapshot().Release()
+	empty.arena.next = math.MaxUint32
+	_, err = NewBuilder(empty)
+	c.Assert(errors.Is(err, ErrTooManyNodes), check.Equals, true)
+}
+
+func (as *ArenaSuites) TestPool(c *check.C) {
+	p := newPool[nodeRef](listChunk)
+	c.Assert(p.get(p.alloc(0)), check.IsNil)
+	for n, want := range map[int]int{1: 1, 2: 2, 3: 4, 16: 16, 17: 32, 256: 256, listChunk + 1: 2 * listChunk} {
+		r := p.alloc(n)
+		list := p.get(r)
+		c.Assert(len(list), check.Equals, n)
+		c.Assert(cap(list), check.Equals, want)
+		p.release(r)
+		again := p.get(p.alloc(n))
+		c.Assert(&again[0], check.Equals, &list[0])
+	}
+}
+
+func (as *ArenaSuites) TestLabelsOutliveNodes(c *check.C) {
+	t := NewTrie[int](HexAlphabet)
+	// one key for every symbol, so each is the whole label of a child of
+	// the root.
+	keys := make([]string, 0, 16)
+	for _, sym := range "0123456789ABCDEF" {
+		keys = append(keys, string(sym)+"0F")
+	}
+	putAll(c, t, keys, 1)
+	var walked []string
+	c.Assert(t.Walk(func(key string, v int) error {
+		walked = append(walked, key)
+		return nil
+	}), check.IsNil)
+	// the runs of deleted labels are reused, the keys handed out are not
+	// views of them.
+	for _, k := range keys {
+		_, err := t.Delete(k)
+		c.Assert(err, check.IsNil)
+	}
+	putAll(c, t, []string{"FFF", "EEE", "DDD", "CCC"}, 2)
+	c.Assert(walked, check.DeepEquals, keys)
+}
+
+// BenchmarkCollect builds a trie of a million digests and logs what that
+// allocates and what the trie then costs a collection; run it with
+// -check.b -check.vv to see them.
+func (as *ArenaSuites) BenchmarkCollect(c *check.C) {
+	r := rand.New(rand.NewSource(1))
+	keys := make([]string, 1<<20)
+	digest := make([]byte, 32)
+	for i := range keys {
+		r.Read(digest)
+		keys[i] = hex.EncodeToString(digest)
+	}
+	c.ResetTimer()
+	for i := 0; i < c.N; i++ {
+		var before, built, collected runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		t := NewTrie[int](HexAlphabet)
+		for _, k := range keys {
+			if _, err := t.Put(k, 1); err != nil {
+				c.Fatal(err)
+			}
+		}
+		c.StopTimer()
+		runtime.ReadMemStats(&built)
+		start := time.Now()
+		runtime.GC()
+		collect := time.Since(start)
+		runtime.ReadMemStats(&collected)
+		c.Logf("%d keys: %d allocs, %d live heap objects, collection %v, pauses %v", t.Len(),
+			built.Mallocs-before.Mallocs, collected.HeapObjects-before.HeapObjects, collect,
+			time.Duration(collected.PauseTotalNs-built.PauseTotalNs))
+		runtime.KeepAlive(t)
+		c.StartTimer()
+	}
+}
@@ -0,0 +1,130 @@
+package suffix
+
+// Builder fills a trie from keys given in alphabet order in one pass. It
+// keeps the path to the last key open and attaches every new key where it
+// leaves that path, so no key is looked up from the root. The counts and
+// hashes of a node are worked out once the input has moved past it.
+//
+// A key out of order or a trie that was not empty to begin with turn the
+// builder into a plain loop of Put. The trie must not be used otherwise
+// until Finish.
+type Builder[V any] struct {
+	trie    *Trie[V]
+	stack   []buildFrame[V]
+	last    string
+	started bool
+	sorted  bool
+}
+
+// buildFrame is a node on the path to the last key; end is the length of
+// the key up to the end of its label.
+type buildFrame[V any] struct {
+	n   *node[V]
+	end int
+}
+
+func NewBuilder[V any](t *Trie[V]) (*Builder[V], error) {
+	if t.readonly {
+		return nil, ErrReadOnly
+	}
+	b := &Builder[V]{
+		trie:   t,
+		sorted: t.Len() == 0,
+	}
+	if b.sorted {
+		t.version++
+		root, err := t.writableRoot()
+		if err != nil {
+			return nil, err
+		}
+		b.stack = append(b.stack, buildFrame[V]{n: root})
+	}
+	return b, nil
+}
+
+// Sorted tells whether every key so far came in order.
+func (b *Builder[V]) Sorted() bool {
+	return b.sorted
+}
+
+func (b *Builder[V]) Add(key string, value V) error {
+	if !b.sorted || len(b.stack) == 0 {
+		_, err := b.trie.Put(key, value)
+		return err
+	}
+	t := b.trie
+	key, err := t.alphabet.canonical(key)
+	if err != nil {
+		return err
+	}
+	if b.started && t.alphabet.compare(b.last, key) > 0 {
+		b.Finish()
+		b.sorted = false
+		_, err := t.Put(key, value)
+		return err
+	}
+
+	common := 0
+	if b.started {
+		common = commonPrefix(b.last, key)
+	}
+	b.started = true
+	b.last = key
+	for b.top().end > common {
+		b.pop()
+	}
+	n := b.top().n
+	if end := b.top().end; end < common {
+		// the last key went on inside the label of the last child.
+		last := int(n.children.len) - 1
+		child := t.children(n)[last]
+		mid, err := t.splitChild(n, last, common-end)
+		if err != nil {
+			return err
+		}
+		t.rehash(t.node(child))
+		b.stack = append(b.stack, buildFrame[V]{n: mid, end: common})
+		n = mid
+	}
+	if common == len(key) {
+		n.value = value
+		n.has = true
+		return nil
+	}
+	ref, leaf, err := t.newNode(key[common:])
+	if err != nil {
+		return err
+	}
+	leaf.value = value
+	leaf.has = true
+	t.insertChild(n, int(n.children.len), ref)
+	b.stack = append(b.stack, buildFrame[V]{n: leaf, end: len(key)})
+	return nil
+}
+
+// Finish closes the path to the last key, after which the trie is ready.
+// Keys added afterwards are put one by one.
+func (b *Builder[V]) Finish() {
+	for len(b.stack) > 0 {
+		b.pop()
+	}
+}
+
+func (b *Builder[V]) top() *buildFrame[V] {
+	return &b.stack[len(b.stack)-1]
+}
+
+// pop closes the node on top: all its children are closed already.
+func (b *Builder[V]) pop() {
+	t := b.trie
+	n := b.top().n
+	n.count = 0
+	if n.has {
+		n.count++
+	}
+	for _, child := range t.children(n) {
+		n.count += t.node(child).count
+	}
+	t.rehash(n)
+	b.stack = b.stack[:len(b.stack)-1]
+}
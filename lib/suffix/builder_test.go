@@ -0,0 +1,112 @@
+package suffix
+
+import (
+	"fmt"
+	"sort"
+
+	"gopkg.in/check.v1"
+	"trie/lib/util"
+)
+
+var _ = check.Suite(&BuilderSuites{})
+
+type BuilderSuites struct {
+	keys []string
+}
+
+func (bs *BuilderSuites) SetUpTest(c *check.C) {
+	rand := &util.RandString{
+		Sets: "0123456789ABCDEF",
+		Len:  5,
+	}
+	seen := map[string]bool{"": true, "0": true, "A": true, "AB": true, "ABC": true, "ABCDEF": true}
+	for len(seen) < 3000 {
+		seen[rand.String()] = true
+	}
+	bs.keys = bs.keys[:0]
+	for k := range seen {
+		bs.keys = append(bs.keys, k)
+	}
+	sort.Strings(bs.keys)
+}
+
+func hashString(v interface{}) []byte {
+	return []byte(fmt.Sprint(v))
+}
+
+func (bs *BuilderSuites) build(c *check.C, t *Trie[interface{}], keys []string) *Builder[interface{}] {
+	b, err := NewBuilder(t)
+	c.Assert(err, check.IsNil)
+	for _, k := range keys {
+		c.Assert(b.Add(k, k), check.IsNil)
+	}
+	b.Finish()
+	return b
+}
+
+func (bs *BuilderSuites) TestSorted(c *check.C) {
+	put := NewTrie[interface{}](HexAlphabet)
+	c.Assert(put.EnableHash(hashString), check.IsNil)
+	for _, k := range bs.keys {
+		mustPut(c, put, k, k)
+	}
+
+	built := NewTrie[interface{}](HexAlphabet)
+	c.Assert(built.EnableHash(hashString), check.IsNil)
+	b := bs.build(c, built, bs.keys)
+	c.Assert(b.Sorted(), check.Equals, true)
+	c.Assert(built.Len(), check.Equals, len(bs.keys))
+	checkCounts(c, built, built.node(built.root))
+	c.Assert(built.RootHash(), check.DeepEquals, put.RootHash())
+
+	var keys []string
+	err := built.Walk(func(key string, value interface{}) error {
+		c.Assert(value, check.Equals, key)
+		keys = append(keys, key)
+		return nil
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(keys, check.DeepEquals, bs.keys)
+
+	// the built trie goes on like any other.
+	mustDelete(c, built, "AB")
+	mustDelete(c, put, "AB")
+	c.Assert(built.RootHash(), check.DeepEquals, put.RootHash())
+	c.Assert(b.Add("FFFFFFF", 1), check.IsNil)
+	c.Assert(mustGet(c, built, "FFFFFFF"), check.Equals, 1)
+}
+
+func (bs *BuilderSuites) TestDuplicates(c *check.C) {
+	t := NewTrie[interface{}](HexAlphabet)
+	b, err := NewBuilder(t)
+	c.Assert(err, check.IsNil)
+	for i, k := range []string{"0A", "0A", "0a", "0AB", "0AB"} {
+		c.Assert(b.Add(k, i), check.IsNil)
+	}
+	b.Finish()
+	c.Assert(b.Sorted(), check.Equals, true)
+	c.Assert(t.Len(), check.Equals, 2)
+	c.Assert(mustGet(c, t, "0A"), check.Equals, 2)
+	c.Assert(mustGet(c, t, "0AB"), check.Equals, 4)
+}
+
+func (bs *BuilderSuites) TestFallback(c *check.C) {
+	keys := append([]string(nil), bs.keys...)
+	keys[100], keys[2000] = keys[2000], keys[100]
+	t := NewTrie[interface{}](HexAlphabet)
+	b := bs.build(c, t, keys)
+	c.Assert(b.Sorted(), check.Equals, false)
+	c.Assert(t.Len(), check.Equals, len(keys))
+	checkCounts(c, t, t.node(t.root))
+
+	// a filled trie is added to key by key.
+	b = bs.build(c, t, []string{"0", "FFFFFF"})
+	c.Assert(b.Sorted(), check.Equals, false)
+	c.Assert(t.Len(), check.Equals, len(keys)+1)
+
+	_, err := NewBuilder(t.Snapshot())
+	c.Assert(err, check.Equals, ErrReadOnly)
+	b, err = NewBuilder(NewTrie[interface{}](HexAlphabet))
+	c.Assert(err, check.IsNil)
+	c.Assert(b.Add("XY", 1), check.FitsTypeOf, &InvalidKeyError{})
+}
@@ -0,0 +1,100 @@
+package suffix
+
+import (
+	"crypto/sha256"
+	"errors"
+	"unsafe"
+)
+
+// ErrNotNibbleAlphabet is returned by the byte key APIs of a trie whose
+// alphabet does not have 16 symbols to index nibbles with.
+var ErrNotNibbleAlphabet = errors.New("Alphabet cannot index nibbles")
+
+// EncodeBytes turns a binary key into the key string of its nibbles, high
+// nibble first, each one indexing a symbol of the alphabet.
+func (a *Alphabet) EncodeBytes(key []byte) (string, error) {
+	buf, err := a.appendBytes(make([]byte, 0, 2*len(key)), key)
+	if err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// appendBytes appends the nibbles of key to dst as EncodeBytes spells them.
+func (a *Alphabet) appendBytes(dst []byte, key []byte) ([]byte, error) {
+	if a.Size() != 16 {
+		return nil, ErrNotNibbleAlphabet
+	}
+	for _, b := range key {
+		dst = append(dst, a.symbols[b>>4], a.symbols[b&0x0f])
+	}
+	return dst, nil
+}
+
+// nibbleBuf holds the nibbles of a sha256 digest, so the byte key APIs
+// encode digests on the stack.
+type nibbleBuf [2 * sha256.Size]byte
+
+// bytesKey spells key into buf and returns a string viewing it, which is
+// only valid while buf is. The trie copies the labels it keeps.
+func (a *Alphabet) bytesKey(buf *nibbleBuf, key []byte) (string, error) {
+	b, err := a.appendBytes(buf[:0], key)
+	if err != nil || len(b) == 0 {
+		return "", err
+	}
+	return unsafe.String(&b[0], len(b)), nil
+}
+
+// DecodeBytes turns a key string back into its binary form. It fails for
+// keys of odd length, which do not end on a byte boundary.
+func (a *Alphabet) DecodeBytes(key string) ([]byte, error) {
+	if a.Size() != 16 {
+		return nil, ErrNotNibbleAlphabet
+	}
+	if len(key)%2 != 0 {
+		return nil, &InvalidKeyError{Key: key, Pos: len(key) - 1}
+	}
+	buf := make([]byte, len(key)/2)
+	for i := range buf {
+		hi, lo := a.index[key[2*i]], a.index[key[2*i+1]]
+		if hi < 0 {
+			return nil, &InvalidKeyError{Key: key, Pos: 2 * i}
+		}
+		if lo < 0 {
+			return nil, &InvalidKeyError{Key: key, Pos: 2*i + 1}
+		}
+		buf[i] = byte(hi<<4 | lo)
+	}
+	return buf, nil
+}
+
+// GetBytes looks up a binary key, stored as the nibbles of its bytes, so it
+// finds the same entry as Get with the hex form of the key.
+func (t *Trie[V]) GetBytes(key []byte) (V, bool, error) {
+	var buf nibbleBuf
+	skey, err := t.alphabet.bytesKey(&buf, key)
+	if err != nil {
+		var zero V
+		return zero, false, err
+	}
+	value, ok := t.get(skey)
+	return value, ok, nil
+}
+
+func (t *Trie[V]) PutBytes(key []byte, value V) (bool, error) {
+	var buf nibbleBuf
+	skey, err := t.alphabet.bytesKey(&buf, key)
+	if err != nil {
+		return false, err
+	}
+	return t.put(skey, value)
+}
+
+func (t *Trie[V]) DeleteBytes(key []byte) (bool, error) {
+	var buf nibbleBuf
+	skey, err := t.alphabet.bytesKey(&buf, key)
+	if err != nil {
+		return false, err
+	}
+	return t.delete(skey)
+}
@@ -0,0 +1,82 @@
+package suffix
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"gopkg.in/check.v1"
+)
+
+var _ = check.Suite(&BytesSuites{})
+
+type BytesSuites struct {
+}
+
+func (bs *BytesSuites) TestInterop(c *check.C) {
+	trie := NewTrie[interface{}](HexAlphabet)
+	sum := sha256.Sum256([]byte("layer"))
+	hexKey := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	ret, err := trie.PutBytes(sum[:], 1)
+	c.Assert(err, check.IsNil)
+	c.Assert(ret, check.Equals, true)
+	c.Assert(mustGet(c, trie, hexKey), check.Equals, 1)
+	c.Assert(mustGet(c, trie, strings.ToLower(hexKey)), check.Equals, 1)
+
+	c.Assert(mustPut(c, trie, hexKey, 2), check.Equals, false)
+	val, ok, err := trie.GetBytes(sum[:])
+	c.Assert(err, check.IsNil)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(val, check.Equals, 2)
+
+	_, ok, err = trie.GetBytes(sum[:16])
+	c.Assert(err, check.IsNil)
+	c.Assert(ok, check.Equals, false)
+
+	ret, err = trie.DeleteBytes(sum[:])
+	c.Assert(err, check.IsNil)
+	c.Assert(ret, check.Equals, true)
+	c.Assert(mustGet(c, trie, hexKey), check.IsNil)
+}
+
+func (bs *BytesSuites) TestEncodeDecode(c *check.C) {
+	key, err := HexAlphabet.EncodeBytes([]byte{0x00, 0x3f, 0xa9, 0xff})
+	c.Assert(err, check.IsNil)
+	c.Assert(key, check.Equals, "003FA9FF")
+	b, err := HexAlphabet.DecodeBytes("003fa9FF")
+	c.Assert(err, check.IsNil)
+	c.Assert(b, check.DeepEquals, []byte{0x00, 0x3f, 0xa9, 0xff})
+
+	_, err = HexAlphabet.DecodeBytes("3FA")
+	c.Assert(err, check.FitsTypeOf, &InvalidKeyError{})
+	_, err = HexAlphabet.DecodeBytes("3G")
+	c.Assert(err, check.FitsTypeOf, &InvalidKeyError{})
+
+	trie := NewTrie[interface{}](Base32Alphabet)
+	_, err = trie.PutBytes([]byte{1}, 1)
+	c.Assert(err, check.Equals, ErrNotNibbleAlphabet)
+}
+
+func (bs *BytesSuites) TestNoAllocs(c *check.C) {
+	trie := NewTrie[int](HexAlphabet)
+	sum := sha256.Sum256([]byte("layer"))
+	_, err := trie.PutBytes(sum[:], 1)
+	c.Assert(err, check.IsNil)
+	other := sha256.Sum256([]byte("other"))
+
+	// digests are spelled on the stack, overwriting or missing keys
+	// allocate nothing.
+	allocs := testing.AllocsPerRun(100, func() {
+		trie.GetBytes(sum[:])
+		trie.PutBytes(sum[:], 2)
+		trie.GetBytes(other[:])
+		trie.DeleteBytes(other[:])
+	})
+	c.Assert(allocs, check.Equals, float64(0))
+	val, ok, err := trie.GetBytes(sum[:])
+	c.Assert(err, check.IsNil)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(val, check.Equals, 2)
+}
@@ -0,0 +1,140 @@
+package suffix
+
+import (
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// Len returns the number of keys in the trie.
+func (t *Trie[V]) Len() int {
+	return t.node(t.root).count
+}
+
+// CountPrefix returns the number of keys starting with prefix.
+func (t *Trie[V]) CountPrefix(prefix string) (int, error) {
+	prefix, err := t.alphabet.canonical(prefix)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := t.findPrefix(prefix)
+	if n == nil {
+		return 0, nil
+	}
+	return n.count, nil
+}
+
+// Rank returns the number of keys sorting before key, which need not be
+// in the trie.
+func (t *Trie[V]) Rank(key string) (int, error) {
+	key, err := t.alphabet.canonical(key)
+	if err != nil {
+		return 0, err
+	}
+
+	a := t.alphabet
+	rank := 0
+	n := t.node(t.root)
+	for len(key) > 0 {
+		if n.has {
+			rank++
+		}
+		pos, child := t.findChild(n, key[0])
+		for _, c := range t.children(n)[:pos] {
+			rank += t.node(c).count
+		}
+		if child == nil {
+			return rank, nil
+		}
+		label := t.label(child)
+		common := commonPrefix(key, label)
+		switch {
+		case common == len(label):
+			key = key[common:]
+			n = child
+		case common == len(key) || a.index[label[common]] > a.index[key[common]]:
+			return rank, nil
+		default:
+			return rank + child.count, nil
+		}
+	}
+	return rank, nil
+}
+
+// Select returns the key of rank k, counting from 0, and its value.
+func (t *Trie[V]) Select(k int) (string, V, bool) {
+	var value V
+	if k < 0 || k >= t.Len() {
+		return "", value, false
+	}
+
+	var key strings.Builder
+	n := t.node(t.root)
+	for {
+		key.WriteString(t.label(n))
+		if n.has {
+			if k == 0 {
+				return key.String(), n.value, true
+			}
+			k--
+		}
+		var next *node[V]
+		for _, ref := range t.children(n) {
+			child := t.node(ref)
+			if k < child.count {
+				next = child
+				break
+			}
+			k -= child.count
+		}
+		if next == nil {
+			return "", value, false
+		}
+		n = next
+	}
+}
+
+// PickRanks picks up to num distinct ranks below total uniformly at random
+// with Floyd's algorithm, in order. A nil r uses the default source of
+// math/rand.
+func PickRanks(total, num int, r *rand.Rand) []int {
+	if num > total {
+		num = total
+	}
+	if num <= 0 {
+		return nil
+	}
+	intn := rand.Intn
+	if r != nil {
+		intn = r.Intn
+	}
+	picked := make(map[int]bool, num)
+	for j := total - num; j < total; j++ {
+		k := intn(j + 1)
+		if picked[k] {
+			k = j
+		}
+		picked[k] = true
+	}
+	ranks := make([]int, 0, num)
+	for k := range picked {
+		ranks = append(ranks, k)
+	}
+	sort.Ints(ranks)
+	return ranks
+}
+
+// Sample returns up to num distinct keys picked uniformly at random, in
+// key order. A nil r uses the default source of math/rand.
+func (t *Trie[V]) Sample(num int, r *rand.Rand) []string {
+	ranks := PickRanks(t.Len(), num, r)
+	if len(ranks) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(ranks))
+	for _, k := range ranks {
+		key, _, _ := t.Select(k)
+		keys = append(keys, key)
+	}
+	return keys
+}
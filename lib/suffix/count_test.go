@@ -0,0 +1,149 @@
+package suffix
+
+import (
+	"math/rand"
+	"sort"
+	"strings"
+
+	"gopkg.in/check.v1"
+	"trie/lib/util"
+)
+
+var _ = check.Suite(&CountSuites{})
+
+type CountSuites struct {
+	trie *Trie[interface{}]
+	keys []string
+}
+
+func (cs *CountSuites) SetUpTest(c *check.C) {
+	rand := &util.RandString{
+		Sets: "0123456789ABCDEF",
+		Len:  5,
+	}
+	cs.trie = NewTrie[interface{}](HexAlphabet)
+	seen := map[string]bool{"A": true, "AB": true, "0": true}
+	for len(seen) < 3000 {
+		seen[rand.String()] = true
+	}
+	cs.keys = cs.keys[:0]
+	for k := range seen {
+		cs.keys = append(cs.keys, k)
+		mustPut(c, cs.trie, k, k)
+	}
+	sort.Strings(cs.keys)
+	// deleting keys merges nodes back, which must keep the counts right.
+	for i := 0; i < len(cs.keys); i += 3 {
+		mustDelete(c, cs.trie, cs.keys[i])
+		cs.keys[i] = ""
+	}
+	kept := cs.keys[:0]
+	for _, k := range cs.keys {
+		if k != "" {
+			kept = append(kept, k)
+		}
+	}
+	cs.keys = kept
+}
+
+func (cs *CountSuites) TestCounts(c *check.C) {
+	c.Assert(cs.trie.Len(), check.Equals, len(cs.keys))
+	checkCounts(c, cs.trie, cs.trie.node(cs.trie.root))
+
+	for _, prefix := range []string{"", "0", "A", "ab", "3F", "FFFFF", "FFFFFF"} {
+		want := 0
+		for _, k := range cs.keys {
+			if strings.HasPrefix(k, strings.ToUpper(prefix)) {
+				want++
+			}
+		}
+		count, err := cs.trie.CountPrefix(prefix)
+		c.Assert(err, check.IsNil)
+		c.Assert(count, check.Equals, want, check.Commentf("prefix %s", prefix))
+	}
+	_, err := cs.trie.CountPrefix("X")
+	c.Assert(err, check.NotNil)
+}
+
+func (cs *CountSuites) TestRankSelect(c *check.C) {
+	for i, k := range cs.keys {
+		rank, err := cs.trie.Rank(k)
+		c.Assert(err, check.IsNil)
+		c.Assert(rank, check.Equals, i)
+		key, value, ok := cs.trie.Select(i)
+		c.Assert(ok, check.Equals, true)
+		c.Assert(key, check.Equals, k)
+		c.Assert(value, check.Equals, k)
+	}
+	for _, k := range []string{"", "0", "00", "A0", "ABC", "F", "FFFFFF"} {
+		rank, err := cs.trie.Rank(k)
+		c.Assert(err, check.IsNil)
+		c.Assert(rank, check.Equals, sort.SearchStrings(cs.keys, k), check.Commentf("rank %s", k))
+	}
+	_, _, ok := cs.trie.Select(len(cs.keys))
+	c.Assert(ok, check.Equals, false)
+	_, _, ok = cs.trie.Select(-1)
+	c.Assert(ok, check.Equals, false)
+}
+
+func (cs *CountSuites) TestSample(c *check.C) {
+	r := rand.New(rand.NewSource(1))
+	keys := cs.trie.Sample(100, r)
+	c.Assert(keys, check.HasLen, 100)
+	c.Assert(sort.StringsAreSorted(keys), check.Equals, true)
+	for i, k := range keys {
+		if i > 0 {
+			c.Assert(k != keys[i-1], check.Equals, true)
+		}
+		c.Assert(mustGet(c, cs.trie, k), check.Equals, k)
+	}
+	c.Assert(cs.trie.Sample(len(cs.keys)+10, r), check.DeepEquals, cs.keys)
+	c.Assert(cs.trie.Sample(0, nil), check.IsNil)
+
+	// every key shows up about as often as any other.
+	hits := make(map[string]int)
+	for i := 0; i < 3000; i++ {
+		for _, k := range cs.trie.Sample(1, r) {
+			hits[k]++
+		}
+	}
+	c.Assert(len(hits) > len(cs.keys)/2, check.Equals, true)
+}
+
+func (cs *CountSuites) TestPickRanks(c *check.C) {
+	r := rand.New(rand.NewSource(1))
+	ranks := PickRanks(50, 20, r)
+	c.Assert(ranks, check.HasLen, 20)
+	for i, k := range ranks {
+		c.Assert(k >= 0 && k < 50, check.Equals, true)
+		if i > 0 {
+			c.Assert(k > ranks[i-1], check.Equals, true)
+		}
+	}
+	c.Assert(PickRanks(3, 5, nil), check.DeepEquals, []int{0, 1, 2})
+	c.Assert(PickRanks(0, 5, nil), check.IsNil)
+	c.Assert(PickRanks(5, -1, r), check.IsNil)
+}
+
+func (cs *CountSuites) TestSnapshotCounts(c *check.C) {
+	snap := cs.trie.Snapshot()
+	for _, k := range cs.keys[:100] {
+		mustDelete(c, cs.trie, k)
+	}
+	c.Assert(snap.Len(), check.Equals, len(cs.keys))
+	c.Assert(cs.trie.Len(), check.Equals, len(cs.keys)-100)
+	checkCounts(c, snap, snap.node(snap.root))
+	checkCounts(c, cs.trie, cs.trie.node(cs.trie.root))
+}
+
+func checkCounts[V any](c *check.C, t *Trie[V], n *node[V]) int {
+	count := 0
+	if n.has {
+		count++
+	}
+	for _, child := range t.children(n) {
+		count += checkCounts(c, t, t.node(child))
+	}
+	c.Assert(n.count, check.Equals, count)
+	return count
+}
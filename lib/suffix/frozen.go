@@ -0,0 +1,522 @@
+package suffix
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// A frozen trie is laid out as
+//
+//	header  magic, then the number of nodes and the sizes of the sections
+//	symbols the alphabet the keys were written with
+//	nodes   fixed size records in level order
+//	labels  the labels of all nodes back to back
+//	values  the encoded values back to back
+//
+// Level order keeps the children of a node next to each other, so a node
+// only records where its children start and how many there are, and a
+// child is found by a binary search over their first symbols. All numbers
+// are little endian uint32.
+const (
+	frozenMagic      = "SFXFROZ1"
+	frozenHeaderSize = len(frozenMagic) + 4*4
+	frozenNodeSize   = 8 * 4
+	frozenHasValue   = 1
+)
+
+var ErrBadFrozen = errors.New("Bad frozen trie")
+
+// frozenNode is one decoded node record.
+type frozenNode struct {
+	labelOff, labelLen uint32
+	first, children    uint32
+	count              uint32
+	valueOff, valueLen uint32
+	flags              uint32
+}
+
+func (n *frozenNode) has() bool {
+	return n.flags&frozenHasValue != 0
+}
+
+// Frozen is a read-only trie served straight from its serialized form,
+// either built in memory by Freeze or mapped from a file by OpenFrozen.
+// Values are returned as the encoded bytes given to WriteFrozen; they
+// point into the mapping and must not be used after Close. A Frozen is
+// safe for concurrent use.
+type Frozen struct {
+	alphabet *Alphabet
+	data     []byte
+	nodes    []byte
+	labels   []byte
+	values   []byte
+	unmap    func([]byte) error
+}
+
+// WriteFrozen writes the trie in the frozen layout, turning every value
+// into bytes with encode.
+func (t *Trie[V]) WriteFrozen(w io.Writer, encode func(V) ([]byte, error)) error {
+	nodes := []*node[V]{t.node(t.root)}
+	for i := 0; i < len(nodes); i++ {
+		for _, child := range t.children(nodes[i]) {
+			nodes = append(nodes, t.node(child))
+		}
+	}
+	if len(nodes) > math.MaxUint32 {
+		return fmt.Errorf("Too many nodes to freeze: %d", len(nodes))
+	}
+
+	values := make([][]byte, len(nodes))
+	labelsLen, valuesLen := 0, 0
+	for i, n := range nodes {
+		labelsLen += int(n.label.len)
+		if !n.has {
+			continue
+		}
+		value, err := encode(n.value)
+		if err != nil {
+			return fmt.Errorf("Failed to encode value, err: %v", err)
+		}
+		values[i] = value
+		valuesLen += len(value)
+	}
+	if labelsLen > math.MaxUint32 || valuesLen > math.MaxUint32 {
+		return fmt.Errorf("Trie too large to freeze: %d bytes of labels, %d bytes of values", labelsLen, valuesLen)
+	}
+
+	bw := bufio.NewWriter(w)
+	var buf [frozenNodeSize]byte
+	bw.WriteString(frozenMagic)
+	binary.LittleEndian.PutUint32(buf[0:], uint32(len(nodes)))
+	binary.LittleEndian.PutUint32(buf[4:], uint32(len(t.alphabet.symbols)))
+	binary.LittleEndian.PutUint32(buf[8:], uint32(labelsLen))
+	binary.LittleEndian.PutUint32(buf[12:], uint32(valuesLen))
+	bw.Write(buf[:16])
+	bw.WriteString(t.alphabet.symbols)
+
+	first, labelOff, valueOff := 1, 0, 0
+	for i, n := range nodes {
+		rec := frozenNode{
+			labelOff: uint32(labelOff),
+			labelLen: n.label.len,
+			first:    uint32(first),
+			children: n.children.len,
+			count:    uint32(n.count),
+			valueOff: uint32(valueOff),
+			valueLen: uint32(len(values[i])),
+		}
+		if n.has {
+			rec.flags |= frozenHasValue
+		}
+		putFrozenNode(buf[:], &rec)
+		bw.Write(buf[:])
+		first += int(n.children.len)
+		labelOff += int(n.label.len)
+		valueOff += len(values[i])
+	}
+	for _, n := range nodes {
+		bw.WriteString(t.label(n))
+	}
+	for _, value := range values {
+		bw.Write(value)
+	}
+	return bw.Flush()
+}
+
+// Freeze returns the trie in the frozen layout, held in memory.
+func (t *Trie[V]) Freeze(encode func(V) ([]byte, error)) (*Frozen, error) {
+	var buf bytes.Buffer
+	if err := t.WriteFrozen(&buf, encode); err != nil {
+		return nil, err
+	}
+	return newFrozen(buf.Bytes(), t.alphabet, nil)
+}
+
+// OpenFrozen maps a file written by WriteFrozen. The keys must have been
+// written with alphabet.
+func OpenFrozen(path string, alphabet *Alphabet) (*Frozen, error) {
+	data, unmap, err := mapFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := newFrozen(data, alphabet, unmap)
+	if err != nil {
+		unmap(data)
+		return nil, fmt.Errorf("Failed to open %s, err: %w", path, err)
+	}
+	return f, nil
+}
+
+// newFrozen checks the header, splits data into its sections and checks
+// every node record, so the lookups can follow the offsets as they are.
+func newFrozen(data []byte, alphabet *Alphabet, unmap func([]byte) error) (*Frozen, error) {
+	if len(data) < frozenHeaderSize || string(data[:len(frozenMagic)]) != frozenMagic {
+		return nil, ErrBadFrozen
+	}
+	hdr := data[len(frozenMagic):]
+	num := binary.LittleEndian.Uint32(hdr[0:])
+	sizes := []uint64{
+		uint64(binary.LittleEndian.Uint32(hdr[4:])),
+		uint64(num) * frozenNodeSize,
+		uint64(binary.LittleEndian.Uint32(hdr[8:])),
+		uint64(binary.LittleEndian.Uint32(hdr[12:])),
+	}
+	sections := make([][]byte, len(sizes))
+	rest := data[frozenHeaderSize:]
+	for i, size := range sizes {
+		if uint64(len(rest)) < size {
+			return nil, fmt.Errorf("%w: truncated", ErrBadFrozen)
+		}
+		sections[i], rest = rest[:size], rest[size:]
+	}
+	if num == 0 || len(rest) != 0 {
+		return nil, fmt.Errorf("%w: %d nodes, %d trailing bytes", ErrBadFrozen, num, len(rest))
+	}
+	if string(sections[0]) != alphabet.symbols {
+		return nil, fmt.Errorf("%w: not written with alphabet %s", ErrBadFrozen, alphabet.name)
+	}
+	f := &Frozen{
+		alphabet: alphabet,
+		data:     data,
+		nodes:    sections[1],
+		labels:   sections[2],
+		values:   sections[3],
+		unmap:    unmap,
+	}
+	if err := f.check(num); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// check makes sure every label and value lies in its section, only the
+// root has an empty label, and the children of a node come after it and
+// before the end, so no walk can leave the nodes or run in a circle.
+func (f *Frozen) check(num uint32) error {
+	for idx := uint32(0); idx < num; idx++ {
+		n := f.node(idx)
+		switch {
+		case (idx == 0) != (n.labelLen == 0):
+			return fmt.Errorf("%w: node %d has a label of %d bytes", ErrBadFrozen, idx, n.labelLen)
+		case uint64(n.labelOff)+uint64(n.labelLen) > uint64(len(f.labels)):
+			return fmt.Errorf("%w: label of node %d out of range", ErrBadFrozen, idx)
+		case uint64(n.valueOff)+uint64(n.valueLen) > uint64(len(f.values)):
+			return fmt.Errorf("%w: value of node %d out of range", ErrBadFrozen, idx)
+		case n.children > 0 && (n.first <= idx || uint64(n.first)+uint64(n.children) > uint64(num)):
+			return fmt.Errorf("%w: children of node %d out of range", ErrBadFrozen, idx)
+		}
+	}
+	return nil
+}
+
+// Close releases the mapping of a Frozen opened from a file.
+func (f *Frozen) Close() error {
+	if f.unmap == nil || f.data == nil {
+		return nil
+	}
+	data := f.data
+	f.data, f.nodes, f.labels, f.values = nil, nil, nil, nil
+	return f.unmap(data)
+}
+
+func (f *Frozen) Alphabet() *Alphabet {
+	return f.alphabet
+}
+
+func (f *Frozen) Len() int {
+	n := f.node(0)
+	return int(n.count)
+}
+
+func (f *Frozen) Get(key string) ([]byte, bool, error) {
+	key, err := f.alphabet.canonical(key)
+	if err != nil {
+		return nil, false, err
+	}
+	idx, ok := f.lookup(key)
+	if !ok {
+		return nil, false, nil
+	}
+	n := f.node(idx)
+	if !n.has() {
+		return nil, false, nil
+	}
+	return f.value(&n), true, nil
+}
+
+func (f *Frozen) Walk(walker WalkFunc[[]byte]) error {
+	return walkResult(f.walk(0, "", walker))
+}
+
+// WalkPrefix walks the keys starting with prefix in alphabet order.
+func (f *Frozen) WalkPrefix(prefix string, walker WalkFunc[[]byte]) error {
+	prefix, err := f.alphabet.canonical(prefix)
+	if err != nil {
+		return err
+	}
+	idx := uint32(0)
+	rest := prefix
+	for len(rest) > 0 {
+		child, ok := f.findChild(idx, rest[0])
+		if !ok {
+			return nil
+		}
+		n := f.node(child)
+		label := f.label(&n)
+		if len(rest) <= len(label) {
+			if !hasPrefix(label, rest) {
+				return nil
+			}
+			return walkResult(f.walk(child, prefix[:len(prefix)-len(rest)], walker))
+		}
+		if !hasPrefix(rest, label) {
+			return nil
+		}
+		rest = rest[len(label):]
+		idx = child
+	}
+	n := f.node(idx)
+	return walkResult(f.walk(idx, prefix[:len(prefix)-int(n.labelLen)], walker))
+}
+
+func (f *Frozen) walk(idx uint32, key string, walker WalkFunc[[]byte]) error {
+	n := f.node(idx)
+	key += string(f.label(&n))
+	if n.has() {
+		if err := walker(key, f.value(&n)); err != nil {
+			if err == SkipSubtree {
+				return nil
+			}
+			return err
+		}
+	}
+	for i := uint32(0); i < n.children; i++ {
+		if err := f.walk(n.first+i, key, walker); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lookup returns the node of a canonical key, which may hold no value.
+func (f *Frozen) lookup(key string) (uint32, bool) {
+	idx := uint32(0)
+	for len(key) > 0 {
+		child, ok := f.findChild(idx, key[0])
+		if !ok {
+			return 0, false
+		}
+		n := f.node(child)
+		label := f.label(&n)
+		if !hasPrefix(key, label) {
+			return 0, false
+		}
+		key = key[len(label):]
+		idx = child
+	}
+	return idx, true
+}
+
+// findChild returns the child of node idx whose label starts with b, or
+// the index of the first child sorting after b.
+func (f *Frozen) findChild(idx uint32, b byte) (uint32, bool) {
+	n := f.node(idx)
+	want := f.alphabet.index[b]
+	i := sort.Search(int(n.children), func(i int) bool {
+		return f.alphabet.index[f.firstSymbol(n.first+uint32(i))] >= want
+	})
+	child := n.first + uint32(i)
+	return child, uint32(i) < n.children && f.alphabet.index[f.firstSymbol(child)] == want
+}
+
+func (f *Frozen) firstSymbol(idx uint32) byte {
+	off := binary.LittleEndian.Uint32(f.nodes[int(idx)*frozenNodeSize:])
+	return f.labels[off]
+}
+
+func (f *Frozen) node(idx uint32) frozenNode {
+	b := f.nodes[int(idx)*frozenNodeSize : int(idx+1)*frozenNodeSize]
+	return frozenNode{
+		labelOff: binary.LittleEndian.Uint32(b[0:]),
+		labelLen: binary.LittleEndian.Uint32(b[4:]),
+		first:    binary.LittleEndian.Uint32(b[8:]),
+		children: binary.LittleEndian.Uint32(b[12:]),
+		count:    binary.LittleEndian.Uint32(b[16:]),
+		valueOff: binary.LittleEndian.Uint32(b[20:]),
+		valueLen: binary.LittleEndian.Uint32(b[24:]),
+		flags:    binary.LittleEndian.Uint32(b[28:]),
+	}
+}
+
+func putFrozenNode(b []byte, n *frozenNode) {
+	binary.LittleEndian.PutUint32(b[0:], n.labelOff)
+	binary.LittleEndian.PutUint32(b[4:], n.labelLen)
+	binary.LittleEndian.PutUint32(b[8:], n.first)
+	binary.LittleEndian.PutUint32(b[12:], n.children)
+	binary.LittleEndian.PutUint32(b[16:], n.count)
+	binary.LittleEndian.PutUint32(b[20:], n.valueOff)
+	binary.LittleEndian.PutUint32(b[24:], n.valueLen)
+	binary.LittleEndian.PutUint32(b[28:], n.flags)
+}
+
+func (f *Frozen) label(n *frozenNode) []byte {
+	return f.labels[n.labelOff : n.labelOff+n.labelLen]
+}
+
+func (f *Frozen) value(n *frozenNode) []byte {
+	return f.values[n.valueOff : n.valueOff+n.valueLen : n.valueOff+n.valueLen]
+}
+
+// hasPrefix reports whether s starts with prefix, which are either labels
+// of the mapping or keys, without copying either.
+func hasPrefix[X, Y string | []byte](s X, prefix Y) bool {
+	if len(s) < len(prefix) {
+		return false
+	}
+	for i := 0; i < len(prefix); i++ {
+		if s[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// FrozenIterator visits the keys of a Frozen in alphabet order.
+type FrozenIterator struct {
+	f     *Frozen
+	stack []frozenFrame
+	valid bool
+}
+
+// frozenFrame is one node on the path to the current key, pos is the
+// child being visited or -1 while at the node itself.
+type frozenFrame struct {
+	idx uint32
+	n   frozenNode
+	key string
+	pos int
+}
+
+// Iterator returns an unpositioned iterator over all keys.
+func (f *Frozen) Iterator() *FrozenIterator {
+	return &FrozenIterator{f: f}
+}
+
+func (it *FrozenIterator) Valid() bool {
+	return it.valid
+}
+
+func (it *FrozenIterator) Key() string {
+	if !it.valid {
+		return ""
+	}
+	return it.top().key
+}
+
+// Value returns the encoded value of the current key.
+func (it *FrozenIterator) Value() []byte {
+	if !it.valid {
+		return nil
+	}
+	return it.f.value(&it.top().n)
+}
+
+// First moves to the smallest key.
+func (it *FrozenIterator) First() bool {
+	it.reset()
+	return it.done(it.top().n.has() || it.advance())
+}
+
+// Next moves to the following key. An unpositioned iterator moves to the
+// first key.
+func (it *FrozenIterator) Next() bool {
+	if !it.valid {
+		return it.First()
+	}
+	return it.done(it.advance())
+}
+
+// Seek moves to the smallest key not less than key.
+func (it *FrozenIterator) Seek(key string) bool {
+	key, err := it.f.alphabet.canonical(key)
+	if err != nil {
+		return it.done(false)
+	}
+	index := &it.f.alphabet.index
+	it.reset()
+	rest := key
+	for {
+		fr := it.top()
+		if len(rest) == 0 {
+			return it.done(fr.n.has() || it.advance())
+		}
+		child, ok := it.f.findChild(fr.idx, rest[0])
+		fr.pos = int(child - fr.n.first)
+		if !ok {
+			// every child from pos on sorts after key.
+			fr.pos--
+			return it.done(it.advance())
+		}
+		it.push(child)
+		label := it.f.label(&it.top().n)
+		common := 0
+		for common < len(label) && common < len(rest) && label[common] == rest[common] {
+			common++
+		}
+		switch {
+		case common == len(label):
+			rest = rest[common:]
+		case common == len(rest) || index[label[common]] > index[rest[common]]:
+			return it.done(it.top().n.has() || it.advance())
+		default:
+			// the whole subtree of child sorts before key.
+			it.stack = it.stack[:len(it.stack)-1]
+			return it.done(it.advance())
+		}
+	}
+}
+
+// advance moves to the next node holding a value in pre-order.
+func (it *FrozenIterator) advance() bool {
+	for len(it.stack) > 0 {
+		fr := it.top()
+		fr.pos++
+		if fr.pos < int(fr.n.children) {
+			it.push(fr.n.first + uint32(fr.pos))
+			if it.top().n.has() {
+				return true
+			}
+			continue
+		}
+		it.stack = it.stack[:len(it.stack)-1]
+	}
+	return false
+}
+
+func (it *FrozenIterator) top() *frozenFrame {
+	return &it.stack[len(it.stack)-1]
+}
+
+func (it *FrozenIterator) push(idx uint32) {
+	n := it.f.node(idx)
+	key := it.top().key + string(it.f.label(&n))
+	it.stack = append(it.stack, frozenFrame{idx: idx, n: n, key: key, pos: -1})
+}
+
+func (it *FrozenIterator) reset() {
+	it.stack = append(it.stack[:0], frozenFrame{n: it.f.node(0), pos: -1})
+}
+
+func (it *FrozenIterator) done(ok bool) bool {
+	it.valid = ok
+	if !ok {
+		it.stack = it.stack[:0]
+	}
+	return ok
+}
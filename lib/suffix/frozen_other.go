@@ -0,0 +1,16 @@
+//go:build !unix
+
+package suffix
+
+import (
+	"os"
+)
+
+// mapFile reads the whole file where mmap is not available.
+func mapFile(path string) ([]byte, func([]byte) error, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func([]byte) error { return nil }, nil
+}
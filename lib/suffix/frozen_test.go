@@ -0,0 +1,168 @@
+package suffix
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/check.v1"
+	"trie/lib/util"
+)
+
+var _ = check.Suite(&FrozenSuites{})
+
+type FrozenSuites struct {
+	trie *Trie[string]
+	keys []string
+}
+
+func encodeString(v string) ([]byte, error) {
+	return []byte(v), nil
+}
+
+func (fs *FrozenSuites) SetUpTest(c *check.C) {
+	rand := &util.RandString{
+		Sets: "0123456789ABCDEF",
+		Len:  6,
+	}
+	fs.trie = NewTrie[string](HexAlphabet)
+	seen := map[string]bool{"0": true, "00": true, "A": true, "AB": true, "ABC": true}
+	for len(seen) < 3000 {
+		seen[rand.String()] = true
+	}
+	fs.keys = fs.keys[:0]
+	for k := range seen {
+		fs.keys = append(fs.keys, k)
+		_, err := fs.trie.Put(k, strings.ToLower(k))
+		c.Assert(err, check.IsNil)
+	}
+	sort.Strings(fs.keys)
+}
+
+func (fs *FrozenSuites) open(c *check.C) *Frozen {
+	path := filepath.Join(c.MkDir(), "frozen")
+	file, err := os.Create(path)
+	c.Assert(err, check.IsNil)
+	c.Assert(fs.trie.WriteFrozen(file, encodeString), check.IsNil)
+	c.Assert(file.Close(), check.IsNil)
+	f, err := OpenFrozen(path, HexAlphabet)
+	c.Assert(err, check.IsNil)
+	return f
+}
+
+func (fs *FrozenSuites) TestGet(c *check.C) {
+	f := fs.open(c)
+	defer f.Close()
+	c.Assert(f.Len(), check.Equals, len(fs.keys))
+	for _, k := range fs.keys {
+		value, ok, err := f.Get(strings.ToLower(k))
+		c.Assert(err, check.IsNil)
+		c.Assert(ok, check.Equals, true)
+		c.Assert(string(value), check.Equals, strings.ToLower(k))
+	}
+	for _, k := range []string{"", "FFFFFFF", "0000000"} {
+		_, ok, err := f.Get(k)
+		c.Assert(err, check.IsNil)
+		c.Assert(ok, check.Equals, false)
+	}
+	_, _, err := f.Get("XY")
+	c.Assert(err, check.FitsTypeOf, &InvalidKeyError{})
+}
+
+func (fs *FrozenSuites) TestWalkPrefix(c *check.C) {
+	f, err := fs.trie.Freeze(encodeString)
+	c.Assert(err, check.IsNil)
+	for _, prefix := range []string{"", "0", "a", "AB", "3F", "FFFFFF", "FFFFFFF"} {
+		var want, got []string
+		for _, k := range fs.keys {
+			if strings.HasPrefix(k, strings.ToUpper(prefix)) {
+				want = append(want, k)
+			}
+		}
+		err := f.WalkPrefix(prefix, func(key string, value []byte) error {
+			c.Assert(string(value), check.Equals, strings.ToLower(key))
+			got = append(got, key)
+			return nil
+		})
+		c.Assert(err, check.IsNil)
+		c.Assert(got, check.DeepEquals, want, check.Commentf("prefix %s", prefix))
+	}
+
+	n := 0
+	err = f.Walk(func(string, []byte) error {
+		n++
+		return StopWalk
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(n, check.Equals, 1)
+}
+
+func (fs *FrozenSuites) TestIterator(c *check.C) {
+	f := fs.open(c)
+	defer f.Close()
+	it := f.Iterator()
+	var keys []string
+	for it.Next() {
+		c.Assert(string(it.Value()), check.Equals, strings.ToLower(it.Key()))
+		keys = append(keys, it.Key())
+	}
+	c.Assert(keys, check.DeepEquals, fs.keys)
+
+	for _, key := range []string{"", "0", "00", "000", "0B", "AB0", "abc", "ABC0", "EFFFFF", "FF", "FFFFFFF"} {
+		i := sort.SearchStrings(fs.keys, strings.ToUpper(key))
+		ok := it.Seek(key)
+		c.Assert(ok, check.Equals, i < len(fs.keys), check.Commentf("seek %s", key))
+		if ok {
+			c.Assert(it.Key(), check.Equals, fs.keys[i], check.Commentf("seek %s", key))
+			if i+1 < len(fs.keys) {
+				c.Assert(it.Next(), check.Equals, true)
+				c.Assert(it.Key(), check.Equals, fs.keys[i+1])
+			}
+		}
+	}
+}
+
+func (fs *FrozenSuites) TestBadFile(c *check.C) {
+	var buf strings.Builder
+	c.Assert(fs.trie.WriteFrozen(&buf, encodeString), check.IsNil)
+	data := buf.String()
+
+	dir := c.MkDir()
+	for i, bad := range []string{"", "SFXFROZ1", data[:len(data)-1], data + "0", "X" + data[1:]} {
+		path := filepath.Join(dir, string(rune('a'+i)))
+		c.Assert(os.WriteFile(path, []byte(bad), 0644), check.IsNil)
+		_, err := OpenFrozen(path, HexAlphabet)
+		c.Assert(errors.Is(err, ErrBadFrozen), check.Equals, true, check.Commentf("case %d", i))
+	}
+
+	// node records pointing out of their sections or back up the tree.
+	nodes := frozenHeaderSize + len(HexAlphabet.symbols)
+	for i, bad := range []struct {
+		idx, field int
+		value      uint32
+	}{
+		{1, 0, 1 << 20},
+		{1, 4, 0},
+		{0, 4, 1},
+		{1, 24, 1 << 30},
+		{0, 12, 1 << 30},
+		{1, 8, 0},
+	} {
+		b := []byte(data)
+		off := nodes + bad.idx*frozenNodeSize + bad.field
+		binary.LittleEndian.PutUint32(b[off:], bad.value)
+		if bad.field == 8 {
+			binary.LittleEndian.PutUint32(b[off+4:], 1)
+		}
+		_, err := newFrozen(b, HexAlphabet, nil)
+		c.Assert(errors.Is(err, ErrBadFrozen), check.Equals, true, check.Commentf("node case %d: %v", i, err))
+	}
+
+	path := filepath.Join(dir, "good")
+	c.Assert(os.WriteFile(path, []byte(data), 0644), check.IsNil)
+	_, err := OpenFrozen(path, Base32Alphabet)
+	c.Assert(errors.Is(err, ErrBadFrozen), check.Equals, true)
+}
@@ -0,0 +1,30 @@
+//go:build unix
+
+package suffix
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// mapFile maps the file at path read only.
+func mapFile(path string) ([]byte, func([]byte) error, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	if info.Size() == 0 {
+		return nil, nil, fmt.Errorf("%w: %s is empty", ErrBadFrozen, path)
+	}
+	data, err := syscall.Mmap(int(file.Fd()), 0, int(info.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to map %s, err: %v", path, err)
+	}
+	return data, syscall.Munmap, nil
+}
@@ -0,0 +1,255 @@
+package suffix
+
+// Iterator visits the keys of a Trie in alphabet order, optionally limited
+// to the half-open range [start, end). An iterator over a snapshot is
+// valid until the snapshot is released. It is not safe for concurrent use
+// with writers, but it survives modifications of the trie between calls:
+// when the trie has changed it finds its place again from its last key.
+type Iterator[V any] struct {
+	trie    *Trie[V]
+	start   string
+	end     string
+	stack   []frame[V]
+	version uint64
+	valid   bool
+	err     error
+}
+
+// frame is one node on the path from the root to the current key. pos is
+// the index of the child being visited, or -1 while at the node itself.
+type frame[V any] struct {
+	n   *node[V]
+	key string
+	pos int
+}
+
+// Iterator returns an unpositioned iterator over all keys.
+func (t *Trie[V]) Iterator() *Iterator[V] {
+	return &Iterator[V]{trie: t}
+}
+
+// RangeIterator returns an unpositioned iterator over the keys in
+// [start, end). An empty end leaves the range open.
+func (t *Trie[V]) RangeIterator(start, end string) (*Iterator[V], error) {
+	start, err := t.alphabet.canonical(start)
+	if err != nil {
+		return nil, err
+	}
+	end, err = t.alphabet.canonical(end)
+	if err != nil {
+		return nil, err
+	}
+	return &Iterator[V]{
+		trie:  t,
+		start: start,
+		end:   end,
+	}, nil
+}
+
+func (it *Iterator[V]) Valid() bool {
+	return it.valid
+}
+
+// Err returns the error of the last move, which only a Seek to an invalid
+// key has.
+func (it *Iterator[V]) Err() error {
+	return it.err
+}
+
+func (it *Iterator[V]) Key() string {
+	if !it.valid {
+		return ""
+	}
+	return it.top().key
+}
+
+func (it *Iterator[V]) Value() V {
+	if !it.valid {
+		var zero V
+		return zero
+	}
+	if it.version != it.trie.version {
+		// the node may have been reused since, look the key up again.
+		value, _, _ := it.trie.Get(it.Key())
+		return value
+	}
+	return it.top().n.value
+}
+
+// First moves to the smallest key of the range.
+func (it *Iterator[V]) First() bool {
+	it.err = nil
+	return it.check(it.seek(it.start))
+}
+
+// Last moves to the largest key of the range.
+func (it *Iterator[V]) Last() bool {
+	it.err = nil
+	if it.end != "" && it.seek(it.end) {
+		return it.check(it.retreat())
+	}
+	it.reset()
+	return it.check(it.descendLast())
+}
+
+// Seek moves to the smallest key not less than key.
+func (it *Iterator[V]) Seek(key string) bool {
+	key, err := it.trie.alphabet.canonical(key)
+	if err != nil {
+		it.err = err
+		return it.check(false)
+	}
+	it.err = nil
+	if it.trie.alphabet.compare(key, it.start) < 0 {
+		key = it.start
+	}
+	return it.check(it.seek(key))
+}
+
+// Next moves to the following key. An unpositioned iterator moves to the
+// first key.
+func (it *Iterator[V]) Next() bool {
+	it.err = nil
+	if !it.valid {
+		return it.First()
+	}
+	if it.version != it.trie.version {
+		key := it.Key()
+		if !it.seek(key) || it.top().key != key {
+			return it.check(len(it.stack) > 0)
+		}
+	}
+	return it.check(it.advance())
+}
+
+// Prev moves to the preceding key. An unpositioned iterator moves to the
+// last key.
+func (it *Iterator[V]) Prev() bool {
+	it.err = nil
+	if !it.valid {
+		return it.Last()
+	}
+	if it.version != it.trie.version && !it.seek(it.Key()) {
+		return it.Last()
+	}
+	return it.check(it.retreat())
+}
+
+// seek positions the iterator at the smallest key not less than key.
+func (it *Iterator[V]) seek(key string) bool {
+	a := it.trie.alphabet
+	it.reset()
+	rest := key
+	for {
+		f := it.top()
+		if len(rest) == 0 {
+			return f.n.has || it.advance()
+		}
+		i, child := it.trie.findChild(f.n, rest[0])
+		if child == nil {
+			// every child from i on sorts after key.
+			f.pos = i - 1
+			return it.advance()
+		}
+		f.pos = i
+		it.push(child)
+		label := it.trie.label(child)
+		common := commonPrefix(rest, label)
+		switch {
+		case common == len(label):
+			rest = rest[common:]
+		case common == len(rest) || a.index[label[common]] > a.index[rest[common]]:
+			return child.has || it.advance()
+		default:
+			// the whole subtree of child sorts before key.
+			it.stack = it.stack[:len(it.stack)-1]
+			return it.advance()
+		}
+	}
+}
+
+// advance moves to the next node holding a value in pre-order.
+func (it *Iterator[V]) advance() bool {
+	for len(it.stack) > 0 {
+		f := it.top()
+		f.pos++
+		if f.pos < int(f.n.children.len) {
+			child := it.trie.node(it.trie.children(f.n)[f.pos])
+			it.push(child)
+			if child.has {
+				return true
+			}
+			continue
+		}
+		it.stack = it.stack[:len(it.stack)-1]
+	}
+	return false
+}
+
+// retreat moves to the previous node holding a value in pre-order.
+func (it *Iterator[V]) retreat() bool {
+	for {
+		it.stack = it.stack[:len(it.stack)-1]
+		if len(it.stack) == 0 {
+			return false
+		}
+		f := it.top()
+		f.pos--
+		if f.pos >= 0 {
+			it.push(it.trie.node(it.trie.children(f.n)[f.pos]))
+			return it.descendLast()
+		}
+		if f.n.has {
+			return true
+		}
+	}
+}
+
+// descendLast moves to the last node holding a value in the subtree on top
+// of the stack.
+func (it *Iterator[V]) descendLast() bool {
+	for {
+		f := it.top()
+		if f.n.children.len == 0 {
+			break
+		}
+		f.pos = int(f.n.children.len) - 1
+		it.push(it.trie.node(it.trie.children(f.n)[f.pos]))
+	}
+	if it.top().n.has {
+		return true
+	}
+	return it.retreat()
+}
+
+func (it *Iterator[V]) top() *frame[V] {
+	return &it.stack[len(it.stack)-1]
+}
+
+func (it *Iterator[V]) push(n *node[V]) {
+	key := extend(it.top().key, it.trie.label(n))
+	it.stack = append(it.stack, frame[V]{n: n, key: key, pos: -1})
+}
+
+func (it *Iterator[V]) reset() {
+	it.stack = append(it.stack[:0], frame[V]{n: it.trie.node(it.trie.root), pos: -1})
+	it.version = it.trie.version
+}
+
+// check applies the range bounds to the position reached by a move.
+func (it *Iterator[V]) check(ok bool) bool {
+	it.valid = false
+	if !ok {
+		it.stack = it.stack[:0]
+		return false
+	}
+	key := it.top().key
+	a := it.trie.alphabet
+	if a.compare(key, it.start) < 0 || (it.end != "" && a.compare(key, it.end) >= 0) {
+		it.stack = it.stack[:0]
+		return false
+	}
+	it.version = it.trie.version
+	it.valid = true
+	return true
+}
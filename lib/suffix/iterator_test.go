@@ -0,0 +1,126 @@
+package suffix
+
+import (
+	"sort"
+
+	"gopkg.in/check.v1"
+	"trie/lib/util"
+)
+
+var _ = check.Suite(&IteratorSuites{})
+
+type IteratorSuites struct {
+	trie *Trie[interface{}]
+	keys []string
+}
+
+func (is *IteratorSuites) SetUpTest(c *check.C) {
+	rand := &util.RandString{
+		Sets: "0123456789ABCDEF",
+		Len:  6,
+	}
+	is.trie = NewTrie[interface{}](HexAlphabet)
+	seen := make(map[string]bool)
+	// short keys make sure values sit on inner nodes as well.
+	for _, k := range []string{"0", "00", "0A", "A", "AB", "ABC", "F"} {
+		seen[k] = true
+	}
+	for len(seen) < 2000 {
+		seen[rand.String()] = true
+	}
+	is.keys = is.keys[:0]
+	for k := range seen {
+		is.keys = append(is.keys, k)
+		mustPut(c, is.trie, k, k)
+	}
+	sort.Strings(is.keys)
+}
+
+func (is *IteratorSuites) TestForwardBackward(c *check.C) {
+	it := is.trie.Iterator()
+	var keys []string
+	for it.Next() {
+		c.Assert(it.Value(), check.Equals, it.Key())
+		keys = append(keys, it.Key())
+	}
+	c.Assert(keys, check.DeepEquals, is.keys)
+	c.Assert(it.Valid(), check.Equals, false)
+
+	keys = keys[:0]
+	for ok := it.Last(); ok; ok = it.Prev() {
+		keys = append(keys, it.Key())
+	}
+	c.Assert(len(keys), check.Equals, len(is.keys))
+	for i, k := range keys {
+		c.Assert(k, check.Equals, is.keys[len(is.keys)-1-i])
+	}
+}
+
+func (is *IteratorSuites) TestSeek(c *check.C) {
+	it := is.trie.Iterator()
+	for _, key := range []string{"", "0", "00", "000", "0B", "AB0", "ABC", "ABC0", "EFFFFF", "FF", "FFFFFFF"} {
+		i := sort.SearchStrings(is.keys, key)
+		ok := it.Seek(key)
+		c.Assert(ok, check.Equals, i < len(is.keys), check.Commentf("seek %s", key))
+		if ok {
+			c.Assert(it.Key(), check.Equals, is.keys[i], check.Commentf("seek %s", key))
+		}
+		if i > 0 && it.Seek(key) {
+			c.Assert(it.Prev(), check.Equals, true)
+			c.Assert(it.Key(), check.Equals, is.keys[i-1])
+		}
+	}
+	c.Assert(it.Seek("ab"), check.Equals, true)
+	c.Assert(it.Key(), check.Equals, "AB")
+	c.Assert(it.Seek("XY"), check.Equals, false)
+	c.Assert(it.Err(), check.FitsTypeOf, &InvalidKeyError{})
+	c.Assert(it.First(), check.Equals, true)
+	c.Assert(it.Err(), check.IsNil)
+}
+
+func (is *IteratorSuites) TestRange(c *check.C) {
+	it, err := is.trie.RangeIterator("3", "A")
+	c.Assert(err, check.IsNil)
+	lo := sort.SearchStrings(is.keys, "3")
+	hi := sort.SearchStrings(is.keys, "A")
+
+	var keys []string
+	for it.Next() {
+		keys = append(keys, it.Key())
+	}
+	c.Assert(keys, check.DeepEquals, is.keys[lo:hi])
+
+	keys = keys[:0]
+	for it.Prev() {
+		keys = append(keys, it.Key())
+	}
+	c.Assert(len(keys), check.Equals, hi-lo)
+	c.Assert(keys[0], check.Equals, is.keys[hi-1])
+	c.Assert(keys[len(keys)-1], check.Equals, is.keys[lo])
+
+	c.Assert(it.Seek("0"), check.Equals, true)
+	c.Assert(it.Key(), check.Equals, is.keys[lo])
+	c.Assert(it.Seek("A"), check.Equals, false)
+
+	_, err = is.trie.RangeIterator("G", "")
+	c.Assert(err, check.NotNil)
+}
+
+func (is *IteratorSuites) TestModifyWhileIterating(c *check.C) {
+	it := is.trie.Iterator()
+	c.Assert(it.Seek("AB"), check.Equals, true)
+	mustDelete(c, is.trie, "AB")
+	mustDelete(c, is.trie, "ABC")
+	mustPut(c, is.trie, "AB0", "AB0")
+	c.Assert(it.Next(), check.Equals, true)
+	c.Assert(it.Key(), check.Equals, "AB0")
+
+	var keys []string
+	for it.Next() {
+		keys = append(keys, it.Key())
+		mustDelete(c, is.trie, it.Key())
+	}
+	c.Assert(keys[len(keys)-1], check.Equals, is.keys[len(is.keys)-1])
+	c.Assert(it.Last(), check.Equals, true)
+	c.Assert(it.Key(), check.Equals, "AB0")
+}
@@ -0,0 +1,244 @@
+package suffix
+
+import (
+	"fmt"
+)
+
+// Pattern is a compiled glob over the keys of an alphabet. It supports
+//
+//	?      any one symbol
+//	[...]  one symbol of a class, such as [0-3A] or [!F]; ranges follow
+//	       the order of the alphabet
+//	*      any run of symbols, only at the end of the pattern
+//	\x     the symbol x itself
+//
+// Symbols are folded like keys, so [a-f] matches the upper case keys of
+// HexAlphabet.
+type Pattern struct {
+	alphabet *Alphabet
+	pattern  string
+	elems    []symbolSet
+	// rest is set by a trailing *.
+	rest bool
+}
+
+// PatternError tells where a pattern could not be compiled.
+type PatternError struct {
+	Pattern string
+	Pos     int
+	Reason  string
+}
+
+func (e *PatternError) Error() string {
+	return fmt.Sprintf("Bad pattern %s at %d: %s", e.Pattern, e.Pos, e.Reason)
+}
+
+// symbolSet holds canonical symbols by byte value.
+type symbolSet [4]uint64
+
+func (s *symbolSet) add(b byte) {
+	s[b>>6] |= 1 << (b & 63)
+}
+
+func (s *symbolSet) has(b byte) bool {
+	return s[b>>6]&(1<<(b&63)) != 0
+}
+
+func CompilePattern(alphabet *Alphabet, pattern string) (*Pattern, error) {
+	p := &Pattern{
+		alphabet: alphabet,
+		pattern:  pattern,
+	}
+	fail := func(pos int, reason string) (*Pattern, error) {
+		return nil, &PatternError{Pattern: pattern, Pos: pos, Reason: reason}
+	}
+	for i := 0; i < len(pattern); i++ {
+		var set symbolSet
+		switch c := pattern[i]; c {
+		case '*':
+			if i != len(pattern)-1 {
+				return fail(i, "only a trailing * is supported")
+			}
+			p.rest = true
+			continue
+		case '?':
+			for j := 0; j < len(alphabet.symbols); j++ {
+				set.add(alphabet.symbols[j])
+			}
+		case '[':
+			end, err := p.parseClass(i, &set)
+			if err != nil {
+				return nil, err
+			}
+			i = end
+		case '\\':
+			if i++; i == len(pattern) {
+				return fail(i-1, "trailing \\")
+			}
+			fallthrough
+		default:
+			idx := alphabet.index[pattern[i]]
+			if idx < 0 {
+				return fail(i, fmt.Sprintf("%q is not in alphabet %s", pattern[i], alphabet.name))
+			}
+			set.add(alphabet.symbols[idx])
+		}
+		p.elems = append(p.elems, set)
+	}
+	return p, nil
+}
+
+// parseClass parses the class opening at start and returns the position
+// of its closing bracket.
+func (p *Pattern) parseClass(start int, set *symbolSet) (int, error) {
+	a, pattern := p.alphabet, p.pattern
+	symbol := func(i int) (int16, error) {
+		if pattern[i] == '\\' && i+1 < len(pattern) {
+			i++
+		}
+		idx := a.index[pattern[i]]
+		if idx < 0 {
+			return -1, &PatternError{Pattern: pattern, Pos: i, Reason: fmt.Sprintf("%q is not in alphabet %s", pattern[i], a.name)}
+		}
+		return idx, nil
+	}
+	width := func(i int) int {
+		if pattern[i] == '\\' && i+1 < len(pattern) {
+			return 2
+		}
+		return 1
+	}
+
+	var in [256]bool
+	i := start + 1
+	negate := i < len(pattern) && (pattern[i] == '!' || pattern[i] == '^')
+	if negate {
+		i++
+	}
+	for first := true; ; first = false {
+		if i >= len(pattern) {
+			return 0, &PatternError{Pattern: pattern, Pos: start, Reason: "unclosed ["}
+		}
+		if pattern[i] == ']' && !first {
+			break
+		}
+		lo, err := symbol(i)
+		if err != nil {
+			return 0, err
+		}
+		hi := lo
+		i += width(i)
+		if i+1 < len(pattern) && pattern[i] == '-' && pattern[i+1] != ']' {
+			if hi, err = symbol(i + 1); err != nil {
+				return 0, err
+			}
+			if hi < lo {
+				return 0, &PatternError{Pattern: pattern, Pos: i, Reason: "range out of order"}
+			}
+			i += 1 + width(i+1)
+		}
+		for idx := lo; idx <= hi; idx++ {
+			in[idx] = true
+		}
+	}
+	for idx := 0; idx < len(a.symbols); idx++ {
+		if in[idx] != negate {
+			set.add(a.symbols[idx])
+		}
+	}
+	return i, nil
+}
+
+func (p *Pattern) String() string {
+	return p.pattern
+}
+
+// Match reports whether key matches the whole pattern.
+func (p *Pattern) Match(key string) bool {
+	key, err := p.alphabet.canonical(key)
+	if err != nil || len(key) < len(p.elems) || (!p.rest && len(key) > len(p.elems)) {
+		return false
+	}
+	return p.matchFrom(key[:len(p.elems)])
+}
+
+// MatchPrefix reports whether some key starting with prefix may match,
+// which tells the subtrees or shards a pattern can touch.
+func (p *Pattern) MatchPrefix(prefix string) bool {
+	prefix, err := p.alphabet.canonical(prefix)
+	if err != nil {
+		return false
+	}
+	if len(prefix) > len(p.elems) {
+		if !p.rest {
+			return false
+		}
+		prefix = prefix[:len(p.elems)]
+	}
+	return p.matchFrom(prefix)
+}
+
+// matchFrom checks the canonical symbols s against the start of the pattern.
+func (p *Pattern) matchFrom(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !p.elems[i].has(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Match walks the keys matching pattern in alphabet order, leaving out
+// the subtrees whose path already fails it.
+func (t *Trie[V]) Match(pattern string, walker WalkFunc[V]) error {
+	p, err := CompilePattern(t.alphabet, pattern)
+	if err != nil {
+		return err
+	}
+	return t.MatchPattern(p, walker)
+}
+
+func (t *Trie[V]) MatchPattern(p *Pattern, walker WalkFunc[V]) error {
+	if p.alphabet != t.alphabet {
+		return fmt.Errorf("Pattern %s is not over alphabet %s", p.pattern, t.alphabet.name)
+	}
+	return walkResult(t.match(t.node(t.root), "", p, walker))
+}
+
+// match walks the matching keys below n, key leads to n without its label.
+func (t *Trie[V]) match(n *node[V], key string, p *Pattern, walker WalkFunc[V]) error {
+	depth := len(key)
+	label := t.label(n)
+	for i := 0; i < len(label); i++ {
+		if depth+i == len(p.elems) {
+			// the pattern is used up inside the label.
+			if p.rest {
+				return t.walk(n, key, walker)
+			}
+			return nil
+		}
+		if !p.elems[depth+i].has(label[i]) {
+			return nil
+		}
+	}
+	if depth+len(label) == len(p.elems) {
+		if p.rest {
+			return t.walk(n, key, walker)
+		}
+		if !n.has {
+			return nil
+		}
+		if err := walker(extend(key, label), n.value); err != nil && err != SkipSubtree {
+			return err
+		}
+		return nil
+	}
+
+	key = extend(key, label)
+	for _, child := range t.children(n) {
+		if err := t.match(t.node(child), key, p, walker); err != nil {
+			return err
+		}
+	}
+	return nil
+}
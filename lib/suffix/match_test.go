@@ -0,0 +1,97 @@
+package suffix
+
+import (
+	"sort"
+	"strings"
+
+	"gopkg.in/check.v1"
+	"trie/lib/util"
+)
+
+var _ = check.Suite(&MatchSuites{})
+
+type MatchSuites struct {
+	trie *Trie[interface{}]
+	keys []string
+}
+
+func (ms *MatchSuites) SetUpTest(c *check.C) {
+	rand := &util.RandString{
+		Sets: "0123456789ABCDEF",
+		Len:  5,
+	}
+	ms.trie = NewTrie[interface{}](HexAlphabet)
+	seen := map[string]bool{"": true, "A": true, "AB": true, "AB3": true, "AB03": true, "ABC3F": true}
+	for len(seen) < 5000 {
+		seen[rand.String()] = true
+	}
+	ms.keys = ms.keys[:0]
+	for k := range seen {
+		ms.keys = append(ms.keys, k)
+		mustPut(c, ms.trie, k, k)
+	}
+	sort.Strings(ms.keys)
+}
+
+func (ms *MatchSuites) TestMatch(c *check.C) {
+	for _, pattern := range []string{"", "*", "AB??3*", "ab??3", "?", "[0-3]?F*", "[!0-E]*", "A[BC]\\3", "FFFFF", "FFFFFF*", "[a-c][0F]?"} {
+		p, err := CompilePattern(HexAlphabet, pattern)
+		c.Assert(err, check.IsNil, check.Commentf("pattern %s", pattern))
+		var want, got []string
+		for _, k := range ms.keys {
+			if p.Match(k) {
+				want = append(want, k)
+			}
+		}
+		err = ms.trie.Match(pattern, func(key string, value interface{}) error {
+			c.Assert(value, check.Equals, key)
+			got = append(got, key)
+			return nil
+		})
+		c.Assert(err, check.IsNil)
+		c.Assert(got, check.DeepEquals, want, check.Commentf("pattern %s", pattern))
+	}
+
+	n := 0
+	err := ms.trie.Match("*", func(string, interface{}) error {
+		n++
+		return StopWalk
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(n, check.Equals, 1)
+}
+
+func (ms *MatchSuites) TestPattern(c *check.C) {
+	p, err := CompilePattern(HexAlphabet, "AB??3*")
+	c.Assert(err, check.IsNil)
+	c.Assert(p.Match("ab003"), check.Equals, true)
+	c.Assert(p.Match("AB00345"), check.Equals, true)
+	c.Assert(p.Match("AB004"), check.Equals, false)
+	c.Assert(p.Match("AB00"), check.Equals, false)
+	c.Assert(p.MatchPrefix("A"), check.Equals, true)
+	c.Assert(p.MatchPrefix("AB0"), check.Equals, true)
+	c.Assert(p.MatchPrefix("AC"), check.Equals, false)
+	c.Assert(p.MatchPrefix("AB0037"), check.Equals, true)
+
+	p, err = CompilePattern(HexAlphabet, "[!0-9a]?")
+	c.Assert(err, check.IsNil)
+	c.Assert(p.Match("B0"), check.Equals, true)
+	c.Assert(p.Match("A0"), check.Equals, false)
+	c.Assert(p.Match("50"), check.Equals, false)
+	c.Assert(p.MatchPrefix("B00"), check.Equals, false)
+
+	for pattern, pos := range map[string]int{"A*B": 1, "AX": 1, "[AB": 0, "[A-X]": 3, "[F-A]": 2, "A\\": 1} {
+		_, err := CompilePattern(HexAlphabet, pattern)
+		perr, ok := err.(*PatternError)
+		c.Assert(ok, check.Equals, true, check.Commentf("pattern %s", pattern))
+		c.Assert(perr.Pos, check.Equals, pos, check.Commentf("pattern %s", pattern))
+		c.Assert(strings.Contains(err.Error(), pattern), check.Equals, true)
+	}
+
+	err = ms.trie.Match("A[", func(string, interface{}) error { return nil })
+	c.Assert(err, check.FitsTypeOf, &PatternError{})
+	p, err = CompilePattern(Base32Alphabet, "A*")
+	c.Assert(err, check.IsNil)
+	err = ms.trie.MatchPattern(p, func(string, interface{}) error { return nil })
+	c.Assert(err, check.NotNil)
+}
@@ -0,0 +1,269 @@
+package suffix
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrNoHash is returned by Diff when a trie does not keep hashes.
+var ErrNoHash = errors.New("Trie keeps no hashes")
+
+// DiffFunc is called by Diff for every key whose value differs between two
+// tries. inA and inB tell whether each trie holds the key at all.
+type DiffFunc[V any] func(key string, a V, inA bool, b V, inB bool) error
+
+// EnableHash makes every node carry a SHA-256 hash of its subtree, built
+// from the labels and from hashValue of the values. The hashes of all
+// nodes are computed once here, afterwards Put and Delete only rehash the
+// path they change. Tries holding the same keys and values have the same
+// root hash whatever order they were written in.
+func (t *Trie[V]) EnableHash(hashValue func(V) []byte) error {
+	if t.readonly {
+		return ErrReadOnly
+	}
+	t.hashValue = hashValue
+	root, err := t.writableRoot()
+	if err == nil {
+		err = t.rehashAll(root)
+	}
+	if err != nil {
+		t.hashValue = nil
+	}
+	return err
+}
+
+func (t *Trie[V]) HashEnabled() bool {
+	return t.hashValue != nil
+}
+
+// RootHash returns the hash of the whole trie, or nil when it keeps none.
+func (t *Trie[V]) RootHash() []byte {
+	if t.hashValue == nil {
+		return nil
+	}
+	return append([]byte(nil), t.arena.hash(t.node(t.root))...)
+}
+
+// JoinedRootHash returns the root hash of one trie holding the keys of all
+// tries, which come in alphabet order and share no leading symbol, like the
+// stripes of a striped trie. Only the first may hold the empty key. It is
+// nil unless every trie keeps hashes.
+func JoinedRootHash[V any](tries ...*Trie[V]) []byte {
+	for _, t := range tries {
+		if t.hashValue == nil {
+			return nil
+		}
+	}
+	// the hash rehash would give a root with all the children.
+	h := sha256.New()
+	writeBytes(h, nil)
+	if root := tries[0].node(tries[0].root); root.has {
+		h.Write([]byte{1})
+		writeBytes(h, tries[0].hashValue(root.value))
+	} else {
+		h.Write([]byte{0})
+	}
+	for _, t := range tries {
+		for _, child := range t.children(t.node(t.root)) {
+			h.Write(t.arena.hash(t.node(child)))
+		}
+	}
+	return h.Sum(nil)
+}
+
+// Diff reports the keys whose values differ between a and b in alphabet
+// order. Subtrees with the same hash in both tries are skipped without
+// being visited, so the cost follows the size of the difference rather
+// than the size of the tries. Values are compared by the hash function of
+// a. A DiffFunc may return StopWalk to end the diff early.
+func Diff[V any](a, b *Trie[V], fn DiffFunc[V]) error {
+	if a.hashValue == nil || b.hashValue == nil {
+		return ErrNoHash
+	}
+	if a.alphabet != b.alphabet {
+		return fmt.Errorf("Cannot diff tries over alphabets %s and %s", a.alphabet.name, b.alphabet.name)
+	}
+	d := &differ[V]{a: a, b: b, fn: fn, onlyA: true, onlyB: true}
+	return walkResult(d.diff("", newCursor(a, a.node(a.root)), newCursor(b, b.node(b.root))))
+}
+
+// rehashPath rehashes the nodes of a path from the deepest one up.
+func (t *Trie[V]) rehashPath(path []*node[V]) {
+	if t.hashValue == nil {
+		return
+	}
+	for i := len(path) - 1; i >= 0; i-- {
+		t.rehash(path[i])
+	}
+}
+
+// rehashAll computes the hashes of the subtree of the writable node n,
+// copying the nodes a snapshot shares first.
+func (t *Trie[V]) rehashAll(n *node[V]) error {
+	for i := 0; i < int(n.children.len); i++ {
+		child, err := t.writableChild(n, i)
+		if err != nil {
+			return err
+		}
+		if err := t.rehashAll(child); err != nil {
+			return err
+		}
+	}
+	t.rehash(n)
+	return nil
+}
+
+// rehash computes the hash of the writable node n from the hashes of its
+// children, in the run of the hash pool n has to itself.
+func (t *Trie[V]) rehash(n *node[V]) {
+	if t.hashValue == nil {
+		return
+	}
+	a := t.arena
+	h := sha256.New()
+	writeBytes(h, a.labels.get(n.label))
+	if n.has {
+		h.Write([]byte{1})
+		writeBytes(h, t.hashValue(n.value))
+	} else {
+		h.Write([]byte{0})
+	}
+	for _, child := range t.children(n) {
+		h.Write(a.hash(t.node(child)))
+	}
+	if n.hash.class == 0 {
+		n.hash = a.hashes.alloc(1)
+	}
+	h.Sum(a.hashes.get(n.hash)[0][:0])
+}
+
+func writeBytes(w io.Writer, b []byte) {
+	var buf [binary.MaxVarintLen64]byte
+	w.Write(buf[:binary.PutUvarint(buf[:], uint64(len(b)))])
+	w.Write(b)
+}
+
+// cursor is a position inside the label of a node; label[off:] is what is
+// left of it.
+type cursor[V any] struct {
+	n     *node[V]
+	label string
+	off   int
+}
+
+func newCursor[V any](t *Trie[V], n *node[V]) cursor[V] {
+	return cursor[V]{n: n, label: t.label(n)}
+}
+
+func (c cursor[V]) rest() string {
+	return c.label[c.off:]
+}
+
+type differ[V any] struct {
+	a, b *Trie[V]
+	fn   DiffFunc[V]
+	// all reports every key held by both tries whatever the values and
+	// hashes; onlyA and onlyB report the keys held by one trie alone.
+	all          bool
+	onlyA, onlyB bool
+}
+
+// report calls fn unless the key is left out.
+func (d *differ[V]) report(key string, a V, inA bool, b V, inB bool) error {
+	if (inA && !inB && !d.onlyA) || (inB && !inA && !d.onlyB) || (!inA && !inB) {
+		return nil
+	}
+	return d.fn(key, a, inA, b, inB)
+}
+
+// diff compares the subtrees below two cursors reached by the same key.
+func (d *differ[V]) diff(key string, x, y cursor[V]) error {
+	if !d.all && x.off == 0 && y.off == 0 && bytes.Equal(d.a.arena.hash(x.n), d.b.arena.hash(y.n)) {
+		return nil
+	}
+	lx, ly := x.rest(), y.rest()
+	common := commonPrefix(lx, ly)
+	key = extend(key, lx[:common])
+	x.off += common
+	y.off += common
+
+	switch {
+	case common < len(lx) && common < len(ly):
+		// the labels part here, no key is in both subtrees.
+		return d.children(key, []cursor[V]{x}, []cursor[V]{y})
+	case common == len(lx) && common == len(ly):
+		a, b := x.n, y.n
+		differs := a.has != b.has ||
+			(a.has && (d.all || !bytes.Equal(d.a.hashValue(a.value), d.a.hashValue(b.value))))
+		if differs {
+			if err := d.report(key, a.value, a.has, b.value, b.has); err != nil {
+				return err
+			}
+		}
+		return d.children(key, childCursors(d.a, a), childCursors(d.b, b))
+	case common == len(lx):
+		// y goes on inside its label and holds no key here.
+		var zero V
+		if err := d.report(key, x.n.value, x.n.has, zero, false); err != nil {
+			return err
+		}
+		return d.children(key, childCursors(d.a, x.n), []cursor[V]{y})
+	default:
+		var zero V
+		if err := d.report(key, zero, false, y.n.value, y.n.has); err != nil {
+			return err
+		}
+		return d.children(key, []cursor[V]{x}, childCursors(d.b, y.n))
+	}
+}
+
+// children merges two lists of cursors sorted by their next symbol,
+// diffing the pairs that share one.
+func (d *differ[V]) children(key string, xs, ys []cursor[V]) error {
+	index := &d.a.alphabet.index
+	for len(xs) > 0 || len(ys) > 0 {
+		var err error
+		switch {
+		case len(ys) == 0 || (len(xs) > 0 && index[xs[0].rest()[0]] < index[ys[0].rest()[0]]):
+			err = d.only(key, d.a, xs[0], true)
+			xs = xs[1:]
+		case len(xs) == 0 || index[ys[0].rest()[0]] < index[xs[0].rest()[0]]:
+			err = d.only(key, d.b, ys[0], false)
+			ys = ys[1:]
+		default:
+			err = d.diff(key, xs[0], ys[0])
+			xs, ys = xs[1:], ys[1:]
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// only reports every key below a cursor as held by one trie alone.
+func (d *differ[V]) only(key string, t *Trie[V], c cursor[V], inA bool) error {
+	if (inA && !d.onlyA) || (!inA && !d.onlyB) {
+		return nil
+	}
+	var zero V
+	return t.walk(c.n, key[:len(key)-c.off], func(key string, value V) error {
+		if inA {
+			return d.fn(key, value, true, zero, false)
+		}
+		return d.fn(key, zero, false, value, true)
+	})
+}
+
+func childCursors[V any](t *Trie[V], n *node[V]) []cursor[V] {
+	children := t.children(n)
+	cs := make([]cursor[V], len(children))
+	for i, child := range children {
+		cs[i] = newCursor(t, t.node(child))
+	}
+	return cs
+}
@@ -0,0 +1,161 @@
+package suffix
+
+import (
+	"math/rand"
+	"sort"
+
+	"gopkg.in/check.v1"
+	"trie/lib/util"
+)
+
+var _ = check.Suite(&MerkleSuites{})
+
+type MerkleSuites struct {
+	keys []string
+}
+
+type diffEntry struct {
+	key      string
+	a, b     int
+	inA, inB bool
+}
+
+func hashInt(v int) []byte {
+	return []byte{byte(v >> 8), byte(v)}
+}
+
+func (ms *MerkleSuites) SetUpTest(c *check.C) {
+	rand := &util.RandString{
+		Sets: "0123456789ABCDEF",
+		Len:  5,
+	}
+	seen := map[string]bool{"A": true, "AB": true, "ABC": true}
+	for len(seen) < 2000 {
+		seen[rand.String()] = true
+	}
+	ms.keys = ms.keys[:0]
+	for k := range seen {
+		ms.keys = append(ms.keys, k)
+	}
+	sort.Strings(ms.keys)
+}
+
+func (ms *MerkleSuites) build(c *check.C, keys []string) *Trie[int] {
+	t := NewTrie[int](HexAlphabet)
+	c.Assert(t.EnableHash(hashInt), check.IsNil)
+	for i, k := range keys {
+		_, err := t.Put(k, i)
+		c.Assert(err, check.IsNil)
+	}
+	return t
+}
+
+func diffAll(c *check.C, a, b *Trie[int]) []diffEntry {
+	var entries []diffEntry
+	err := Diff(a, b, func(key string, va int, inA bool, vb int, inB bool) error {
+		entries = append(entries, diffEntry{key, va, vb, inA, inB})
+		return nil
+	})
+	c.Assert(err, check.IsNil)
+	return entries
+}
+
+func (ms *MerkleSuites) TestRootHash(c *check.C) {
+	a := ms.build(c, ms.keys)
+
+	// the same keys put in another order and with detours give the same hash.
+	b := NewTrie[int](HexAlphabet)
+	c.Assert(b.EnableHash(hashInt), check.IsNil)
+	for _, i := range rand.Perm(len(ms.keys)) {
+		_, err := b.Put(ms.keys[i]+"0", 0)
+		c.Assert(err, check.IsNil)
+		_, err = b.Put(ms.keys[i], i)
+		c.Assert(err, check.IsNil)
+	}
+	c.Assert(a.RootHash(), check.Not(check.DeepEquals), b.RootHash())
+	for _, k := range ms.keys {
+		if _, ok, _ := a.Get(k + "0"); !ok {
+			_, err := b.Delete(k + "0")
+			c.Assert(err, check.IsNil)
+		}
+	}
+	c.Assert(a.RootHash(), check.DeepEquals, b.RootHash())
+
+	// enabling hashes on a filled trie gives the same result.
+	d := NewTrie[int](HexAlphabet)
+	for i, k := range ms.keys {
+		_, err := d.Put(k, i)
+		c.Assert(err, check.IsNil)
+	}
+	c.Assert(d.RootHash(), check.IsNil)
+	c.Assert(d.EnableHash(hashInt), check.IsNil)
+	c.Assert(d.RootHash(), check.DeepEquals, a.RootHash())
+
+	_, err := d.Put(ms.keys[0], -1)
+	c.Assert(err, check.IsNil)
+	c.Assert(d.RootHash(), check.Not(check.DeepEquals), a.RootHash())
+}
+
+func (ms *MerkleSuites) TestDiff(c *check.C) {
+	a := ms.build(c, ms.keys)
+	b := ms.build(c, ms.keys)
+	c.Assert(diffAll(c, a, b), check.HasLen, 0)
+
+	snap := b.Snapshot()
+	want := map[string]diffEntry{}
+	for i, k := range ms.keys {
+		switch i % 97 {
+		case 0:
+			_, err := b.Delete(k)
+			c.Assert(err, check.IsNil)
+			want[k] = diffEntry{k, i, 0, true, false}
+		case 1:
+			_, err := b.Put(k, -i)
+			c.Assert(err, check.IsNil)
+			want[k] = diffEntry{k, i, -i, true, true}
+		case 2:
+			// longer keys split the labels of b only.
+			for _, extra := range []string{k[:len(k)-1] + "F0", k + "1"} {
+				if _, ok, _ := a.Get(extra); ok {
+					continue
+				}
+				_, err := b.Put(extra, 7)
+				c.Assert(err, check.IsNil)
+				want[extra] = diffEntry{extra, 0, 7, false, true}
+			}
+		}
+	}
+
+	entries := diffAll(c, a, b)
+	c.Assert(len(entries), check.Equals, len(want))
+	for i, e := range entries {
+		c.Assert(e, check.Equals, want[e.key])
+		if i > 0 {
+			c.Assert(entries[i-1].key < e.key, check.Equals, true)
+		}
+	}
+
+	// the other way round swaps the sides, and the snapshot kept its hashes.
+	reverse := diffAll(c, b, a)
+	c.Assert(len(reverse), check.Equals, len(entries))
+	c.Assert(reverse[0].inA, check.Equals, entries[0].inB)
+	c.Assert(diffAll(c, a, snap), check.HasLen, 0)
+
+	n := 0
+	err := Diff(a, b, func(string, int, bool, int, bool) error {
+		n++
+		return StopWalk
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(n, check.Equals, 1)
+}
+
+func (ms *MerkleSuites) TestDiffWithoutHash(c *check.C) {
+	a := ms.build(c, ms.keys[:10])
+	b := NewTrie[int](HexAlphabet)
+	err := Diff(a, b, func(string, int, bool, int, bool) error {
+		return nil
+	})
+	c.Assert(err, check.Equals, ErrNoHash)
+	c.Assert(a.Snapshot().EnableHash(hashInt), check.Equals, ErrReadOnly)
+}
@@ -0,0 +1,88 @@
+package suffix
+
+import (
+	"fmt"
+)
+
+// MergeFunc picks the value of a key held by both tries of a Union.
+type MergeFunc[V any] func(key string, a, b V) V
+
+// Union returns a new trie with the keys of a and b. Keys held by both
+// get the value of merge, or the value of b when merge is nil.
+func Union[V any](a, b *Trie[V], merge MergeFunc[V]) (*Trie[V], error) {
+	return combine(a, b, true, true, unionPick(merge))
+}
+
+// UnionInto adds the keys of Union(a, b, merge) to builder in order, so the
+// union is built straight into the trie of builder without a trie in
+// between. That trie must be neither a nor b.
+func UnionInto[V any](builder *Builder[V], a, b *Trie[V], merge MergeFunc[V]) error {
+	if a.alphabet != b.alphabet {
+		return fmt.Errorf("Cannot combine tries over alphabets %s and %s", a.alphabet.name, b.alphabet.name)
+	}
+	return combineInto(builder, a, b, true, true, unionPick(merge))
+}
+
+func unionPick[V any](merge MergeFunc[V]) func(key string, va V, inA bool, vb V, inB bool) (V, bool) {
+	return func(key string, va V, inA bool, vb V, inB bool) (V, bool) {
+		switch {
+		case !inB:
+			return va, true
+		case !inA || merge == nil:
+			return vb, true
+		}
+		return merge(key, va, vb), true
+	}
+}
+
+// Difference returns a new trie with the keys of a that b does not hold.
+func Difference[V any](a, b *Trie[V]) (*Trie[V], error) {
+	return combine(a, b, true, false, func(key string, va V, inA bool, vb V, inB bool) (V, bool) {
+		return va, !inB
+	})
+}
+
+// Intersection returns a new trie with the keys held by both a and b, with
+// their values in a.
+func Intersection[V any](a, b *Trie[V]) (*Trie[V], error) {
+	return combine(a, b, false, false, func(key string, va V, inA bool, vb V, inB bool) (V, bool) {
+		return va, inA && inB
+	})
+}
+
+// combine walks a and b in lockstep and builds the keys pick keeps in one
+// sorted pass. Subtrees held by a or b alone are not visited unless onlyA
+// or onlyB asks for them. The result keeps hashes when a does.
+func combine[V any](a, b *Trie[V], onlyA, onlyB bool, pick func(key string, va V, inA bool, vb V, inB bool) (V, bool)) (*Trie[V], error) {
+	if a.alphabet != b.alphabet {
+		return nil, fmt.Errorf("Cannot combine tries over alphabets %s and %s", a.alphabet.name, b.alphabet.name)
+	}
+	t := NewTrie[V](a.alphabet)
+	if a.hashValue != nil {
+		t.EnableHash(a.hashValue)
+	}
+	builder, err := NewBuilder(t)
+	if err != nil {
+		return nil, err
+	}
+	err = combineInto(builder, a, b, onlyA, onlyB, pick)
+	builder.Finish()
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// combineInto adds the keys pick keeps to builder, see combine.
+func combineInto[V any](builder *Builder[V], a, b *Trie[V], onlyA, onlyB bool, pick func(key string, va V, inA bool, vb V, inB bool) (V, bool)) error {
+	d := &differ[V]{
+		a: a, b: b, all: true, onlyA: onlyA, onlyB: onlyB,
+		fn: func(key string, va V, inA bool, vb V, inB bool) error {
+			if value, ok := pick(key, va, inA, vb, inB); ok {
+				return builder.Add(key, value)
+			}
+			return nil
+		},
+	}
+	return d.diff("", newCursor(a, a.node(a.root)), newCursor(b, b.node(b.root)))
+}
@@ -0,0 +1,133 @@
+package suffix
+
+import (
+	"fmt"
+	"math/rand"
+
+	"gopkg.in/check.v1"
+)
+
+var _ = check.Suite(&SetOpsSuites{})
+
+type SetOpsSuites struct {
+}
+
+func randomMap(num int) map[string]int {
+	m := make(map[string]int, num)
+	for i := 0; len(m) < num; i++ {
+		// keys that are prefixes of others end inside labels.
+		m[fmt.Sprintf("%04X", rand.Intn(1<<16))[:2+i%3]] = i
+	}
+	return m
+}
+
+func trieOf(c *check.C, m map[string]int) *Trie[int] {
+	t := NewTrie[int](HexAlphabet)
+	for k, v := range m {
+		_, err := t.Put(k, v)
+		c.Assert(err, check.IsNil)
+	}
+	return t
+}
+
+func mapOf(c *check.C, t *Trie[int]) map[string]int {
+	m := make(map[string]int)
+	last := ""
+	err := t.Walk(func(key string, v int) error {
+		c.Assert(key > last || last == "", check.Equals, true)
+		last = key
+		m[key] = v
+		return nil
+	})
+	c.Assert(err, check.IsNil)
+	return m
+}
+
+func (ss *SetOpsSuites) TestSetOps(c *check.C) {
+	for round := 0; round < 5; round++ {
+		ma, mb := randomMap(300+rand.Intn(300)), randomMap(300+rand.Intn(300))
+		a, b := trieOf(c, ma), trieOf(c, mb)
+
+		union := make(map[string]int)
+		diff := make(map[string]int)
+		inter := make(map[string]int)
+		for k, v := range ma {
+			union[k] = v
+			if w, ok := mb[k]; ok {
+				union[k] = v + w
+				inter[k] = v
+			} else {
+				diff[k] = v
+			}
+		}
+		for k, v := range mb {
+			if _, ok := ma[k]; !ok {
+				union[k] = v
+			}
+		}
+
+		u, err := Union(a, b, func(key string, x, y int) int { return x + y })
+		c.Assert(err, check.IsNil)
+		c.Assert(mapOf(c, u), check.DeepEquals, union)
+		c.Assert(u.Len(), check.Equals, len(union))
+		checkCounts(c, u, u.node(u.root))
+
+		d, err := Difference(a, b)
+		c.Assert(err, check.IsNil)
+		c.Assert(mapOf(c, d), check.DeepEquals, diff)
+
+		i, err := Intersection(a, b)
+		c.Assert(err, check.IsNil)
+		c.Assert(mapOf(c, i), check.DeepEquals, inter)
+		c.Assert(i.Len(), check.Equals, len(inter))
+	}
+}
+
+func (ss *SetOpsSuites) TestSetOpsEdges(c *check.C) {
+	empty := NewTrie[int](HexAlphabet)
+	a := trieOf(c, map[string]int{"A": 1, "AB": 2, "ABC": 3})
+
+	u, err := Union(empty, a, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(mapOf(c, u), check.DeepEquals, map[string]int{"A": 1, "AB": 2, "ABC": 3})
+	d, err := Difference(a, a)
+	c.Assert(err, check.IsNil)
+	c.Assert(d.Len(), check.Equals, 0)
+	i, err := Intersection(a, empty)
+	c.Assert(err, check.IsNil)
+	c.Assert(i.Len(), check.Equals, 0)
+
+	// the result keeps the hashes of a and matches a trie built by Put.
+	c.Assert(a.EnableHash(hashInt), check.IsNil)
+	b := trieOf(c, map[string]int{"AB": 5, "F0": 6})
+	u, err = Union(a, b, nil)
+	c.Assert(err, check.IsNil)
+	want := trieOf(c, map[string]int{"A": 1, "AB": 5, "ABC": 3, "F0": 6})
+	c.Assert(want.EnableHash(hashInt), check.IsNil)
+	c.Assert(u.RootHash(), check.DeepEquals, want.RootHash())
+
+	// snapshots may be combined while the trie goes on.
+	snap := a.Snapshot()
+	_, err = a.Put("0", 0)
+	c.Assert(err, check.IsNil)
+	d, err = Difference(a, snap)
+	c.Assert(err, check.IsNil)
+	c.Assert(mapOf(c, d), check.DeepEquals, map[string]int{"0": 0})
+	snap.Release()
+
+	_, err = Union(a, NewTrie[int](ByteAlphabet), nil)
+	c.Assert(err, check.NotNil)
+
+	// a union built back into a, which keeps its hashes.
+	snap = a.Snapshot()
+	FreeTrie(a)
+	builder, err := NewBuilder(a)
+	c.Assert(err, check.IsNil)
+	c.Assert(UnionInto(builder, snap, b, nil), check.IsNil)
+	builder.Finish()
+	snap.Release()
+	c.Assert(mapOf(c, a), check.DeepEquals, map[string]int{"0": 0, "A": 1, "AB": 5, "ABC": 3, "F0": 6})
+	_, err = want.Put("0", 0)
+	c.Assert(err, check.IsNil)
+	c.Assert(a.RootHash(), check.DeepEquals, want.RootHash())
+}
@@ -1,170 +1,571 @@
 package suffix
 
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+)
+
 var (
-	sets         = "0123456789ABCDEF"
-	num_children = 16
+	// SkipSubtree returned by a WalkFunc skips the keys extending the
+	// current one.
+	SkipSubtree = errors.New("skip this subtree")
+	// StopWalk returned by a WalkFunc ends the walk without an error.
+	StopWalk = errors.New("stop the walk")
+	// ErrReadOnly is returned when writing to a snapshot.
+	ErrReadOnly = errors.New("Trie is read only")
+	// ErrTooManyNodes is returned by writes needing a node once the arena
+	// of a trie has handed out all it can address.
+	ErrTooManyNodes = errors.New("Trie has too many nodes")
 )
 
-type WalkFunc func(key string, value interface{}) error
+// WalkFunc is called for every key of a walk. Any error other than
+// SkipSubtree aborts the walk and, unless it is StopWalk, is returned by
+// the walk.
+type WalkFunc[V any] func(key string, value V) error
 
-type Trie struct {
-	parent   *Trie
-	children []*Trie
-	value    interface{}
-	childIdx uint16
-	childNum uint16
+// Trie is a radix tree over the keys of an Alphabet, mapping them to
+// values of type V. Its nodes live in an arena, see arena.
+type Trie[V any] struct {
+	alphabet *Alphabet
+	arena    *arena[V]
+	root     nodeRef
+	// version changes on every write, so iterators know when to find
+	// their place again.
+	version uint64
+	// gen is the generation of the nodes this trie may change in place.
+	// The first write after a snapshot starts a new one, leaving the older
+	// nodes shared; shared tells a snapshot reads gen.
+	gen      uint64
+	shared   atomic.Bool
+	readonly bool
+	// token releases the generation of a snapshot, see Release.
+	token *snapshotToken
+	// hashValue is set once hashing is enabled, see EnableHash.
+	hashValue func(V) []byte
 }
 
-func (t *Trie) Get(key string) interface{} {
-	node := t
-	lkey := len(key)
-	for i := 0; i < lkey; i++ {
-		node = node.children[getIdx(key[i])]
-		if node == nil {
-			return nil
-		}
+// node is a radix tree node: chains of single-child nodes are collapsed
+// into one node whose label holds the whole run of characters from its
+// parent. Labels are kept in the canonical symbols of the alphabet and the
+// root always has an empty label. The label, children and hash are runs
+// of the pools of the arena.
+type node[V any] struct {
+	label    run
+	children run
+	value    V
+	// has tells a stored zero value from a node on the way to longer keys.
+	has bool
+	// count is the number of keys in the subtree, this node included.
+	count int
+	gen   uint64
+	// hash covers the label, value and children of the node, it is no
+	// run unless the trie keeps hashes.
+	hash run
+}
+
+func (t *Trie[V]) Alphabet() *Alphabet {
+	return t.alphabet
+}
+
+// Get returns the value of key and whether the key is in the trie.
+func (t *Trie[V]) Get(key string) (V, bool, error) {
+	var value V
+	key, err := t.alphabet.canonical(key)
+	if err != nil {
+		return value, false, err
 	}
+	value, ok := t.get(key)
+	return value, ok, nil
+}
 
-	return node.value
+// get looks up a canonical key.
+func (t *Trie[V]) get(key string) (V, bool) {
+	if n := t.lookup(key); n != nil && n.has {
+		return n.value, true
+	}
+	var value V
+	return value, false
 }
 
-func (t *Trie) Put(key string, value interface{}) bool {
-	node := t
-	lkey := len(key)
-	for i := 0; i < lkey; i++ {
-		pos := getIdx(key[i])
-		child := node.children[pos]
+func (t *Trie[V]) Put(key string, value V) (bool, error) {
+	key, err := t.alphabet.canonical(key)
+	if err != nil {
+		return false, err
+	}
+	return t.put(key, value)
+}
+
+// put stores value under a canonical key, which it does not keep: the
+// labels are copied into the arena.
+func (t *Trie[V]) put(key string, value V) (bool, error) {
+	if t.readonly {
+		return false, ErrReadOnly
+	}
+	t.version++
+	// the nodes above a new key count it once the key turns out new.
+	var pathBuf [16]*node[V]
+	path := pathBuf[:0]
+	n, err := t.writableRoot()
+	if err != nil {
+		return false, err
+	}
+	for len(key) > 0 {
+		path = append(path, n)
+		pos, child := t.findChild(n, key[0])
 		if child == nil {
-			child = NewTrie()
-			child.parent = node
-			child.childIdx = uint16(pos)
-			node.children[pos] = child
-			node.childNum++
+			ref, leaf, err := t.newNode(key)
+			if err != nil {
+				return false, err
+			}
+			leaf.value = value
+			leaf.has = true
+			leaf.count = 1
+			t.insertChild(n, pos, ref)
+			countNew(path)
+			t.rehash(leaf)
+			t.rehashPath(path)
+			return true, nil
+		}
+		if child, err = t.writableChild(n, pos); err != nil {
+			return false, err
+		}
+		label := t.label(child)
+		common := commonPrefix(key, label)
+		if common < len(label) {
+			mid, err := t.splitChild(n, pos, common)
+			if err != nil {
+				return false, err
+			}
+			t.rehash(child)
+			child = mid
 		}
-		node = child
+		key = key[common:]
+		n = child
 	}
 
-	isNew := (node.value == nil)
-	node.value = value
-	return isNew
+	isNew := !n.has
+	n.value = value
+	n.has = true
+	if isNew {
+		n.count++
+		countNew(path)
+	}
+	t.rehashPath(append(path, n))
+	return isNew, nil
 }
 
-func (t *Trie) Delete(key string) bool {
-	node := t
-	lkey := len(key)
-	for i := 0; i < lkey; i++ {
-		node = node.children[getIdx(key[i])]
-		if node == nil {
-			return false
-		}
+func countNew[V any](path []*node[V]) {
+	for _, n := range path {
+		n.count++
+	}
+}
+
+func (t *Trie[V]) Delete(key string) (bool, error) {
+	key, err := t.alphabet.canonical(key)
+	if err != nil {
+		return false, err
 	}
+	return t.delete(key)
+}
 
-	node.value = nil
+// delete removes a canonical key.
+func (t *Trie[V]) delete(key string) (bool, error) {
+	if t.readonly {
+		return false, ErrReadOnly
+	}
+	if n := t.lookup(key); n == nil || !n.has {
+		return false, nil
+	}
+
+	// the key exists, walk its path again copying shared nodes. The counts
+	// change once the whole path is writable.
+	var pathBuf [16]*node[V]
+	var parent *node[V]
+	pos := 0
+	node, err := t.writableRoot()
+	if err != nil {
+		return false, err
+	}
+	path := append(pathBuf[:0], node)
+	for len(key) > 0 {
+		idx, _ := t.findChild(node, key[0])
+		child, err := t.writableChild(node, idx)
+		if err != nil {
+			return false, err
+		}
+		key = key[child.label.len:]
+		parent, pos, node = node, idx, child
+		path = append(path, node)
+	}
+	for _, n := range path {
+		n.count--
+	}
+	node.clearValue()
+	t.version++
 
-	if node.isLeaf() {
-		for i := lkey - 1; i >= 0; i-- {
-			childIdx := node.childIdx
-			node = node.parent
-			node.children[childIdx] = nil
-			node.childNum--
-			if node.value != nil || !node.isLeaf() {
-				break
+	// the root keeps its empty label and is never pruned or merged.
+	if parent != nil {
+		switch node.children.len {
+		case 0:
+			t.removeChild(parent, pos)
+			path = path[:len(path)-1]
+			if parent != path[0] && !parent.has && parent.children.len == 1 {
+				t.mergeChild(parent)
 			}
+		case 1:
+			t.mergeChild(node)
 		}
 	}
+	t.rehashPath(path)
 
-	return true
+	return true, nil
 }
 
-func (t *Trie) Walk(walker WalkFunc) error {
-	return t.walk("", walker)
+// Snapshot returns a read-only view of the trie as it is now. Writes to t
+// made afterwards copy the nodes they touch instead of changing them, so
+// the view stays the same without holding any lock. Values are shared
+// between the two and must not be modified in place. The snapshot and
+// its iterators may be used until it is released with Release, which the
+// owner of the snapshot must call. Snapshot only reads t, so it may run
+// along with readers and other snapshots, not with writes. The snapshots
+// taken between two writes share one generation.
+func (t *Trie[V]) Snapshot() *Trie[V] {
+	if t.readonly {
+		return t
+	}
+	snap := &Trie[V]{
+		alphabet:  t.alphabet,
+		root:      t.root,
+		version:   t.version,
+		gen:       t.gen,
+		readonly:  true,
+		hashValue: t.hashValue,
+	}
+	snap.arena = t.arena.view(snap, t.gen)
+	t.shared.Store(true)
+	return snap
 }
 
-func (t *Trie) walk(key string, walker WalkFunc) error {
-	if t.value != nil {
-		walker(key, t.value)
+// Release tells the trie that a snapshot is no longer used, so the nodes
+// only it could read are reused by the writes to come. A released
+// snapshot must not be used. Until then the writes keep every node it can
+// read. From Go 1.24 on the garbage collector releases a snapshot dropped
+// without Release, as a backstop against leaks only.
+func (t *Trie[V]) Release() {
+	if t.token != nil {
+		t.token.release()
 	}
-	for i, child := range t.children {
+}
+
+func (t *Trie[V]) ReadOnly() bool {
+	return t.readonly
+}
+
+func (t *Trie[V]) Walk(walker WalkFunc[V]) error {
+	return walkResult(t.walk(t.node(t.root), "", walker))
+}
+
+// WalkPrefix walks the keys starting with prefix in alphabet order.
+func (t *Trie[V]) WalkPrefix(prefix string, walker WalkFunc[V]) error {
+	prefix, err := t.alphabet.canonical(prefix)
+	if err != nil {
+		return err
+	}
+	n, key := t.findPrefix(prefix)
+	if n == nil {
+		return nil
+	}
+	return walkResult(t.walk(n, key, walker))
+}
+
+// findPrefix returns the node whose subtree holds the keys starting with
+// prefix, and the key leading to that node without its own label.
+func (t *Trie[V]) findPrefix(prefix string) (*node[V], string) {
+	n := t.node(t.root)
+	rest := prefix
+	for len(rest) > 0 {
+		_, child := t.findChild(n, rest[0])
 		if child == nil {
-			continue
+			return nil, ""
 		}
-		if err := child.walk(key+string(sets[i]), walker); err != nil {
+		label := t.label(child)
+		if len(rest) <= len(label) {
+			if !strings.HasPrefix(label, rest) {
+				return nil, ""
+			}
+			return child, prefix[:len(prefix)-len(rest)]
+		}
+		if !strings.HasPrefix(rest, label) {
+			return nil, ""
+		}
+		rest = rest[len(label):]
+		n = child
+	}
+	return n, prefix[:len(prefix)-int(n.label.len)]
+}
+
+func (t *Trie[V]) walk(n *node[V], key string, walker WalkFunc[V]) error {
+	key = extend(key, t.label(n))
+	if n.has {
+		if err := walker(key, n.value); err != nil {
+			if err == SkipSubtree {
+				return nil
+			}
+			return err
+		}
+	}
+	for _, child := range t.children(n) {
+		if err := t.walk(t.node(child), key, walker); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func (t *Trie) isLeaf() bool {
-	return t.childNum == 0
-}
-
-func getIdx(b byte) uint8 {
-	switch b {
-	case 48:
-		return 0
-	case 49:
-		return 1
-	case 50:
-		return 2
-	case 51:
-		return 3
-	case 52:
-		return 4
-	case 53:
-		return 5
-	case 54:
-		return 6
-	case 55:
-		return 7
-	case 56:
-		return 8
-	case 57:
-		return 9
-	case 65:
-		return 10
-	case 66:
-		return 11
-	case 67:
-		return 12
-	case 68:
-		return 13
-	case 69:
-		return 14
-	case 70:
-		return 15
-	default:
-		return 16
-	}
-}
-
-func NewTrie() *Trie {
-	return &Trie{
-		parent:   nil,
-		children: make([]*Trie, num_children),
-		value:    nil,
-		childIdx: uint16(0),
-		childNum: uint16(0),
-	}
-}
-
-func FreeTrie(t *Trie) {
-	for i := 0; i < num_children; i++ {
-		if t.children[i] == nil {
-			continue
-		}
-		FreeTrie(t.children[i])
-		t.children[i].parent = nil
-		t.children[i].children = nil
-		t.children[i].value = nil
-		t.children[i] = nil
-	}
-}
-
-func InitSets() {
-	/*bs := []byte(sets)
-	idx = make(map[byte]uint8)
-	for i, b := range bs {
-		idx[b] = uint8(i)
-	}*/
+func walkResult(err error) error {
+	if err == StopWalk {
+		return nil
+	}
+	return err
+}
+
+func (t *Trie[V]) node(ref nodeRef) *node[V] {
+	return t.arena.node(ref)
+}
+
+func (t *Trie[V]) label(n *node[V]) string {
+	return t.arena.label(n)
+}
+
+func (t *Trie[V]) children(n *node[V]) []nodeRef {
+	return t.arena.lists.get(n.children)
+}
+
+// extend returns key followed by label in a new string. Labels are views
+// of the arena, which must not end up in the keys handed out.
+func extend(key, label string) string {
+	var b strings.Builder
+	b.Grow(len(key) + len(label))
+	b.WriteString(key)
+	b.WriteString(label)
+	return b.String()
+}
+
+// lookup returns the node of a canonical key, which may hold no value.
+func (t *Trie[V]) lookup(key string) *node[V] {
+	n := t.node(t.root)
+	for len(key) > 0 {
+		_, child := t.findChild(n, key[0])
+		if child == nil || !strings.HasPrefix(key, t.label(child)) {
+			return nil
+		}
+		key = key[child.label.len:]
+		n = child
+	}
+	return n
+}
+
+// findChild returns the child of n whose label starts with b, or the
+// position such a child would be inserted at to keep the children in
+// alphabet order.
+func (t *Trie[V]) findChild(n *node[V], b byte) (int, *node[V]) {
+	idx := t.alphabet.index[b]
+	children := t.children(n)
+	for i, ref := range children {
+		child := t.node(ref)
+		cidx := t.alphabet.index[t.arena.labels.get(child.label)[0]]
+		if cidx == idx {
+			return i, child
+		}
+		if cidx > idx {
+			return i, nil
+		}
+	}
+	return len(children), nil
+}
+
+// newNode allocates a node of the current generation with a copy of label.
+func (t *Trie[V]) newNode(label string) (nodeRef, *node[V], error) {
+	ref, err := t.arena.alloc()
+	if err != nil {
+		return 0, nil, err
+	}
+	n := t.node(ref)
+	t.arena.setLabel(n, label)
+	n.gen = t.gen
+	return ref, n, nil
+}
+
+// writableRoot returns the root, copied first if a snapshot shares it.
+// Every write starts here, so it also starts a new generation when a
+// snapshot reads the current one.
+func (t *Trie[V]) writableRoot() (*node[V], error) {
+	if t.shared.Load() {
+		t.shared.Store(false)
+		t.gen++
+	}
+	if t.node(t.root).gen != t.gen {
+		ref, err := t.clone(t.root)
+		if err != nil {
+			return nil, err
+		}
+		t.root = ref
+	}
+	return t.node(t.root), nil
+}
+
+// writableChild returns the child at pos of the writable node n, copied
+// first if a snapshot shares it.
+func (t *Trie[V]) writableChild(n *node[V], pos int) (*node[V], error) {
+	ref := t.children(n)[pos]
+	if t.node(ref).gen != t.gen {
+		cref, err := t.clone(ref)
+		if err != nil {
+			return nil, err
+		}
+		ref = cref
+		t.children(n)[pos] = ref
+	}
+	return t.node(ref), nil
+}
+
+// clone copies a node shared with a snapshot, which retires it.
+func (t *Trie[V]) clone(ref nodeRef) (nodeRef, error) {
+	n := t.node(ref)
+	cref, c, err := t.newNode(t.label(n))
+	if err != nil {
+		return 0, err
+	}
+	a := t.arena
+	c.children = a.lists.alloc(int(n.children.len))
+	copy(a.lists.get(c.children), a.lists.get(n.children))
+	c.value = n.value
+	c.has = n.has
+	c.count = n.count
+	if n.hash.class != 0 {
+		c.hash = a.hashes.alloc(1)
+		a.hashes.get(c.hash)[0] = a.hashes.get(n.hash)[0]
+	}
+	a.retire(ref, t.gen)
+	return cref, nil
+}
+
+// drop gives back a node taken out of the trie.
+func (t *Trie[V]) drop(ref nodeRef) {
+	if t.node(ref).gen == t.gen {
+		t.arena.release(ref)
+		return
+	}
+	t.arena.retire(ref, t.gen)
+}
+
+func (n *node[V]) clearValue() {
+	var zero V
+	n.value = zero
+	n.has = false
+}
+
+func (t *Trie[V]) insertChild(n *node[V], pos int, ref nodeRef) {
+	lists := &t.arena.lists
+	if int(n.children.len) < n.children.cap() {
+		n.children.len++
+		children := lists.get(n.children)
+		copy(children[pos+1:], children[pos:])
+		children[pos] = ref
+		return
+	}
+	old := n.children
+	n.children = lists.alloc(int(old.len) + 1)
+	children, prev := lists.get(n.children), lists.get(old)
+	copy(children, prev[:pos])
+	children[pos] = ref
+	copy(children[pos+1:], prev[pos:])
+	lists.release(old)
+}
+
+func (t *Trie[V]) removeChild(n *node[V], pos int) {
+	children := t.children(n)
+	ref := children[pos]
+	copy(children[pos:], children[pos+1:])
+	n.children.len--
+	if n.children.len == 0 {
+		t.arena.lists.release(n.children)
+		n.children = run{}
+	}
+	t.drop(ref)
+}
+
+// splitChild cuts the label of the writable child at pos of n after l
+// characters and puts a new node holding the common part in its place.
+func (t *Trie[V]) splitChild(n *node[V], pos, l int) (*node[V], error) {
+	ref := t.children(n)[pos]
+	child := t.node(ref)
+	mref, mid, err := t.newNode(t.label(child)[:l])
+	if err != nil {
+		return nil, err
+	}
+	mid.children = t.arena.lists.alloc(1)
+	t.children(mid)[0] = ref
+	mid.count = child.count
+	t.arena.setLabel(child, t.label(child)[l:])
+	t.children(n)[pos] = mref
+	return mid, nil
+}
+
+// mergeChild folds the only child of a valueless writable node into it. A
+// child shared with a snapshot is left as it is.
+func (t *Trie[V]) mergeChild(n *node[V]) {
+	a := t.arena
+	ref := t.children(n)[0]
+	child := t.node(ref)
+	label := n.label
+	n.label = a.labels.alloc(int(label.len + child.label.len))
+	joined := a.labels.get(n.label)
+	copy(joined, a.labels.get(label))
+	copy(joined[label.len:], a.labels.get(child.label))
+	a.labels.release(label)
+	n.value, n.has = child.value, child.has
+	a.lists.release(n.children)
+	if child.gen != t.gen {
+		n.children = a.lists.alloc(int(child.children.len))
+		copy(a.lists.get(n.children), a.lists.get(child.children))
+	} else {
+		n.children = child.children
+		child.children = run{}
+	}
+	t.drop(ref)
+}
+
+func NewTrie[V any](alphabet *Alphabet) *Trie[V] {
+	t := &Trie[V]{
+		alphabet: alphabet,
+		arena:    newArena[V](),
+	}
+	// the first node of a new arena always fits.
+	t.root, _, _ = t.newNode("")
+	return t
+}
+
+// FreeTrie empties the trie. Its snapshots keep their own view of the
+// nodes and are not affected, its iterators find their place again.
+func FreeTrie[V any](t *Trie[V]) {
+	t.Release()
+	t.version++
+	t.arena = newArena[V]()
+	t.root, _, _ = t.newNode("")
+	t.rehash(t.node(t.root))
+}
+
+func commonPrefix(a, b string) int {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return n
 }
@@ -1,6 +1,7 @@
 package suffix
 
 import (
+	"errors"
 	//"runtime"
 	"testing"
 
@@ -20,7 +21,6 @@ type TrieSuites struct {
 }
 
 func (ts *TrieSuites) SetUpSuite(c *check.C) {
-	InitSets()
 	ts.rand = &util.RandString{
 		Sets: "0123456789ABCDEF",
 		Len:  64,
@@ -45,21 +45,25 @@ func (ts *TrieSuites) TearDownTest(c *check.C) {
 
 func (ts *TrieSuites) TestInsertDelete(c *check.C) {
 	prefix := ts.rand.String()
-	trie := NewTrie()
-	ret := trie.Put(prefix, 1)
+	trie := NewTrie[interface{}](HexAlphabet)
+	ret, err := trie.Put(prefix, 1)
+	c.Assert(err, check.IsNil)
 	c.Assert(ret, check.Equals, true)
-	val := trie.Get(prefix)
+	val := mustGet(c, trie, prefix)
 	c.Assert(val, check.NotNil)
 	vali, _ := val.(int)
 	c.Assert(vali, check.Equals, 1)
-	ret = trie.Put(prefix, 2)
+	ret, err = trie.Put(prefix, 2)
+	c.Assert(err, check.IsNil)
 	c.Assert(ret, check.Equals, false)
-	val = trie.Get(prefix)
+	val = mustGet(c, trie, prefix)
 	vali, _ = val.(int)
 	c.Assert(vali, check.Equals, 2)
-	ret = trie.Delete(prefix)
+	ret, err = trie.Delete(prefix)
+	c.Assert(err, check.IsNil)
 	c.Assert(ret, check.Equals, true)
-	ret = trie.Delete(prefix)
+	ret, err = trie.Delete(prefix)
+	c.Assert(err, check.IsNil)
 	c.Assert(ret, check.Equals, false)
 }
 
@@ -76,7 +80,7 @@ func (ts *TrieSuites) TestWalkBasic(c *check.C) {
 	walker := &testWalk{
 		m: make(map[string]interface{}),
 	}
-	trie := NewTrie()
+	trie := NewTrie[interface{}](HexAlphabet)
 	ilen := 10
 	prefixes := make(map[string]interface{})
 	for i := 0; i < ilen; i++ {
@@ -84,7 +88,8 @@ func (ts *TrieSuites) TestWalkBasic(c *check.C) {
 	}
 
 	for k, v := range prefixes {
-		ret := trie.Put(k, v)
+		ret, err := trie.Put(k, v)
+		c.Assert(err, check.IsNil)
 		c.Assert(ret, check.Equals, true)
 	}
 
@@ -92,9 +97,10 @@ func (ts *TrieSuites) TestWalkBasic(c *check.C) {
 	c.Assert(err, check.IsNil)
 
 	for k, v := range prefixes {
-		node := trie.Get(k)
+		node := mustGet(c, trie, k)
 		c.Assert(node, check.Equals, v)
-		ret := trie.Delete(k)
+		ret, err := trie.Delete(k)
+		c.Assert(err, check.IsNil)
 		c.Assert(ret, check.Equals, true)
 	}
 
@@ -112,7 +118,7 @@ func (ts *TrieSuites) TestFreeBasic(c *check.C) {
 	walker := &testWalk{
 		m: make(map[string]interface{}),
 	}
-	trie := NewTrie()
+	trie := NewTrie[interface{}](HexAlphabet)
 	ilen := 10
 	prefixes := make(map[string]interface{})
 	for i := 0; i < ilen; i++ {
@@ -120,7 +126,8 @@ func (ts *TrieSuites) TestFreeBasic(c *check.C) {
 	}
 
 	for k, v := range prefixes {
-		ret := trie.Put(k, v)
+		ret, err := trie.Put(k, v)
+		c.Assert(err, check.IsNil)
 		c.Assert(ret, check.Equals, true)
 	}
 
@@ -128,7 +135,7 @@ func (ts *TrieSuites) TestFreeBasic(c *check.C) {
 	c.Assert(err, check.IsNil)
 
 	for k, v := range prefixes {
-		node := trie.Get(k)
+		node := mustGet(c, trie, k)
 		c.Assert(node, check.Equals, v)
 	}
 
@@ -144,6 +151,247 @@ func (ts *TrieSuites) TestFreeBasic(c *check.C) {
 	c.Assert(len(walker.m), check.Equals, 0)
 }
 
+func (ts *TrieSuites) TestRadixSplitMerge(c *check.C) {
+	trie := NewTrie[interface{}](HexAlphabet)
+	c.Assert(mustPut(c, trie, "ABCD", 1), check.Equals, true)
+	root := trie.node(trie.root)
+	c.Assert(len(trie.children(root)), check.Equals, 1)
+	c.Assert(trie.label(trie.node(trie.children(root)[0])), check.Equals, "ABCD")
+
+	c.Assert(mustPut(c, trie, "ABEF", 2), check.Equals, true)
+	c.Assert(mustPut(c, trie, "AB", 3), check.Equals, true)
+	ab := trie.node(trie.children(root)[0])
+	c.Assert(trie.label(ab), check.Equals, "AB")
+	c.Assert(ab.value, check.Equals, 3)
+	c.Assert(len(trie.children(ab)), check.Equals, 2)
+	c.Assert(trie.label(trie.node(trie.children(ab)[0])), check.Equals, "CD")
+	c.Assert(trie.label(trie.node(trie.children(ab)[1])), check.Equals, "EF")
+	c.Assert(mustGet(c, trie, "A"), check.IsNil)
+	c.Assert(mustGet(c, trie, "ABC"), check.IsNil)
+	c.Assert(mustGet(c, trie, "ABCDE"), check.IsNil)
+	c.Assert(mustGet(c, trie, "ABEF"), check.Equals, 2)
+
+	c.Assert(mustDelete(c, trie, "ABC"), check.Equals, false)
+	c.Assert(mustDelete(c, trie, "AB"), check.Equals, true)
+	c.Assert(mustDelete(c, trie, "AB"), check.Equals, false)
+	c.Assert(len(trie.children(ab)), check.Equals, 2)
+
+	c.Assert(mustDelete(c, trie, "ABCD"), check.Equals, true)
+	c.Assert(len(trie.children(root)), check.Equals, 1)
+	c.Assert(trie.label(trie.node(trie.children(root)[0])), check.Equals, "ABEF")
+	c.Assert(len(trie.children(trie.node(trie.children(root)[0]))), check.Equals, 0)
+	c.Assert(mustGet(c, trie, "ABEF"), check.Equals, 2)
+
+	c.Assert(mustDelete(c, trie, "ABEF"), check.Equals, true)
+	c.Assert(len(trie.children(root)), check.Equals, 0)
+}
+
+func (ts *TrieSuites) TestRadixWalkOrder(c *check.C) {
+	trie := NewTrie[interface{}](HexAlphabet)
+	keys := []string{"F0", "0", "A1B2", "A1", "A10", "00F"}
+	for i, k := range keys {
+		c.Assert(mustPut(c, trie, k, i), check.Equals, true)
+	}
+	var walked []string
+	err := trie.Walk(func(key string, value interface{}) error {
+		walked = append(walked, key)
+		return nil
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(walked, check.DeepEquals, []string{"0", "00F", "A1", "A10", "A1B2", "F0"})
+}
+
+func (ts *TrieSuites) TestWalkPrefix(c *check.C) {
+	trie := NewTrie[interface{}](HexAlphabet)
+	keys := []string{"3FA9C1", "3FA9C2", "3FA0", "3F", "4F"}
+	for i, k := range keys {
+		c.Assert(mustPut(c, trie, k, i), check.Equals, true)
+	}
+	walkPrefix := func(prefix string) []string {
+		var walked []string
+		err := trie.WalkPrefix(prefix, func(key string, value interface{}) error {
+			walked = append(walked, key)
+			return nil
+		})
+		c.Assert(err, check.IsNil)
+		return walked
+	}
+	c.Assert(walkPrefix("3fa9c"), check.DeepEquals, []string{"3FA9C1", "3FA9C2"})
+	c.Assert(walkPrefix("3FA"), check.DeepEquals, []string{"3FA0", "3FA9C1", "3FA9C2"})
+	c.Assert(walkPrefix("3F"), check.DeepEquals, []string{"3F", "3FA0", "3FA9C1", "3FA9C2"})
+	c.Assert(walkPrefix("3FA9C2"), check.DeepEquals, []string{"3FA9C2"})
+	c.Assert(walkPrefix("3FA9C3"), check.IsNil)
+	c.Assert(walkPrefix("3FB"), check.IsNil)
+	c.Assert(walkPrefix("3FA9C10"), check.IsNil)
+	c.Assert(len(walkPrefix("")), check.Equals, len(keys))
+
+	err := trie.WalkPrefix("3x", func(key string, value interface{}) error {
+		return nil
+	})
+	c.Assert(err, check.FitsTypeOf, &InvalidKeyError{})
+}
+
+func (ts *TrieSuites) TestWalkControl(c *check.C) {
+	trie := NewTrie[interface{}](HexAlphabet)
+	for i, k := range []string{"1", "10", "11", "2", "20", "3"} {
+		mustPut(c, trie, k, i)
+	}
+
+	var walked []string
+	err := trie.Walk(func(key string, value interface{}) error {
+		walked = append(walked, key)
+		if key == "1" {
+			return SkipSubtree
+		}
+		if key == "20" {
+			return StopWalk
+		}
+		return nil
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(walked, check.DeepEquals, []string{"1", "2", "20"})
+
+	failed := errors.New("failed")
+	walked = walked[:0]
+	err = trie.Walk(func(key string, value interface{}) error {
+		walked = append(walked, key)
+		if key == "10" {
+			return failed
+		}
+		return nil
+	})
+	c.Assert(err, check.Equals, failed)
+	c.Assert(walked, check.DeepEquals, []string{"1", "10"})
+
+	walked = walked[:0]
+	err = trie.WalkPrefix("2", func(key string, value interface{}) error {
+		walked = append(walked, key)
+		return failed
+	})
+	c.Assert(err, check.Equals, failed)
+	c.Assert(walked, check.DeepEquals, []string{"2"})
+}
+
+func (ts *TrieSuites) TestSnapshotGeneration(c *check.C) {
+	trie := NewTrie[interface{}](HexAlphabet)
+	mustPut(c, trie, "3FA9", 1)
+	a, b := trie.Snapshot(), trie.Snapshot()
+	c.Assert(b.gen, check.Equals, a.gen)
+	c.Assert(trie.gen, check.Equals, a.gen)
+
+	// the write after them starts the next generation, which they do not
+	// read.
+	mustPut(c, trie, "3FA9", 2)
+	c.Assert(trie.gen, check.Equals, a.gen+1)
+	c.Assert(mustGet(c, a, "3FA9"), check.Equals, 1)
+	next := trie.Snapshot()
+	c.Assert(next.gen, check.Equals, trie.gen)
+
+	a.Release()
+	mustPut(c, trie, "3FA9", 3)
+	c.Assert(mustGet(c, b, "3FA9"), check.Equals, 1)
+	c.Assert(mustGet(c, next, "3FA9"), check.Equals, 2)
+	b.Release()
+	next.Release()
+}
+
+func (ts *TrieSuites) TestSnapshot(c *check.C) {
+	trie := NewTrie[interface{}](HexAlphabet)
+	rand := &util.RandString{
+		Sets: "0123456789ABCDEF",
+		Len:  4,
+	}
+	want := make(map[string]interface{})
+	for i := 0; i < 2000; i++ {
+		k := rand.String()
+		want[k] = i
+		mustPut(c, trie, k, i)
+	}
+
+	var snaps []*Trie[interface{}]
+	var wants []map[string]interface{}
+	for round := 0; round < 3; round++ {
+		snap := trie.Snapshot()
+		c.Assert(snap.ReadOnly(), check.Equals, true)
+		c.Assert(snap.Snapshot(), check.Equals, snap)
+		snaps = append(snaps, snap)
+		frozen := make(map[string]interface{})
+		for k, v := range want {
+			frozen[k] = v
+		}
+		wants = append(wants, frozen)
+
+		for i := 0; i < 1000; i++ {
+			k := rand.String()
+			if _, ok := want[k]; ok {
+				delete(want, k)
+				c.Assert(mustDelete(c, trie, k), check.Equals, true)
+				continue
+			}
+			want[k] = -i
+			mustPut(c, trie, k, -i)
+		}
+	}
+
+	walked := func(t *Trie[interface{}]) map[string]interface{} {
+		m := make(map[string]interface{})
+		err := t.Walk(func(key string, value interface{}) error {
+			m[key] = value
+			return nil
+		})
+		c.Assert(err, check.IsNil)
+		return m
+	}
+	c.Assert(walked(trie), check.DeepEquals, want)
+	for i, snap := range snaps {
+		c.Assert(walked(snap), check.DeepEquals, wants[i])
+	}
+
+	_, err := snaps[0].Put("AB", 1)
+	c.Assert(err, check.Equals, ErrReadOnly)
+	_, err = snaps[0].Delete("AB")
+	c.Assert(err, check.Equals, ErrReadOnly)
+
+	FreeTrie(trie)
+	c.Assert(len(walked(trie)), check.Equals, 0)
+	c.Assert(walked(snaps[2]), check.DeepEquals, wants[2])
+}
+
+func (ts *TrieSuites) TestTypedValues(c *check.C) {
+	trie := NewTrie[int](HexAlphabet)
+	ret, err := trie.Put("AB", 0)
+	c.Assert(err, check.IsNil)
+	c.Assert(ret, check.Equals, true)
+	ret, err = trie.Put("ABC", 7)
+	c.Assert(err, check.IsNil)
+	c.Assert(ret, check.Equals, true)
+
+	val, ok, err := trie.Get("AB")
+	c.Assert(err, check.IsNil)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(val, check.Equals, 0)
+	_, ok, err = trie.Get("A")
+	c.Assert(err, check.IsNil)
+	c.Assert(ok, check.Equals, false)
+
+	sum := 0
+	err = trie.Walk(func(key string, value int) error {
+		sum += value
+		return nil
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(sum, check.Equals, 7)
+
+	ret, err = trie.Delete("AB")
+	c.Assert(err, check.IsNil)
+	c.Assert(ret, check.Equals, true)
+	_, ok, _ = trie.Get("AB")
+	c.Assert(ok, check.Equals, false)
+	val, ok, _ = trie.Get("ABC")
+	c.Assert(ok, check.Equals, true)
+	c.Assert(val, check.Equals, 7)
+}
+
 func (ts *TrieSuites) TestOpNum(c *check.C) {
 	u := uint16(0xff00)
 	for i := 0; i < 10; i++ {
@@ -166,9 +414,9 @@ func (ts *TrieSuites) TestOpNum(c *check.C) {
 }
 
 func (ts *TrieSuites) BenchmarkInsertDeleteMany(c *check.C) {
-	//trie := NewTrie()
+	//trie := NewTrie[interface{}](HexAlphabet)
 	for i := 0; i < c.N; i++ {
-		trie := NewTrie()
+		trie := NewTrie[interface{}](HexAlphabet)
 		ts.insertDeleteMany(c, trie, ts.prefixes)
 	}
 }
@@ -180,21 +428,23 @@ func (ts *TrieSuites) BenchmarkMapInsertDeleteMany(c *check.C) {
 	}
 }
 
-func (ts *TrieSuites) insertDeleteMany(c *check.C, trie *Trie, prefixes map[string]int) {
+func (ts *TrieSuites) insertDeleteMany(c *check.C, trie *Trie[interface{}], prefixes map[string]int) {
 	for k, _ := range prefixes {
-		ret := trie.Put(k, 1)
+		ret, err := trie.Put(k, 1)
+		c.Assert(err, check.IsNil)
 		c.Assert(ret, check.Equals, true)
 	}
 
 	//runtime.GC()
 
 	/*for k, _ := range prefixes {
-		ret := trie.Delete(k)
+		ret, err := trie.Delete(k)
+		c.Assert(err, check.IsNil)
 		c.Assert(ret, check.Equals, true)
 	}*/
 
 	for k, _ := range prefixes {
-		ref := trie.Get(k)
+		ref := mustGet(c, trie, k)
 		c.Assert(ref, check.NotNil)
 	}
 }
@@ -248,6 +498,27 @@ func (ts *TrieSuites) getHalfSameStrings(num int) map[string]int {
 	return prefixes
 }
 
+func mustPut(c *check.C, trie *Trie[interface{}], key string, value interface{}) bool {
+	ret, err := trie.Put(key, value)
+	c.Assert(err, check.IsNil)
+	return ret
+}
+
+func mustGet(c *check.C, trie *Trie[interface{}], key string) interface{} {
+	val, ok, err := trie.Get(key)
+	c.Assert(err, check.IsNil)
+	if !ok {
+		return nil
+	}
+	return val
+}
+
+func mustDelete(c *check.C, trie *Trie[interface{}], key string) bool {
+	ret, err := trie.Delete(key)
+	c.Assert(err, check.IsNil)
+	return ret
+}
+
 func incNum(u uint16) uint16 {
 	t := uint8(u & 0x00ff)
 	t++
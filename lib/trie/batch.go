@@ -0,0 +1,91 @@
+package trie
+
+import (
+	"fmt"
+)
+
+// BatchResult is the outcome of one key of a batch: the ref the key is
+// left with, whether a delete dropped the key, or why it failed.
+type BatchResult struct {
+	Key     string
+	Ref     int
+	Deleted bool
+	Err     error
+}
+
+// BatchError is returned next to the results of a batch in which some keys
+// failed. It unwraps to the error of the first of them.
+type BatchError struct {
+	Failed int
+	Total  int
+	First  error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("Failed %d of %d keys in batch, first err: %v", e.Failed, e.Total, e.First)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.First
+}
+
+// BatchErr returns a BatchError for the failed results, or nil.
+func BatchErr(results []BatchResult) error {
+	var berr *BatchError
+	for _, r := range results {
+		if r.Err == nil {
+			continue
+		}
+		if berr == nil {
+			berr = &BatchError{Total: len(results), First: r.Err}
+		}
+		berr.Failed++
+	}
+	if berr == nil {
+		return nil
+	}
+	return berr
+}
+
+// InsertBatch inserts keys as Insert does, taking the lock of every stripe
+// once. A key given twice is inserted twice. The results follow the order
+// of keys.
+func (tr *Trie[P]) InsertBatch(keys []string) ([]BatchResult, error) {
+	results := tr.batch(keys, func(s *stripe[P], r *BatchResult) {
+		r.Ref, r.Err = s.insert(r.Key)
+	})
+	return results, BatchErr(results)
+}
+
+// DeleteBatch deletes keys as Delete does, taking the lock of every stripe
+// once. Missing keys are left alone with a zero ref.
+func (tr *Trie[P]) DeleteBatch(keys []string) ([]BatchResult, error) {
+	results := tr.batch(keys, func(s *stripe[P], r *BatchResult) {
+		r.Ref, r.Deleted, r.Err = s.delete(r.Key)
+	})
+	return results, BatchErr(results)
+}
+
+// batch groups keys by stripe and runs op on each under the stripe lock.
+func (tr *Trie[P]) batch(keys []string, op func(s *stripe[P], r *BatchResult)) []BatchResult {
+	defer tr.notifier.flush()
+	results := make([]BatchResult, len(keys))
+	groups := make(map[*stripe[P]][]int)
+	for i, key := range keys {
+		results[i].Key = key
+		s := tr.stripeOf(key)
+		groups[s] = append(groups[s], i)
+	}
+	for _, s := range tr.stripes {
+		idxs := groups[s]
+		if len(idxs) == 0 {
+			continue
+		}
+		s.mutex.Lock()
+		for _, i := range idxs {
+			op(s, &results[i])
+		}
+		s.mutex.Unlock()
+	}
+	return results
+}
@@ -0,0 +1,48 @@
+package trie
+
+import (
+	"errors"
+
+	"gopkg.in/check.v1"
+	trie "trie/lib/suffix"
+)
+
+var _ = check.Suite(&BatchSuites{})
+
+type BatchSuites struct {
+}
+
+func (bs *BatchSuites) TestBatch(c *check.C) {
+	for _, opts := range [][]Option{nil, {WithLockStriping()}} {
+		tr := CreateTrie(opts...)
+		c.Assert(tr.Insert("3FA9"), check.IsNil)
+		results, err := tr.InsertBatch([]string{"3FA9", "00AA", "3FA9", "XYZ", "A000"})
+		c.Assert(results, check.HasLen, 5)
+		var berr *BatchError
+		c.Assert(errors.As(err, &berr), check.Equals, true)
+		c.Assert(berr.Failed, check.Equals, 1)
+		var kerr *trie.InvalidKeyError
+		c.Assert(errors.As(err, &kerr), check.Equals, true)
+		refs := make([]int, len(results))
+		for i, r := range results {
+			refs[i] = r.Ref
+		}
+		c.Assert(refs, check.DeepEquals, []int{2, 1, 3, -1, 1})
+		c.Assert(results[3].Key, check.Equals, "XYZ")
+		c.Assert(results[3].Err, check.NotNil)
+		c.Assert(tr.Len(), check.Equals, 3)
+
+		results, err = tr.DeleteBatch([]string{"00AA", "3FA9", "0F00", "00AA"})
+		c.Assert(err, check.IsNil)
+		c.Assert(results, check.DeepEquals, []BatchResult{
+			{Key: "00AA", Ref: 0, Deleted: true},
+			{Key: "3FA9", Ref: 2},
+			{Key: "0F00"},
+			{Key: "00AA"},
+		})
+		c.Assert(tr.Len(), check.Equals, 2)
+		results, err = tr.InsertBatch(nil)
+		c.Assert(err, check.IsNil)
+		c.Assert(results, check.HasLen, 0)
+	}
+}
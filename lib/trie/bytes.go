@@ -0,0 +1,41 @@
+package trie
+
+// The byte key APIs take raw digests, such as the [32]byte of a sha256
+// sum sliced to a []byte. They address the same entries as the hex form of
+// the digest does in the string APIs.
+
+func (tr *Trie[P]) InsertBytes(key []byte) error {
+	skey, err := tr.encodeBytes(key)
+	if err != nil {
+		return err
+	}
+	return tr.Insert(skey)
+}
+
+func (tr *Trie[P]) GetRefBytes(key []byte) (int, error) {
+	skey, err := tr.encodeBytes(key)
+	if err != nil {
+		return -1, err
+	}
+	return tr.GetRef(skey)
+}
+
+func (tr *Trie[P]) UpdateBytes(key []byte, ref int) error {
+	skey, err := tr.encodeBytes(key)
+	if err != nil {
+		return err
+	}
+	return tr.Update(skey, ref)
+}
+
+func (tr *Trie[P]) DeleteBytes(key []byte) (bool, error) {
+	skey, err := tr.encodeBytes(key)
+	if err != nil {
+		return false, err
+	}
+	return tr.Delete(skey)
+}
+
+func (tr *Trie[P]) encodeBytes(key []byte) (string, error) {
+	return tr.Alphabet().EncodeBytes(key)
+}
@@ -0,0 +1,72 @@
+package trie
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"gopkg.in/check.v1"
+)
+
+var _ = check.Suite(&BytesSuites{})
+
+type BytesSuites struct {
+}
+
+func (bs *BytesSuites) TestInterop(c *check.C) {
+	tr := CreateTrie()
+	sum := sha256.Sum256([]byte("layer"))
+	hexKey := hex.EncodeToString(sum[:])
+
+	err := tr.InsertBytes(sum[:])
+	c.Assert(err, check.IsNil)
+	err = tr.Insert(hexKey)
+	c.Assert(err, check.IsNil)
+	ref, err := tr.GetRefBytes(sum[:])
+	c.Assert(err, check.IsNil)
+	c.Assert(ref, check.Equals, 2)
+
+	d, err := tr.DeleteBytes(sum[:])
+	c.Assert(err, check.IsNil)
+	c.Assert(d, check.Equals, false)
+	err = tr.UpdateBytes(sum[:], 5)
+	c.Assert(err, check.IsNil)
+	ref, err = tr.GetRef(strings.ToUpper(hexKey))
+	c.Assert(err, check.IsNil)
+	c.Assert(ref, check.Equals, 5)
+}
+
+func (bs *BytesSuites) TestSaveCompact(c *check.C) {
+	tr := CreateTrie()
+	sum := sha256.Sum256([]byte("layer"))
+	err := tr.InsertBytes(sum[:])
+	c.Assert(err, check.IsNil)
+	err = tr.Insert("3FA")
+	c.Assert(err, check.IsNil)
+
+	buf := &bytes.Buffer{}
+	err = tr.Save(buf)
+	c.Assert(err, check.IsNil)
+
+	fileNodes, err := readAll(GobCodec, bytes.NewReader(buf.Bytes()))
+	c.Assert(err, check.IsNil)
+	c.Assert(fileNodes, check.HasLen, 2)
+	if fileNodes[0].Prefix != "" {
+		fileNodes[0], fileNodes[1] = fileNodes[1], fileNodes[0]
+	}
+	c.Assert(fileNodes[0].Prefix, check.Equals, "")
+	c.Assert(fileNodes[0].Digest, check.DeepEquals, sum[:])
+	c.Assert(fileNodes[1].Prefix, check.Equals, "3FA")
+	c.Assert(fileNodes[1].Digest, check.IsNil)
+
+	loaded := CreateTrie()
+	err = loaded.Load(buf)
+	c.Assert(err, check.IsNil)
+	ref, err := loaded.GetRefBytes(sum[:])
+	c.Assert(err, check.IsNil)
+	c.Assert(ref, check.Equals, 1)
+	ref, err = loaded.GetRef("3fa")
+	c.Assert(err, check.IsNil)
+	c.Assert(ref, check.Equals, 1)
+}
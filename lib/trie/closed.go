@@ -0,0 +1,49 @@
+package trie
+
+import (
+	trie "trie/lib/suffix"
+)
+
+// closedIndex stands in for the indexes of a trie after Cleanup. It holds
+// no keys and fails every call with ErrClosed.
+type closedIndex[V any] struct {
+	alphabet *trie.Alphabet
+}
+
+func (ci closedIndex[V]) Alphabet() *trie.Alphabet {
+	return ci.alphabet
+}
+
+func (ci closedIndex[V]) Get(key string) (V, bool, error) {
+	var v V
+	return v, false, ErrClosed
+}
+
+func (ci closedIndex[V]) Put(key string, value V) (bool, error) {
+	return false, ErrClosed
+}
+
+func (ci closedIndex[V]) Delete(key string) (bool, error) {
+	return false, ErrClosed
+}
+
+func (ci closedIndex[V]) Walk(walker trie.WalkFunc[V]) error {
+	return ErrClosed
+}
+
+func (ci closedIndex[V]) WalkPrefix(prefix string, walker trie.WalkFunc[V]) error {
+	return ErrClosed
+}
+
+func (ci closedIndex[V]) Len() int {
+	return 0
+}
+
+// closed reports whether Cleanup closed the trie.
+func (tr *Trie[P]) closed() bool {
+	s := tr.stripes[0]
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	_, ok := s.root.(closedIndex[*NodeInfo[P]])
+	return ok
+}
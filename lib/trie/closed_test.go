@@ -0,0 +1,53 @@
+package trie
+
+import (
+	"bytes"
+	"errors"
+
+	"gopkg.in/check.v1"
+)
+
+var _ = check.Suite(&ClosedSuites{})
+
+type ClosedSuites struct {
+}
+
+func (cs *ClosedSuites) TestClosed(c *check.C) {
+	for _, opts := range [][]Option{nil, {WithLockStriping()}, {WithBackend(PatriciaBackend)}} {
+		tr := CreateTrie(opts...)
+		c.Assert(tr.Insert("3FA9"), check.IsNil)
+		buf := &bytes.Buffer{}
+		c.Assert(tr.Save(buf), check.IsNil)
+		tr.Cleanup()
+
+		closed := func(err error) {
+			c.Assert(errors.Is(err, ErrClosed), check.Equals, true, check.Commentf("%v", err))
+		}
+		closed(tr.Insert("3FA9"))
+		_, err := tr.Delete("3FA9")
+		closed(err)
+		_, err = tr.GetRef("3FA9")
+		closed(err)
+		closed(tr.Update("3FA9", 1))
+		_, err = tr.Resolve("3F")
+		closed(err)
+		closed(tr.Select(&countSelector{}))
+		closed(tr.Save(&bytes.Buffer{}))
+		closed(tr.Load(bytes.NewReader(buf.Bytes())))
+		_, err = tr.InsertBatch([]string{"00"})
+		closed(err)
+		c.Assert(tr.Len(), check.Equals, 0)
+		closed(tr.Match("3F*", func(key string, node *NodeInfo[struct{}]) error {
+			return nil
+		}))
+		closed(tr.Diff(CreateTrie(), func(key string, a, b *NodeInfo[struct{}]) error {
+			return nil
+		}))
+		it := tr.Iterator()
+		c.Assert(it.First(), check.Equals, false)
+		closed(it.Err())
+		_, err = tr.RangeIterator("00", "")
+		closed(err)
+		c.Assert(tr.RootHash(), check.IsNil)
+	}
+}
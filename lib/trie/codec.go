@@ -0,0 +1,178 @@
+package trie
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Codec is the file format of a saved trie. Save and Load use GobCodec,
+// SaveCodec and LoadCodec take any.
+type Codec interface {
+	// Name is what CodecByName takes to find the codec again.
+	Name() string
+	// NewWriter starts a file of count records.
+	NewWriter(writer io.Writer, count int) (RecordWriter, error)
+	NewReader(reader io.Reader) (RecordReader, error)
+}
+
+type RecordWriter interface {
+	Write(fileNode *FileNode) error
+	// Close ends the file, it does not close the writer under it.
+	Close() error
+}
+
+type RecordReader interface {
+	// Read returns io.EOF after the last record.
+	Read(fileNode *FileNode) error
+}
+
+var (
+	// GobCodec writes gob records between a header and a checksum and
+	// reads the bare gob stream of older files as well.
+	GobCodec Codec = gobCodec{}
+	// BinaryCodec writes varint encoded records between a header and a
+	// checksum, which is the smallest of the formats.
+	BinaryCodec Codec = binaryCodec{}
+	// JSONLCodec writes a JSON object per key and line.
+	JSONLCodec Codec = jsonlCodec{}
+	// CSVCodec writes a header row and a row per key.
+	CSVCodec Codec = csvCodec{}
+)
+
+var codecs = map[string]Codec{
+	GobCodec.Name():    GobCodec,
+	BinaryCodec.Name(): BinaryCodec,
+	JSONLCodec.Name():  JSONLCodec,
+	CSVCodec.Name():    CSVCodec,
+}
+
+// CodecByName returns the codec of a name returned by Name, such as
+// "jsonl" or "csv+gzip".
+func CodecByName(name string) (Codec, error) {
+	base, compression, _ := strings.Cut(name, "+")
+	codec, ok := codecs[base]
+	if !ok {
+		return nil, fmt.Errorf("Unknown codec %s", name)
+	}
+	switch compression {
+	case "":
+		return codec, nil
+	case "gzip":
+		return Gzip(codec), nil
+	case "flate":
+		return Flate(codec), nil
+	}
+	return nil, fmt.Errorf("Unknown compression of codec %s", name)
+}
+
+// SaveCodec writes a snapshot of the trie with codec.
+func (tr *Trie[P]) SaveCodec(writer io.Writer, codec Codec) error {
+	if tr.closed() {
+		return ErrClosed
+	}
+	snap := tr.Snapshot()
+	defer snap.Release()
+	return snap.SaveCodec(writer, codec)
+}
+
+// LoadCodec puts the records written with codec over the trie, as Load
+// does.
+func (tr *Trie[P]) LoadCodec(reader io.Reader, codec Codec) error {
+	_, err := tr.LoadWith(reader, codec, LoadOverwrite)
+	return err
+}
+
+// readAll decodes all the records of a file before returning them, so a
+// bad file is turned down before anything is loaded.
+func readAll(codec Codec, reader io.Reader) ([]FileNode, error) {
+	rr, err := codec.NewReader(reader)
+	if err != nil {
+		return nil, err
+	}
+	var fileNodes []FileNode
+	for {
+		var fileNode FileNode
+		err := rr.Read(&fileNode)
+		if err == io.EOF {
+			return fileNodes, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		fileNodes = append(fileNodes, fileNode)
+	}
+}
+
+// Gzip compresses the files of codec with gzip.
+func Gzip(codec Codec) Codec {
+	return &compressed{
+		Codec: codec,
+		name:  "gzip",
+		newWriter: func(w io.Writer) (io.WriteCloser, error) {
+			return gzip.NewWriter(w), nil
+		},
+		newReader: func(r io.Reader) (io.Reader, error) {
+			return gzip.NewReader(r)
+		},
+	}
+}
+
+// Flate compresses the files of codec with raw deflate.
+func Flate(codec Codec) Codec {
+	return &compressed{
+		Codec: codec,
+		name:  "flate",
+		newWriter: func(w io.Writer) (io.WriteCloser, error) {
+			return flate.NewWriter(w, flate.DefaultCompression)
+		},
+		newReader: func(r io.Reader) (io.Reader, error) {
+			return flate.NewReader(r), nil
+		},
+	}
+}
+
+type compressed struct {
+	Codec
+	name      string
+	newWriter func(io.Writer) (io.WriteCloser, error)
+	newReader func(io.Reader) (io.Reader, error)
+}
+
+func (cc *compressed) Name() string {
+	return cc.Codec.Name() + "+" + cc.name
+}
+
+func (cc *compressed) NewWriter(writer io.Writer, count int) (RecordWriter, error) {
+	zw, err := cc.newWriter(writer)
+	if err != nil {
+		return nil, err
+	}
+	rw, err := cc.Codec.NewWriter(zw, count)
+	if err != nil {
+		return nil, err
+	}
+	return &compressedWriter{RecordWriter: rw, zw: zw}, nil
+}
+
+func (cc *compressed) NewReader(reader io.Reader) (RecordReader, error) {
+	zr, err := cc.newReader(reader)
+	if err != nil {
+		return nil, fmt.Errorf("%w, failed to read %s header, err: %v", ErrCorrupt, cc.name, err)
+	}
+	return cc.Codec.NewReader(zr)
+}
+
+type compressedWriter struct {
+	RecordWriter
+	zw io.WriteCloser
+}
+
+func (cw *compressedWriter) Close() error {
+	if err := cw.RecordWriter.Close(); err != nil {
+		return err
+	}
+	return cw.zw.Close()
+}
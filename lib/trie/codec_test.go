@@ -0,0 +1,136 @@
+package trie
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+var _ = check.Suite(&CodecSuites{})
+
+type CodecSuites struct {
+}
+
+func (cs *CodecSuites) filled(c *check.C) *Trie[testPayload] {
+	tr := NewTrie[testPayload]()
+	for _, k := range []string{"00AA", "3FA", "3FA9", "3FA9", "A000"} {
+		c.Assert(tr.Insert(k), check.IsNil)
+	}
+	c.Assert(tr.SetPayload("3FA9", testPayload{size: 300}), check.IsNil)
+	c.Assert(tr.SetMeta("3FA", 12, "text/plain, charset=\"utf-8\""), check.IsNil)
+	_, err := tr.Delete("3FA9")
+	c.Assert(err, check.IsNil)
+	return tr
+}
+
+type codecRecord struct {
+	key                               string
+	ref                               int
+	size                              uint32
+	meta                              int64
+	mediaType                         string
+	created, incremented, decremented time.Time
+}
+
+func (cs *CodecSuites) records(c *check.C, tr *Trie[testPayload]) []codecRecord {
+	var records []codecRecord
+	it := tr.Iterator()
+	for ok := it.First(); ok; ok = it.Next() {
+		records = append(records, codecRecord{key: it.Key(), ref: it.Ref(), size: it.Payload().size})
+	}
+	i := 0
+	err := tr.Select(&MetaSelector[testPayload]{Visit: func(prefix string, node *NodeInfo[testPayload]) error {
+		r := &records[i]
+		r.meta, r.mediaType = node.Size(), node.MediaType()
+		// times come back in the local zone from the text codecs.
+		r.created, r.incremented, r.decremented = node.Created().UTC(), node.LastIncrement().UTC(), node.LastDecrement().UTC()
+		i++
+		return nil
+	}})
+	c.Assert(err, check.IsNil)
+	return records
+}
+
+func (cs *CodecSuites) TestRoundTrip(c *check.C) {
+	tr := cs.filled(c)
+	want := cs.records(c, tr)
+	for _, base := range []Codec{GobCodec, BinaryCodec, JSONLCodec, CSVCodec} {
+		for _, codec := range []Codec{base, Gzip(base), Flate(base)} {
+			comment := check.Commentf("codec %s", codec.Name())
+			buf := &bytes.Buffer{}
+			c.Assert(tr.SaveCodec(buf, codec), check.IsNil, comment)
+			byName, err := CodecByName(codec.Name())
+			c.Assert(err, check.IsNil, comment)
+			loaded := NewTrie[testPayload]()
+			c.Assert(loaded.LoadCodec(buf, byName), check.IsNil, comment)
+			c.Assert(cs.records(c, loaded), check.DeepEquals, want, comment)
+		}
+	}
+}
+
+func (cs *CodecSuites) TestText(c *check.C) {
+	tr := cs.filled(c)
+	buf := &bytes.Buffer{}
+	c.Assert(tr.SaveCodec(buf, JSONLCodec), check.IsNil)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	c.Assert(lines, check.HasLen, 4)
+	var record map[string]interface{}
+	c.Assert(json.Unmarshal([]byte(lines[2]), &record), check.IsNil)
+	c.Assert(record["key"], check.Equals, "3FA9")
+	c.Assert(record["ref"], check.Equals, float64(1))
+
+	buf.Reset()
+	c.Assert(tr.SaveCodec(buf, CSVCodec), check.IsNil)
+	lines = strings.Split(strings.TrimSpace(buf.String()), "\n")
+	c.Assert(lines, check.HasLen, 5)
+	c.Assert(lines[0], check.Equals, "key,ref,size,media_type,created,last_increment,last_decrement,payload,holders")
+	c.Assert(strings.HasPrefix(lines[1], "00AA,1,0,,"), check.Equals, true)
+
+	err := CreateTrie().LoadCodec(strings.NewReader("{\"key\":\"3FA9\",\"ref\":1}\n{\"key\":"), JSONLCodec)
+	c.Assert(errors.Is(err, ErrCorrupt), check.Equals, true)
+	err = CreateTrie().LoadCodec(strings.NewReader("key,ref\n"), CSVCodec)
+	c.Assert(errors.Is(err, ErrCorrupt), check.Equals, true)
+}
+
+func (cs *CodecSuites) TestBinaryIntegrity(c *check.C) {
+	tr := cs.filled(c)
+	buf := &bytes.Buffer{}
+	c.Assert(tr.SaveCodec(buf, BinaryCodec), check.IsNil)
+	gobBuf := &bytes.Buffer{}
+	c.Assert(tr.Save(gobBuf), check.IsNil)
+	c.Assert(buf.Len() < gobBuf.Len(), check.Equals, true)
+
+	data := buf.Bytes()
+	for _, n := range []int{headerLen + 1, len(data) - 5, len(data) - 1} {
+		err := CreateTrie().LoadCodec(bytes.NewReader(data[:n]), BinaryCodec)
+		c.Assert(errors.Is(err, ErrCorrupt), check.Equals, true, check.Commentf("cut at %d: %v", n, err))
+	}
+	bad := append([]byte(nil), data...)
+	bad[headerLen+3] ^= 0x40
+	err := CreateTrie().LoadCodec(bytes.NewReader(bad), BinaryCodec)
+	c.Assert(errors.Is(err, ErrCorrupt), check.Equals, true)
+	// a gob file is not taken for a binary one.
+	err = CreateTrie().LoadCodec(bytes.NewReader(gobBuf.Bytes()), BinaryCodec)
+	c.Assert(errors.Is(err, ErrCorrupt), check.Equals, true)
+
+	buf.Reset()
+	c.Assert(tr.SaveCodec(buf, Gzip(BinaryCodec)), check.IsNil)
+	err = CreateTrie().LoadCodec(bytes.NewReader(buf.Bytes()[:buf.Len()-3]), Gzip(BinaryCodec))
+	c.Assert(err, check.NotNil)
+}
+
+func (cs *CodecSuites) TestCodecByName(c *check.C) {
+	for _, name := range []string{"gob", "binary", "jsonl+gzip", "csv+flate"} {
+		codec, err := CodecByName(name)
+		c.Assert(err, check.IsNil)
+		c.Assert(codec.Name(), check.Equals, name)
+	}
+	_, err := CodecByName("xml")
+	c.Assert(err, check.ErrorMatches, "Unknown codec xml")
+	_, err = CodecByName("csv+zstd")
+	c.Assert(err, check.ErrorMatches, "Unknown compression .*")
+}
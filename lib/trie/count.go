@@ -0,0 +1,161 @@
+package trie
+
+import (
+	"fmt"
+
+	trie "trie/lib/suffix"
+)
+
+// Len returns the number of keys, whatever their refs.
+func (tr *Trie[P]) Len() int {
+	tr.rlockAll()
+	defer tr.runlockAll()
+	return tr.len()
+}
+
+func (tr *Trie[P]) len() int {
+	total := 0
+	for _, s := range tr.stripes {
+		total += s.root.Len()
+	}
+	return total
+}
+
+// CountPrefix returns the number of keys starting with prefix. Backends
+// other than suffix count them one by one.
+func (tr *Trie[P]) CountPrefix(prefix string) (int, error) {
+	if len(prefix) == 0 {
+		return tr.Len(), nil
+	}
+	s := tr.stripeOf(prefix)
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if root, ok := s.suffixRoot(); ok {
+		return root.CountPrefix(prefix)
+	}
+	count := 0
+	err := s.root.WalkPrefix(prefix, func(string, *NodeInfo[P]) error {
+		count++
+		return nil
+	})
+	return count, err
+}
+
+// Rank returns the number of keys sorting before key.
+func (tr *Trie[P]) Rank(key string) (int, error) {
+	key, err := tr.alphabet.Canonical(key)
+	if err != nil || len(key) == 0 {
+		return 0, err
+	}
+	tr.rlockAll()
+	defer tr.runlockAll()
+	s := tr.stripeOf(key)
+	rank := 0
+	for _, other := range tr.stripes {
+		if other == s {
+			break
+		}
+		rank += other.root.Len()
+	}
+	if root, ok := s.suffixRoot(); ok {
+		r, err := root.Rank(key)
+		return rank + r, err
+	}
+	err = s.root.Walk(func(k string, node *NodeInfo[P]) error {
+		if tr.alphabet.Compare(k, key) >= 0 {
+			return StopWalk
+		}
+		rank++
+		return nil
+	})
+	return rank, err
+}
+
+// Nth returns the key at offset k in key order and its ref, so pages can
+// be addressed by offset.
+func (tr *Trie[P]) Nth(k int) (string, int, error) {
+	tr.rlockAll()
+	defer tr.runlockAll()
+	if k >= 0 {
+		for _, s := range tr.stripes {
+			if n := s.root.Len(); k >= n {
+				k -= n
+				continue
+			}
+			key, node := nth(s.root, k)
+			return key, node.ref, nil
+		}
+	}
+	return "", -1, fmt.Errorf("%w offset %d of %d", ErrNotFound, k, tr.len())
+}
+
+// nth returns the key at offset k of an index holding more than k keys.
+func nth[V any](root Index[V], k int) (string, V) {
+	if root, ok := root.(*trie.Trie[V]); ok {
+		key, value, _ := root.Select(k)
+		return key, value
+	}
+	var (
+		key   string
+		value V
+	)
+	root.Walk(func(k2 string, v V) error {
+		if k--; k >= 0 {
+			return nil
+		}
+		key, value = k2, v
+		return StopWalk
+	})
+	return key, value
+}
+
+// Sample returns up to num distinct keys picked uniformly at random.
+func (tr *Trie[P]) Sample(num int) []string {
+	tr.rlockAll()
+	defer tr.runlockAll()
+	lens := make([]int, len(tr.stripes))
+	total := 0
+	for i, s := range tr.stripes {
+		lens[i] = s.root.Len()
+		total += lens[i]
+	}
+	// every stripe draws as many keys as the picked ranks falling into it.
+	perStripe := make([]int, len(tr.stripes))
+	for _, k := range trie.PickRanks(total, num, nil) {
+		i := 0
+		for k >= lens[i] {
+			k -= lens[i]
+			i++
+		}
+		perStripe[i]++
+	}
+	var keys []string
+	for i, s := range tr.stripes {
+		if perStripe[i] > 0 {
+			keys = append(keys, sample(s.root, perStripe[i])...)
+		}
+	}
+	return keys
+}
+
+func sample[V any](root Index[V], num int) []string {
+	if root, ok := root.(*trie.Trie[V]); ok {
+		return root.Sample(num, nil)
+	}
+	ranks := trie.PickRanks(root.Len(), num, nil)
+	if len(ranks) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(ranks))
+	rank := 0
+	root.Walk(func(key string, v V) error {
+		if rank == ranks[len(keys)] {
+			if keys = append(keys, key); len(keys) == len(ranks) {
+				return StopWalk
+			}
+		}
+		rank++
+		return nil
+	})
+	return keys
+}
@@ -0,0 +1,42 @@
+package trie
+
+import (
+	"errors"
+
+	"gopkg.in/check.v1"
+)
+
+var _ = check.Suite(&CountSuites{})
+
+type CountSuites struct {
+}
+
+func (cs *CountSuites) TestCounts(c *check.C) {
+	tr := CreateTrie()
+	keys := []string{"00AA", "0F", "3FA9", "3FA9C1", "A000"}
+	for _, k := range keys {
+		err := tr.Insert(k)
+		c.Assert(err, check.IsNil)
+	}
+	err := tr.Insert("3FA9")
+	c.Assert(err, check.IsNil)
+	c.Assert(tr.Len(), check.Equals, len(keys))
+
+	count, err := tr.CountPrefix("3fa")
+	c.Assert(err, check.IsNil)
+	c.Assert(count, check.Equals, 2)
+	rank, err := tr.Rank("3FA9C1")
+	c.Assert(err, check.IsNil)
+	c.Assert(rank, check.Equals, 3)
+
+	key, ref, err := tr.Nth(2)
+	c.Assert(err, check.IsNil)
+	c.Assert(key, check.Equals, "3FA9")
+	c.Assert(ref, check.Equals, 2)
+	_, _, err = tr.Nth(len(keys))
+	c.Assert(errors.Is(err, ErrNotFound), check.Equals, true)
+
+	sample := tr.Sample(10)
+	c.Assert(sample, check.DeepEquals, keys)
+	c.Assert(tr.Sample(1), check.HasLen, 1)
+}
@@ -0,0 +1,353 @@
+package trie
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"time"
+)
+
+// The gob and binary codecs frame their records with a header of a magic,
+// the version and the record count, and a CRC32 of the header and records
+// in the trailer. Gob files without the magic are read as the bare gob
+// stream written before.
+const (
+	gobMagic    = "TRIS"
+	binaryMagic = "TRIB"
+	// SnapshotVersion is the version of the frame Save writes. Binary
+	// records have holders since version 2.
+	SnapshotVersion = 2
+	headerLen       = 4 + 2 + 8
+)
+
+// ErrCorrupt is returned by Load for snapshots which are truncated or fail
+// their checksum.
+var ErrCorrupt = errors.New("Corrupt snapshot")
+
+// frameWriter writes the header and trailer around count records written
+// to w.
+type frameWriter struct {
+	writer  io.Writer
+	w       io.Writer
+	crc     hash.Hash32
+	count   uint64
+	written uint64
+}
+
+func newFrameWriter(writer io.Writer, magic string, count int) (*frameWriter, error) {
+	fw := &frameWriter{writer: writer, crc: crc32.NewIEEE(), count: uint64(count)}
+	fw.w = io.MultiWriter(writer, fw.crc)
+	header := make([]byte, 0, headerLen)
+	header = append(header, magic...)
+	header = binary.BigEndian.AppendUint16(header, SnapshotVersion)
+	header = binary.BigEndian.AppendUint64(header, fw.count)
+	if _, err := fw.w.Write(header); err != nil {
+		return nil, fmt.Errorf("Failed to write snapshot header, err: %v", err)
+	}
+	return fw, nil
+}
+
+func (fw *frameWriter) Close() error {
+	if fw.written != fw.count {
+		return fmt.Errorf("Failed to write snapshot, %d of %d records written", fw.written, fw.count)
+	}
+	_, err := fw.writer.Write(binary.BigEndian.AppendUint32(nil, fw.crc.Sum32()))
+	return err
+}
+
+// frameReader reads the header, then hands out the records through r
+// until the count is reached and the checksum checked.
+type frameReader struct {
+	br      *bufio.Reader
+	r       *crcReader
+	version uint16
+	count   uint64
+	read    uint64
+}
+
+// hasMagic reports whether the reader starts with magic.
+func hasMagic(br *bufio.Reader, magic string) bool {
+	head, err := br.Peek(len(magic))
+	return err == nil && string(head) == magic
+}
+
+func newFrameReader(br *bufio.Reader, magic string) (*frameReader, error) {
+	fr := &frameReader{br: br, r: &crcReader{reader: br, crc: crc32.NewIEEE()}}
+	header := make([]byte, headerLen)
+	if _, err := io.ReadFull(fr.r, header); err != nil {
+		return nil, fmt.Errorf("%w, failed to read header, err: %v", ErrCorrupt, err)
+	}
+	if string(header[:len(magic)]) != magic {
+		return nil, fmt.Errorf("%w, bad magic %q", ErrCorrupt, header[:len(magic)])
+	}
+	fr.version = binary.BigEndian.Uint16(header[len(magic):])
+	if fr.version > SnapshotVersion {
+		return nil, fmt.Errorf("Unsupported snapshot version %d", fr.version)
+	}
+	fr.count = binary.BigEndian.Uint64(header[len(magic)+2:])
+	return fr, nil
+}
+
+// next reports whether a record follows, checking the trailer after the
+// last one.
+func (fr *frameReader) next() (bool, error) {
+	if fr.read < fr.count {
+		fr.read++
+		return true, nil
+	}
+	sum := fr.r.crc.Sum32()
+	trailer := make([]byte, 4)
+	if _, err := io.ReadFull(fr.br, trailer); err != nil {
+		return false, fmt.Errorf("%w, failed to read checksum, err: %v", ErrCorrupt, err)
+	}
+	if got := binary.BigEndian.Uint32(trailer); got != sum {
+		return false, fmt.Errorf("%w, checksum %08x, want %08x", ErrCorrupt, got, sum)
+	}
+	return false, nil
+}
+
+func (fr *frameReader) corrupt(err error) error {
+	return fmt.Errorf("%w, failed to decode record %d of %d, err: %v", ErrCorrupt, fr.read, fr.count, err)
+}
+
+// crcReader sums the bytes read through it. It is an io.ByteReader, so the
+// gob decoder reads no further than the records.
+type crcReader struct {
+	reader *bufio.Reader
+	crc    hash.Hash32
+}
+
+func (cr *crcReader) Read(p []byte) (int, error) {
+	n, err := cr.reader.Read(p)
+	cr.crc.Write(p[:n])
+	return n, err
+}
+
+func (cr *crcReader) ReadByte() (byte, error) {
+	b, err := cr.reader.ReadByte()
+	if err == nil {
+		cr.crc.Write([]byte{b})
+	}
+	return b, err
+}
+
+type gobCodec struct{}
+
+func (gobCodec) Name() string {
+	return "gob"
+}
+
+func (gobCodec) NewWriter(writer io.Writer, count int) (RecordWriter, error) {
+	fw, err := newFrameWriter(writer, gobMagic, count)
+	if err != nil {
+		return nil, err
+	}
+	return &gobWriter{frameWriter: fw, enc: gob.NewEncoder(fw.w)}, nil
+}
+
+func (gobCodec) NewReader(reader io.Reader) (RecordReader, error) {
+	br := bufio.NewReader(reader)
+	if !hasMagic(br, gobMagic) {
+		return &legacyReader{dec: gob.NewDecoder(br)}, nil
+	}
+	fr, err := newFrameReader(br, gobMagic)
+	if err != nil {
+		return nil, err
+	}
+	return &gobReader{frameReader: fr, dec: gob.NewDecoder(fr.r)}, nil
+}
+
+type gobWriter struct {
+	*frameWriter
+	enc *gob.Encoder
+}
+
+func (gw *gobWriter) Write(fileNode *FileNode) error {
+	gw.written++
+	return gw.enc.Encode(fileNode)
+}
+
+type gobReader struct {
+	*frameReader
+	dec *gob.Decoder
+}
+
+func (gr *gobReader) Read(fileNode *FileNode) error {
+	if ok, err := gr.next(); !ok {
+		if err == nil {
+			err = io.EOF
+		}
+		return err
+	}
+	if err := gr.dec.Decode(fileNode); err != nil {
+		return gr.corrupt(err)
+	}
+	return nil
+}
+
+// legacyReader reads the unversioned gob stream, which ends at EOF.
+type legacyReader struct {
+	dec *gob.Decoder
+}
+
+func (lr *legacyReader) Read(fileNode *FileNode) error {
+	err := lr.dec.Decode(fileNode)
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("Failed to decode legacy snapshot, err: %v", err)
+	}
+	return err
+}
+
+type binaryCodec struct{}
+
+func (binaryCodec) Name() string {
+	return "binary"
+}
+
+func (binaryCodec) NewWriter(writer io.Writer, count int) (RecordWriter, error) {
+	fw, err := newFrameWriter(writer, binaryMagic, count)
+	if err != nil {
+		return nil, err
+	}
+	return &binaryWriter{frameWriter: fw}, nil
+}
+
+func (binaryCodec) NewReader(reader io.Reader) (RecordReader, error) {
+	fr, err := newFrameReader(bufio.NewReader(reader), binaryMagic)
+	if err != nil {
+		return nil, err
+	}
+	return &binaryReader{frameReader: fr}, nil
+}
+
+// binaryWriter writes a record as the digest, prefix, payload and media
+// type, each after its length, and the ref, size and times as varints.
+// Times are in nanoseconds since the epoch, zero for none. The number of
+// holders follows, then each holder after its length.
+type binaryWriter struct {
+	*frameWriter
+	buf []byte
+}
+
+func (bw *binaryWriter) Write(fileNode *FileNode) error {
+	b := bw.buf[:0]
+	for _, field := range [][]byte{fileNode.Digest, []byte(fileNode.Prefix), fileNode.Payload, []byte(fileNode.MediaType)} {
+		b = binary.AppendUvarint(b, uint64(len(field)))
+		b = append(b, field...)
+	}
+	b = binary.AppendVarint(b, int64(fileNode.Ref))
+	b = binary.AppendVarint(b, fileNode.Size)
+	for _, t := range []time.Time{fileNode.Created, fileNode.LastIncrement, fileNode.LastDecrement} {
+		b = binary.AppendVarint(b, unixNano(t))
+	}
+	b = binary.AppendUvarint(b, uint64(len(fileNode.Holders)))
+	for _, holder := range fileNode.Holders {
+		b = binary.AppendUvarint(b, uint64(len(holder)))
+		b = append(b, holder...)
+	}
+	bw.buf = b
+	bw.written++
+	_, err := bw.w.Write(b)
+	return err
+}
+
+// maxField bounds the fields read, so a bad length fails instead of
+// allocating it.
+const maxField = 1 << 24
+
+type binaryReader struct {
+	*frameReader
+}
+
+func (br *binaryReader) Read(fileNode *FileNode) error {
+	if ok, err := br.next(); !ok {
+		if err == nil {
+			err = io.EOF
+		}
+		return err
+	}
+	if err := br.decode(fileNode); err != nil {
+		return br.corrupt(err)
+	}
+	return nil
+}
+
+func (br *binaryReader) decode(fileNode *FileNode) error {
+	var fields [4][]byte
+	for i := range fields {
+		field, err := br.field()
+		if err != nil {
+			return err
+		}
+		fields[i] = field
+	}
+	fileNode.Digest, fileNode.Prefix = fields[0], string(fields[1])
+	fileNode.Payload, fileNode.MediaType = fields[2], string(fields[3])
+	var ints [5]int64
+	for i := range ints {
+		v, err := binary.ReadVarint(br.r)
+		if err != nil {
+			return err
+		}
+		ints[i] = v
+	}
+	fileNode.Ref, fileNode.Size = int(ints[0]), ints[1]
+	fileNode.Created, fileNode.LastIncrement, fileNode.LastDecrement = fromUnixNano(ints[2]), fromUnixNano(ints[3]), fromUnixNano(ints[4])
+	fileNode.Holders = nil
+	if br.version < 2 {
+		return nil
+	}
+	n, err := binary.ReadUvarint(br.r)
+	if err != nil {
+		return err
+	}
+	if n > maxField {
+		return fmt.Errorf("%d holders", n)
+	}
+	for ; n > 0; n-- {
+		holder, err := br.field()
+		if err != nil {
+			return err
+		}
+		fileNode.Holders = append(fileNode.Holders, string(holder))
+	}
+	return nil
+}
+
+// field reads a length and that many bytes, nil for none.
+func (br *binaryReader) field() ([]byte, error) {
+	n, err := binary.ReadUvarint(br.r)
+	if err != nil {
+		return nil, err
+	}
+	if n > maxField {
+		return nil, fmt.Errorf("field of %d bytes", n)
+	}
+	if n == 0 {
+		return nil, nil
+	}
+	field := make([]byte, n)
+	if _, err := io.ReadFull(br.r, field); err != nil {
+		return nil, err
+	}
+	return field, nil
+}
+
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func fromUnixNano(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
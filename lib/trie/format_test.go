@@ -0,0 +1,81 @@
+package trie
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+
+	"gopkg.in/check.v1"
+)
+
+var _ = check.Suite(&FormatSuites{})
+
+type FormatSuites struct {
+}
+
+func (fs *FormatSuites) saved(c *check.C) ([]byte, *RefTrie) {
+	tr := CreateTrie()
+	for _, k := range []string{"00AA", "3FA", "3FA9", "3FA9", "A000"} {
+		c.Assert(tr.Insert(k), check.IsNil)
+	}
+	buf := &bytes.Buffer{}
+	c.Assert(tr.Save(buf), check.IsNil)
+	return buf.Bytes(), tr
+}
+
+func (fs *FormatSuites) TestHeader(c *check.C) {
+	data, _ := fs.saved(c)
+	c.Assert(string(data[:4]), check.Equals, gobMagic)
+	c.Assert(data[4:headerLen], check.DeepEquals, []byte{0, SnapshotVersion, 0, 0, 0, 0, 0, 0, 0, 4})
+
+	empty := &bytes.Buffer{}
+	c.Assert(CreateTrie().Save(empty), check.IsNil)
+	c.Assert(empty.Len(), check.Equals, headerLen+4)
+	tr := CreateTrie()
+	c.Assert(tr.Load(empty), check.IsNil)
+	c.Assert(tr.Len(), check.Equals, 0)
+}
+
+func (fs *FormatSuites) TestTruncated(c *check.C) {
+	data, _ := fs.saved(c)
+	for _, n := range []int{5, headerLen, headerLen + 3, len(data) / 2, len(data) - 1} {
+		tr := CreateTrie()
+		err := tr.Load(bytes.NewReader(data[:n]))
+		c.Assert(errors.Is(err, ErrCorrupt), check.Equals, true, check.Commentf("cut at %d: %v", n, err))
+		c.Assert(tr.Len(), check.Equals, 0)
+	}
+}
+
+func (fs *FormatSuites) TestCorrupted(c *check.C) {
+	data, _ := fs.saved(c)
+	for _, i := range []int{headerLen - 1, len(data) - 8, len(data) - 1} {
+		bad := append([]byte(nil), data...)
+		bad[i] ^= 0x01
+		tr := CreateTrie()
+		err := tr.Load(bytes.NewReader(bad))
+		c.Assert(errors.Is(err, ErrCorrupt), check.Equals, true, check.Commentf("flipped %d: %v", i, err))
+		c.Assert(tr.Len(), check.Equals, 0)
+	}
+
+	bad := append([]byte(nil), data...)
+	bad[5] = SnapshotVersion + 1
+	err := CreateTrie().Load(bytes.NewReader(bad))
+	c.Assert(err, check.ErrorMatches, "Unsupported snapshot version.*")
+}
+
+func (fs *FormatSuites) TestLegacy(c *check.C) {
+	_, tr := fs.saved(c)
+	// the bare gob stream written before the format was versioned.
+	buf := &bytes.Buffer{}
+	enc := gob.NewEncoder(buf)
+	for _, fn := range []FileNode{{Digest: []byte{0x00, 0xaa}, Ref: 1}, {Prefix: "3FA", Ref: 1}, {Digest: []byte{0x3f, 0xa9}, Ref: 2}, {Digest: []byte{0xa0, 0x00}, Ref: 1}} {
+		c.Assert(enc.Encode(fn), check.IsNil)
+	}
+	loaded := CreateTrie()
+	c.Assert(loaded.Load(buf), check.IsNil)
+	c.Assert(loaded.Len(), check.Equals, tr.Len())
+	ref, err := loaded.GetRef("3FA9")
+	c.Assert(err, check.IsNil)
+	c.Assert(ref, check.Equals, 2)
+	c.Assert(CreateTrie().Load(bytes.NewReader(nil)), check.IsNil)
+}
@@ -0,0 +1,284 @@
+package trie
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	trie "trie/lib/suffix"
+)
+
+// Frozen is a read-only trie mapped from a file written by WriteFrozen.
+// Lookups read the file directly, nothing is decoded up front. Every key
+// keeps its ref, payload, metadata and holders, so MetaSelector works on
+// it as on a Trie.
+type Frozen[P any] struct {
+	root *trie.Frozen
+}
+
+// WriteFrozen writes a snapshot of the trie in the frozen layout, see
+// OpenFrozen.
+func (tr *Trie[P]) WriteFrozen(writer io.Writer) error {
+	if tr.closed() {
+		return ErrClosed
+	}
+	snap := tr.Snapshot()
+	defer snap.Release()
+	return snap.WriteFrozen(writer)
+}
+
+// WriteFrozen writes the snapshot in the frozen layout, which has a single
+// root, so the stripes of a striped snapshot are copied into one trie
+// first.
+func (s *Snapshot[P]) WriteFrozen(writer io.Writer) error {
+	return s.joined().WriteFrozen(writer, encodeNodeInfo[P])
+}
+
+func OpenFrozen[P any](path string) (*Frozen[P], error) {
+	root, err := trie.OpenFrozen(path, trie.HexAlphabet)
+	if err != nil {
+		return nil, err
+	}
+	return &Frozen[P]{root: root}, nil
+}
+
+func (f *Frozen[P]) Close() error {
+	return f.root.Close()
+}
+
+func (f *Frozen[P]) Len() int {
+	return f.root.Len()
+}
+
+func (f *Frozen[P]) GetRef(key string) (int, error) {
+	node, err := f.get(key)
+	if err != nil {
+		return -1, err
+	}
+	return node.ref, nil
+}
+
+func (f *Frozen[P]) GetPayload(key string) (P, error) {
+	node, err := f.get(key)
+	if err != nil {
+		var payload P
+		return payload, err
+	}
+	return node.payload, nil
+}
+
+// Select runs selector over the keys starting with prefix.
+func (f *Frozen[P]) Select(prefix string, selector Selector[P]) error {
+	return f.WalkPrefix(prefix, func(key string, node *NodeInfo[P]) error {
+		if selector.Check(key, node) {
+			return selector.Get(key, node)
+		}
+		return nil
+	})
+}
+
+// WalkPrefix walks the keys starting with prefix in key order, decoding
+// each one for walker. Walker may return SkipSubtree or StopWalk.
+func (f *Frozen[P]) WalkPrefix(prefix string, walker trie.WalkFunc[*NodeInfo[P]]) error {
+	return f.root.WalkPrefix(prefix, func(key string, value []byte) error {
+		node, err := decodeNodeInfo[P](value)
+		if err != nil {
+			return fmt.Errorf("Failed to decode %s, err: %w", key, err)
+		}
+		return walker(key, node)
+	})
+}
+
+// Iterator returns an unpositioned iterator over all keys, see
+// FrozenIterator.
+func (f *Frozen[P]) Iterator() *FrozenIterator[P] {
+	return &FrozenIterator[P]{it: f.root.Iterator()}
+}
+
+// FrozenIterator pages through the keys of a Frozen in key order, decoding
+// every key it stops at. A key which fails to decode ends the move, Err
+// tells why.
+type FrozenIterator[P any] struct {
+	it   *trie.FrozenIterator
+	node *NodeInfo[P]
+	key  string
+	err  error
+}
+
+// First moves to the smallest key.
+func (it *FrozenIterator[P]) First() bool {
+	return it.move(it.it.First())
+}
+
+// Next moves to the following key. An unpositioned iterator moves to the
+// first key.
+func (it *FrozenIterator[P]) Next() bool {
+	return it.move(it.it.Next())
+}
+
+// Seek moves to the smallest key not less than key.
+func (it *FrozenIterator[P]) Seek(key string) bool {
+	return it.move(it.it.Seek(key))
+}
+
+// Err reports the key the last move failed to decode.
+func (it *FrozenIterator[P]) Err() error {
+	return it.err
+}
+
+func (it *FrozenIterator[P]) Valid() bool {
+	return it.node != nil
+}
+
+func (it *FrozenIterator[P]) Key() string {
+	return it.key
+}
+
+// Node returns the state of the current key, nil when there is none.
+func (it *FrozenIterator[P]) Node() *NodeInfo[P] {
+	return it.node
+}
+
+func (it *FrozenIterator[P]) Ref() int {
+	if it.node == nil {
+		return 0
+	}
+	return it.node.ref
+}
+
+func (it *FrozenIterator[P]) Payload() P {
+	if it.node == nil {
+		var payload P
+		return payload
+	}
+	return it.node.payload
+}
+
+func (it *FrozenIterator[P]) move(ok bool) bool {
+	it.node, it.key, it.err = nil, "", nil
+	if !ok {
+		return false
+	}
+	node, err := decodeNodeInfo[P](it.it.Value())
+	if err != nil {
+		it.err = fmt.Errorf("Failed to decode %s, err: %w", it.it.Key(), err)
+		return false
+	}
+	it.node, it.key = node, it.it.Key()
+	return true
+}
+
+func (f *Frozen[P]) get(key string) (*NodeInfo[P], error) {
+	value, ok, err := f.root.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w %s", ErrNotFound, key)
+	}
+	node, err := decodeNodeInfo[P](value)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode %s, err: %w", key, err)
+	}
+	return node, nil
+}
+
+// encodeNodeInfo stores the ref, size and times as varints, the media
+// type and every holder after its length with the number of holders
+// first, and the marshaled payload in the rest. Times are in nanoseconds
+// since the epoch, zero for none, as in the binary codec.
+func encodeNodeInfo[P any](node *NodeInfo[P]) ([]byte, error) {
+	payload, err := marshalPayload(node.payload)
+	if err != nil {
+		return nil, err
+	}
+	b := binary.AppendVarint(nil, int64(node.ref))
+	b = binary.AppendVarint(b, node.size)
+	for _, t := range []time.Time{node.created, node.incremented, node.decremented} {
+		b = binary.AppendVarint(b, unixNano(t))
+	}
+	b = binary.AppendUvarint(b, uint64(len(node.mediaType)))
+	b = append(b, node.mediaType...)
+	b = binary.AppendUvarint(b, uint64(len(node.holders)))
+	for _, holder := range node.holders {
+		b = binary.AppendUvarint(b, uint64(len(holder)))
+		b = append(b, holder...)
+	}
+	return append(b, payload...), nil
+}
+
+func decodeNodeInfo[P any](data []byte) (*NodeInfo[P], error) {
+	d := &frozenDecoder{data: data}
+	var ints [5]int64
+	for i := range ints {
+		ints[i] = d.varint()
+	}
+	node := &NodeInfo[P]{
+		ref:         int(ints[0]),
+		size:        ints[1],
+		created:     fromUnixNano(ints[2]),
+		incremented: fromUnixNano(ints[3]),
+		decremented: fromUnixNano(ints[4]),
+		mediaType:   d.field(),
+	}
+	for n := d.uvarint(); n > 0 && d.err == nil; n-- {
+		node.holders = append(node.holders, d.field())
+	}
+	if d.err != nil {
+		return nil, fmt.Errorf("Bad node info in %x, err: %v", data, d.err)
+	}
+	// the payload may keep its bytes, which must not point into the file.
+	payload := append([]byte(nil), d.data...)
+	if err := unmarshalPayload(payload, &node.payload); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+// frozenDecoder reads the fields of encodeNodeInfo off the front of data.
+// After the first bad field it reads zeros and keeps the error.
+type frozenDecoder struct {
+	data []byte
+	err  error
+}
+
+func (d *frozenDecoder) varint() int64 {
+	v, n := binary.Varint(d.data)
+	if d.err == nil && n <= 0 {
+		d.err = errors.New("bad varint")
+	}
+	if d.err != nil {
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *frozenDecoder) uvarint() uint64 {
+	v, n := binary.Uvarint(d.data)
+	if d.err == nil && n <= 0 {
+		d.err = errors.New("bad uvarint")
+	}
+	if d.err != nil {
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+// field reads a length and a string of that many bytes, copied out of
+// the file.
+func (d *frozenDecoder) field() string {
+	n := d.uvarint()
+	if d.err == nil && n > uint64(len(d.data)) {
+		d.err = fmt.Errorf("field of %d bytes", n)
+	}
+	if d.err != nil {
+		return ""
+	}
+	field := string(d.data[:n])
+	d.data = d.data[n:]
+	return field
+}
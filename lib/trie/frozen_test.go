@@ -0,0 +1,160 @@
+package trie
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/check.v1"
+	trie "trie/lib/suffix"
+)
+
+var _ = check.Suite(&FrozenSuites{})
+
+type FrozenSuites struct {
+}
+
+func (fs *FrozenSuites) TestOpenFrozen(c *check.C) {
+	tr := NewTrie[testPayload]()
+	for _, k := range []string{"00AA", "0F", "3FA9", "3FA9", "3FA9C1", "A000"} {
+		c.Assert(tr.Insert(k), check.IsNil)
+	}
+	c.Assert(tr.SetPayload("3FA9C1", testPayload{size: 300}), check.IsNil)
+
+	path := filepath.Join(c.MkDir(), "frozen")
+	file, err := os.Create(path)
+	c.Assert(err, check.IsNil)
+	c.Assert(tr.WriteFrozen(file), check.IsNil)
+	c.Assert(file.Close(), check.IsNil)
+
+	f, err := OpenFrozen[testPayload](path)
+	c.Assert(err, check.IsNil)
+	defer f.Close()
+	c.Assert(f.Len(), check.Equals, 5)
+	ref, err := f.GetRef("3fa9")
+	c.Assert(err, check.IsNil)
+	c.Assert(ref, check.Equals, 2)
+	payload, err := f.GetPayload("3FA9C1")
+	c.Assert(err, check.IsNil)
+	c.Assert(payload.size, check.Equals, uint32(300))
+	_, err = f.GetRef("3FA")
+	c.Assert(errors.Is(err, ErrNotFound), check.Equals, true)
+
+	psl := &payloadSelector{sizes: make(map[string]uint32)}
+	c.Assert(f.Select("3F", psl), check.IsNil)
+	c.Assert(psl.sizes, check.DeepEquals, map[string]uint32{"3FA9C1": 300})
+}
+
+func (fs *FrozenSuites) TestFrozenMeta(c *check.C) {
+	tr := CreateTrie(WithHolders())
+	c.Assert(tr.Insert("00AA"), check.IsNil)
+	_, err := tr.AddRef("3FA9", "img1")
+	c.Assert(err, check.IsNil)
+	c.Assert(tr.SetMeta("3FA9", 10, "layer"), check.IsNil)
+
+	path := filepath.Join(c.MkDir(), "frozen")
+	file, err := os.Create(path)
+	c.Assert(err, check.IsNil)
+	c.Assert(tr.WriteFrozen(file), check.IsNil)
+	c.Assert(file.Close(), check.IsNil)
+	f, err := OpenFrozen[struct{}](path)
+	c.Assert(err, check.IsNil)
+	defer f.Close()
+
+	selected := func(ms *MetaSelector[struct{}]) map[string]*RefNodeInfo {
+		nodes := make(map[string]*RefNodeInfo)
+		ms.Visit = func(prefix string, node *RefNodeInfo) error {
+			nodes[prefix] = node
+			return nil
+		}
+		c.Assert(f.Select("", ms), check.IsNil)
+		return nodes
+	}
+	nodes := selected(&MetaSelector[struct{}]{MediaType: "layer"})
+	c.Assert(nodes, check.HasLen, 1)
+	node := nodes["3FA9"]
+	c.Assert(node, check.NotNil)
+	c.Assert(node.Size(), check.Equals, int64(10))
+	c.Assert(node.Holders(), check.DeepEquals, []string{"img1"})
+	c.Assert(node.Created().IsZero(), check.Equals, false)
+	c.Assert(node.LastDecrement().IsZero(), check.Equals, true)
+
+	now := time.Now()
+	c.Assert(selected(&MetaSelector[struct{}]{CreatedBefore: now.Add(-time.Hour)}), check.HasLen, 0)
+	c.Assert(selected(&MetaSelector[struct{}]{CreatedBefore: now.Add(time.Hour)}), check.HasLen, 2)
+}
+
+func (fs *FrozenSuites) TestDecodeNodeInfo(c *check.C) {
+	node := &RefNodeInfo{ref: 3, mediaType: "layer", holders: []string{"a", "bc"}}
+	data, err := encodeNodeInfo(node)
+	c.Assert(err, check.IsNil)
+	decoded, err := decodeNodeInfo[struct{}](data)
+	c.Assert(err, check.IsNil)
+	c.Assert(decoded, check.DeepEquals, node)
+	for i := range data {
+		_, err := decodeNodeInfo[struct{}](data[:i])
+		c.Assert(err, check.NotNil, check.Commentf("%d bytes", i))
+	}
+}
+
+func (fs *FrozenSuites) TestFrozenIterator(c *check.C) {
+	tr := NewTrie[testPayload]()
+	for _, k := range []string{"00AA", "0F", "3FA9", "3FA9", "3FA9C1", "A000"} {
+		c.Assert(tr.Insert(k), check.IsNil)
+	}
+	c.Assert(tr.SetPayload("3FA9C1", testPayload{size: 300}), check.IsNil)
+	path := filepath.Join(c.MkDir(), "frozen")
+	file, err := os.Create(path)
+	c.Assert(err, check.IsNil)
+	c.Assert(tr.WriteFrozen(file), check.IsNil)
+	c.Assert(file.Close(), check.IsNil)
+	f, err := OpenFrozen[testPayload](path)
+	c.Assert(err, check.IsNil)
+	defer f.Close()
+
+	refs := make(map[string]int)
+	it := f.Iterator()
+	for it.Next() {
+		refs[it.Key()] = it.Ref()
+	}
+	c.Assert(it.Err(), check.IsNil)
+	c.Assert(refs, check.DeepEquals, map[string]int{"00AA": 1, "0F": 1, "3FA9": 2, "3FA9C1": 1, "A000": 1})
+
+	c.Assert(it.Seek("3fa9c"), check.Equals, true)
+	c.Assert(it.Key(), check.Equals, "3FA9C1")
+	c.Assert(it.Payload().size, check.Equals, uint32(300))
+	c.Assert(it.Node().Created().IsZero(), check.Equals, false)
+	c.Assert(it.Next(), check.Equals, true)
+	c.Assert(it.Key(), check.Equals, "A000")
+	c.Assert(it.Next(), check.Equals, false)
+	c.Assert(it.Valid(), check.Equals, false)
+	c.Assert(it.Seek("B"), check.Equals, false)
+
+	var keys []string
+	err = f.WalkPrefix("3F", func(key string, node *NodeInfo[testPayload]) error {
+		keys = append(keys, key)
+		return StopWalk
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(keys, check.DeepEquals, []string{"3FA9"})
+}
+
+func (fs *FrozenSuites) TestFrozenDecodeFails(c *check.C) {
+	root := trie.NewTrie[int](trie.HexAlphabet)
+	_, err := root.Put("3FA9", 1)
+	c.Assert(err, check.IsNil)
+	frozen, err := root.Freeze(func(int) ([]byte, error) {
+		return []byte{0x80}, nil
+	})
+	c.Assert(err, check.IsNil)
+	f := &Frozen[struct{}]{root: frozen}
+
+	it := f.Iterator()
+	c.Assert(it.First(), check.Equals, false)
+	c.Assert(it.Err(), check.ErrorMatches, "Failed to decode 3FA9.*")
+	err = f.WalkPrefix("", func(key string, node *RefNodeInfo) error {
+		return nil
+	})
+	c.Assert(err, check.ErrorMatches, "Failed to decode 3FA9.*")
+}
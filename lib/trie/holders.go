@@ -0,0 +1,282 @@
+package trie
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// ErrNoHolders is returned by the holder calls of a trie created without
+// WithHolders.
+var ErrNoHolders = errors.New("Trie keeps no holders")
+
+// WithHolders lets named holders reference keys with AddRef and Release.
+// The ref of a key counts its holders next to the references taken by
+// Insert, which Delete and Update cannot take below the holder count, so
+// a holder releasing twice does not drop the reference of another.
+func WithHolders() Option {
+	return func(o *options) {
+		o.holders = true
+	}
+}
+
+// Holders returns the holders of the key in order.
+func (n *NodeInfo[P]) Holders() []string {
+	return append([]string(nil), n.holders...)
+}
+
+// anonymous returns the references taken without a holder.
+func (n *NodeInfo[P]) anonymous() int {
+	return n.ref - len(n.holders)
+}
+
+// AddRef takes a reference to key for holder and reports whether holder
+// did not hold it yet. Adding a holder twice changes nothing.
+func (tr *Trie[P]) AddRef(key, holder string) (bool, error) {
+	key, err := tr.checkHolder(key, holder)
+	if err != nil {
+		return false, err
+	}
+	s := tr.stripeOf(key)
+	defer tr.notifier.flush()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	node, ok, err := s.root.Get(key)
+	if err != nil {
+		return false, err
+	}
+	now := timeNow()
+	info := &NodeInfo[P]{created: now}
+	if ok {
+		if hasHolder(node.holders, holder) {
+			return false, nil
+		}
+		info = node.clone()
+	}
+	info.holders = addHolder(info.holders, holder)
+	info.ref++
+	info.incremented = now
+	if _, err := s.root.Put(key, info); err != nil {
+		return false, err
+	}
+	s.hold(holder, key)
+	s.notifier.push(key, info.ref-1, info.ref)
+	return true, nil
+}
+
+// Release drops the reference holder has to key and reports whether the
+// key went with it. Releasing what holder does not hold changes nothing,
+// strict tries report it with ErrNotFound.
+func (tr *Trie[P]) Release(key, holder string) (bool, error) {
+	key, err := tr.checkHolder(key, holder)
+	if err != nil {
+		return false, err
+	}
+	s := tr.stripeOf(key)
+	defer tr.notifier.flush()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	node, ok, err := s.root.Get(key)
+	if err != nil {
+		return false, err
+	}
+	if !ok || !hasHolder(node.holders, holder) {
+		if s.strict {
+			return false, fmt.Errorf("%w %s held by %s", ErrNotFound, key, holder)
+		}
+		return false, nil
+	}
+	info := node.clone()
+	info.holders = removeHolder(info.holders, holder)
+	info.ref--
+	info.decremented = timeNow()
+	deleted := false
+	if info.ref > 0 {
+		_, err = s.root.Put(key, info)
+	} else {
+		deleted, err = s.root.Delete(key)
+	}
+	if err != nil {
+		return false, err
+	}
+	s.unhold(holder, key)
+	s.notifier.push(key, node.ref, info.ref)
+	return deleted, nil
+}
+
+// Holders returns the holders of key in order.
+func (tr *Trie[P]) Holders(key string) ([]string, error) {
+	if !tr.keepsHolders() {
+		return nil, ErrNoHolders
+	}
+	s := tr.stripeOf(key)
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	node, ok, err := s.root.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w %s", ErrNotFound, key)
+	}
+	return node.Holders(), nil
+}
+
+// HeldBy returns the keys holder references in key order.
+func (tr *Trie[P]) HeldBy(holder string) ([]string, error) {
+	if !tr.keepsHolders() {
+		return nil, ErrNoHolders
+	}
+	tr.rlockAll()
+	defer tr.runlockAll()
+	var keys []string
+	for _, s := range tr.stripes {
+		start := len(keys)
+		for key := range s.held[holder] {
+			keys = append(keys, key)
+		}
+		part := keys[start:]
+		sort.Slice(part, func(i, j int) bool {
+			return tr.alphabet.Compare(part[i], part[j]) < 0
+		})
+	}
+	return keys, nil
+}
+
+func (tr *Trie[P]) keepsHolders() bool {
+	return tr.stripes[0].holders
+}
+
+// checkHolder returns the canonical key. Holders are neither empty nor
+// hold white space, so they can be listed in text files.
+func (tr *Trie[P]) checkHolder(key, holder string) (string, error) {
+	if !tr.keepsHolders() {
+		return "", ErrNoHolders
+	}
+	if err := validHolder(holder); err != nil {
+		return "", err
+	}
+	return tr.alphabet.Canonical(key)
+}
+
+func validHolder(holder string) error {
+	if len(holder) == 0 || strings.IndexFunc(holder, unicode.IsSpace) >= 0 {
+		return fmt.Errorf("%w holder %q", ErrInvalidKey, holder)
+	}
+	return nil
+}
+
+// The holders of a node are a sorted slice, which is replaced and never
+// changed since snapshots share it.
+
+func hasHolder(holders []string, holder string) bool {
+	i := sort.SearchStrings(holders, holder)
+	return i < len(holders) && holders[i] == holder
+}
+
+func addHolder(holders []string, holder string) []string {
+	i := sort.SearchStrings(holders, holder)
+	added := make([]string, 0, len(holders)+1)
+	added = append(added, holders[:i]...)
+	added = append(added, holder)
+	return append(added, holders[i:]...)
+}
+
+func removeHolder(holders []string, holder string) []string {
+	i := sort.SearchStrings(holders, holder)
+	if len(holders) == 1 {
+		return nil
+	}
+	removed := make([]string, 0, len(holders)-1)
+	removed = append(removed, holders[:i]...)
+	return append(removed, holders[i+1:]...)
+}
+
+// unionHolders returns the holders of a and b and how many both have.
+func unionHolders(a, b []string) ([]string, int) {
+	if len(b) == 0 {
+		return a, 0
+	}
+	if len(a) == 0 {
+		return b, 0
+	}
+	union := make([]string, 0, len(a)+len(b))
+	both := 0
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] < b[j]:
+			union = append(union, a[i])
+			i++
+		case a[i] > b[j]:
+			union = append(union, b[j])
+			j++
+		default:
+			union = append(union, a[i])
+			i, j, both = i+1, j+1, both+1
+		}
+	}
+	union = append(union, a[i:]...)
+	return append(union, b[j:]...), both
+}
+
+// sumRefs adds the refs of b to a clone of a. A holder of both is
+// counted once.
+func sumRefs[P any](a, b *NodeInfo[P]) *NodeInfo[P] {
+	info := a.clone()
+	var both int
+	info.holders, both = unionHolders(a.holders, b.holders)
+	info.ref += b.ref - both
+	return info
+}
+
+// keepHolders returns info, which is a or b, held by the holders of both,
+// its ref raised to their count if need be. Otherwise the holders of the
+// other side could no longer release their reference.
+func keepHolders[P any](info, a, b *NodeInfo[P]) *NodeInfo[P] {
+	holders, _ := unionHolders(a.holders, b.holders)
+	if len(holders) == len(info.holders) {
+		return info
+	}
+	info = info.clone()
+	info.holders = holders
+	if info.ref < len(holders) {
+		info.ref = len(holders)
+	}
+	return info
+}
+
+func (s *stripe[P]) hold(holder, key string) {
+	keys := s.held[holder]
+	if keys == nil {
+		keys = make(map[string]struct{})
+		s.held[holder] = keys
+	}
+	keys[key] = struct{}{}
+}
+
+func (s *stripe[P]) unhold(holder, key string) {
+	delete(s.held[holder], key)
+	if len(s.held[holder]) == 0 {
+		delete(s.held, holder)
+	}
+}
+
+// reindex rebuilds the keys of the holders after the keys of the stripe
+// were changed wholesale.
+func (tr *Trie[P]) reindex() {
+	if !tr.keepsHolders() {
+		return
+	}
+	for _, s := range tr.stripes {
+		s.held = make(map[string]map[string]struct{})
+		s.root.Walk(func(key string, node *NodeInfo[P]) error {
+			for _, holder := range node.holders {
+				s.hold(holder, key)
+			}
+			return nil
+		})
+	}
+}
@@ -0,0 +1,237 @@
+package trie
+
+import (
+	"bytes"
+	"errors"
+
+	"gopkg.in/check.v1"
+)
+
+var _ = check.Suite(&HolderSuites{})
+
+type HolderSuites struct {
+}
+
+func (hs *HolderSuites) TestAddRelease(c *check.C) {
+	for _, opts := range [][]Option{{WithHolders()}, {WithHolders(), WithLockStriping()}, {WithHolders(), WithBackend(SortedMapBackend)}} {
+		tr := CreateTrie(opts...)
+		added, err := tr.AddRef("3fa9", "build-1")
+		c.Assert(err, check.IsNil)
+		c.Assert(added, check.Equals, true)
+		added, err = tr.AddRef("3FA9", "build-1")
+		c.Assert(err, check.IsNil)
+		c.Assert(added, check.Equals, false)
+		for _, holder := range []string{"build-2", "backup"} {
+			_, err = tr.AddRef("3FA9", holder)
+			c.Assert(err, check.IsNil)
+		}
+		_, err = tr.AddRef("00", "build-1")
+		c.Assert(err, check.IsNil)
+		_, err = tr.AddRef("A0", "build-1")
+		c.Assert(err, check.IsNil)
+		c.Assert(tr.Insert("3FA9"), check.IsNil)
+
+		ref, err := tr.GetRef("3FA9")
+		c.Assert(err, check.IsNil)
+		c.Assert(ref, check.Equals, 4)
+		holders, err := tr.Holders("3FA9")
+		c.Assert(err, check.IsNil)
+		c.Assert(holders, check.DeepEquals, []string{"backup", "build-1", "build-2"})
+		keys, err := tr.HeldBy("build-1")
+		c.Assert(err, check.IsNil)
+		c.Assert(keys, check.DeepEquals, []string{"00", "3FA9", "A0"})
+
+		deleted, err := tr.Release("3FA9", "build-1")
+		c.Assert(err, check.IsNil)
+		c.Assert(deleted, check.Equals, false)
+		deleted, err = tr.Release("3FA9", "build-1")
+		c.Assert(err, check.IsNil)
+		c.Assert(deleted, check.Equals, false)
+		ref, _ = tr.GetRef("3FA9")
+		c.Assert(ref, check.Equals, 3)
+		deleted, err = tr.Release("00", "build-1")
+		c.Assert(err, check.IsNil)
+		c.Assert(deleted, check.Equals, true)
+		_, err = tr.GetRef("00")
+		c.Assert(errors.Is(err, ErrNotFound), check.Equals, true)
+		keys, _ = tr.HeldBy("build-1")
+		c.Assert(keys, check.DeepEquals, []string{"A0"})
+		keys, _ = tr.HeldBy("nobody")
+		c.Assert(keys, check.HasLen, 0)
+	}
+}
+
+func (hs *HolderSuites) TestGuards(c *check.C) {
+	tr := CreateTrie(WithHolders())
+	_, err := tr.AddRef("3FA9", "a")
+	c.Assert(err, check.IsNil)
+	c.Assert(tr.Insert("3FA9"), check.IsNil)
+	_, err = tr.Delete("3FA9")
+	c.Assert(err, check.IsNil)
+	// the ref left is held by a, which only Release drops.
+	_, err = tr.Delete("3FA9")
+	c.Assert(errors.Is(err, ErrRefUnderflow), check.Equals, true)
+	err = tr.Update("3FA9", 0)
+	c.Assert(errors.Is(err, ErrRefUnderflow), check.Equals, true)
+	c.Assert(tr.Update("3FA9", 2), check.IsNil)
+
+	for _, holder := range []string{"", "two words", "tab\t"} {
+		_, err = tr.AddRef("3FA9", holder)
+		c.Assert(errors.Is(err, ErrInvalidKey), check.Equals, true, check.Commentf("holder %q", holder))
+	}
+	_, err = tr.AddRef("3FXX", "a")
+	c.Assert(errors.Is(err, ErrInvalidKey), check.Equals, true)
+
+	plain := CreateTrie()
+	_, err = plain.AddRef("3FA9", "a")
+	c.Assert(err, check.Equals, ErrNoHolders)
+	_, err = plain.HeldBy("a")
+	c.Assert(err, check.Equals, ErrNoHolders)
+
+	// a trie without holders takes the holders of a file as plain refs.
+	buf := bytes.NewBufferString("{\"key\":\"3FA9\",\"ref\":2,\"holders\":[\"a\",\"b\"]}\n")
+	c.Assert(plain.LoadCodec(buf, JSONLCodec), check.IsNil)
+	err = plain.Update("3FA9", -2)
+	c.Assert(err, check.ErrorMatches, "Ref underflow updating 3FA9 to -2")
+	c.Assert(plain.Update("3FA9", 1), check.IsNil)
+	deleted, err := plain.Delete("3FA9")
+	c.Assert(err, check.IsNil)
+	c.Assert(deleted, check.Equals, true)
+
+	strict := CreateTrie(WithHolders(), WithStrict())
+	_, err = strict.Release("3FA9", "a")
+	c.Assert(errors.Is(err, ErrNotFound), check.Equals, true)
+	_, err = strict.AddRef("3FA9", "a")
+	c.Assert(err, check.IsNil)
+	_, err = strict.Release("3FA9", "b")
+	c.Assert(errors.Is(err, ErrNotFound), check.Equals, true)
+
+	tr.Cleanup()
+	_, err = tr.AddRef("3FA9", "a")
+	c.Assert(err, check.Equals, ErrClosed)
+	keys, err := tr.HeldBy("a")
+	c.Assert(err, check.IsNil)
+	c.Assert(keys, check.HasLen, 0)
+}
+
+func (hs *HolderSuites) TestCleanup(c *check.C) {
+	tr := CreateTrie(WithHolders(), WithLockStriping())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			tr.AddRef("3FA9", "a")
+			tr.Holders("3FA9")
+			tr.HeldBy("a")
+		}
+	}()
+	tr.Cleanup()
+	<-done
+	keys, err := tr.HeldBy("a")
+	c.Assert(err, check.IsNil)
+	c.Assert(keys, check.HasLen, 0)
+}
+
+func (hs *HolderSuites) TestEvents(c *check.C) {
+	tr := CreateTrie(WithHolders())
+	r := &recorder{}
+	tr.Observe(r)
+	tr.AddRef("3FA9", "a")
+	tr.AddRef("3FA9", "a")
+	tr.AddRef("3FA9", "b")
+	tr.Release("3FA9", "c")
+	tr.Release("3FA9", "a")
+	tr.Release("3FA9", "b")
+	c.Assert(r.events, check.DeepEquals, []string{
+		"3FA9:0>1", "+3FA9",
+		"3FA9:1>2",
+		"3FA9:2>1",
+		"3FA9:1>0", "-3FA9",
+	})
+}
+
+func (hs *HolderSuites) TestSaveLoad(c *check.C) {
+	tr := CreateTrie(WithHolders())
+	tr.AddRef("3FA9", "b")
+	tr.AddRef("3FA9", "a")
+	tr.AddRef("00", "a")
+	c.Assert(tr.Insert("00"), check.IsNil)
+	for _, codec := range []Codec{GobCodec, BinaryCodec, JSONLCodec, CSVCodec} {
+		comment := check.Commentf("codec %s", codec.Name())
+		buf := &bytes.Buffer{}
+		c.Assert(tr.SaveCodec(buf, codec), check.IsNil, comment)
+		loaded := CreateTrie(WithHolders(), WithLockStriping())
+		c.Assert(loaded.LoadCodec(buf, codec), check.IsNil, comment)
+		holders, err := loaded.Holders("3FA9")
+		c.Assert(err, check.IsNil, comment)
+		c.Assert(holders, check.DeepEquals, []string{"a", "b"}, comment)
+		keys, err := loaded.HeldBy("a")
+		c.Assert(err, check.IsNil, comment)
+		c.Assert(keys, check.DeepEquals, []string{"00", "3FA9"}, comment)
+		ref, _ := loaded.GetRef("00")
+		c.Assert(ref, check.Equals, 2, comment)
+	}
+
+	// holders beyond the ref are refused.
+	_, err := CreateTrie().LoadWith(bytes.NewBufferString("{\"key\":\"3FA9\",\"ref\":1,\"holders\":[\"a\",\"b\"]}\n"), JSONLCodec, LoadOverwrite)
+	c.Assert(err, check.ErrorMatches, "Failed to load 1 of 1 records.*below 2 holders")
+	// csv files written before holders still load.
+	loaded := CreateTrie(WithHolders())
+	c.Assert(loaded.LoadCodec(bytes.NewBufferString("key,ref,size,media_type,created,last_increment,last_decrement,payload\n3FA9,2,0,,,,,\n"), CSVCodec), check.IsNil)
+	ref, _ := loaded.GetRef("3FA9")
+	c.Assert(ref, check.Equals, 2)
+}
+
+func (hs *HolderSuites) TestMergeSum(c *check.C) {
+	tr := CreateTrie(WithHolders())
+	tr.AddRef("3FA9", "a")
+	tr.AddRef("3FA9", "b")
+	other := CreateTrie(WithHolders())
+	other.AddRef("3FA9", "b")
+	other.AddRef("3FA9", "c")
+	c.Assert(other.Insert("3FA9"), check.IsNil)
+	other.AddRef("00", "c")
+
+	buf := &bytes.Buffer{}
+	c.Assert(other.Save(buf), check.IsNil)
+	c.Assert(tr.Merge(other, MergeSum), check.IsNil)
+	holders, _ := tr.Holders("3FA9")
+	c.Assert(holders, check.DeepEquals, []string{"a", "b", "c"})
+	ref, _ := tr.GetRef("3FA9")
+	c.Assert(ref, check.Equals, 4)
+	keys, _ := tr.HeldBy("c")
+	c.Assert(keys, check.DeepEquals, []string{"00", "3FA9"})
+
+	// b holds 3FA9 once however often it is merged in.
+	_, err := tr.LoadWith(buf, GobCodec, LoadMergeSum)
+	c.Assert(err, check.IsNil)
+	ref, _ = tr.GetRef("3FA9")
+	c.Assert(ref, check.Equals, 5)
+	ref, _ = tr.GetRef("00")
+	c.Assert(ref, check.Equals, 1)
+}
+
+func (hs *HolderSuites) TestMergePolicies(c *check.C) {
+	other := CreateTrie(WithHolders())
+	other.AddRef("AA", "img1")
+	for _, policy := range []MergePolicy{MergeMax, MergeTakeOther} {
+		tr := CreateTrie(WithHolders())
+		tr.AddRef("AA", "img0")
+		c.Assert(tr.Insert("AA"), check.IsNil)
+		c.Assert(tr.Merge(other, policy), check.IsNil)
+		holders, _ := tr.Holders("AA")
+		c.Assert(holders, check.DeepEquals, []string{"img0", "img1"}, check.Commentf("%v", policy))
+		keys, _ := tr.HeldBy("img1")
+		c.Assert(keys, check.DeepEquals, []string{"AA"})
+
+		// the holders of the losing side can still release.
+		ref, _ := tr.GetRef("AA")
+		c.Assert(ref >= 2, check.Equals, true)
+		_, err := tr.Release("AA", "img1")
+		c.Assert(err, check.IsNil)
+		_, err = tr.Release("AA", "img0")
+		c.Assert(err, check.IsNil)
+		holders, _ = tr.Holders("AA")
+		c.Assert(holders, check.HasLen, 0)
+	}
+}
@@ -0,0 +1,99 @@
+package trie
+
+import (
+	"errors"
+	"fmt"
+
+	trie "trie/lib/suffix"
+)
+
+// ErrUnsupported is returned by the features the backend of a trie lacks.
+var ErrUnsupported = errors.New("Not supported by the backend")
+
+// Index is the ordered map of keys behind a Trie. Keys are spelled by the
+// alphabet of the index, walks go in alphabet order and honour
+// SkipSubtree and StopWalk like suffix.Trie, which is an Index itself.
+type Index[V any] interface {
+	Alphabet() *trie.Alphabet
+	Get(key string) (V, bool, error)
+	// Put reports whether key is new.
+	Put(key string, value V) (bool, error)
+	Delete(key string) (bool, error)
+	Walk(walker trie.WalkFunc[V]) error
+	WalkPrefix(prefix string, walker trie.WalkFunc[V]) error
+	Len() int
+}
+
+// Backend chooses the Index of a Trie.
+type Backend int
+
+const (
+	// SuffixBackend is the radix trie of lib/suffix. It alone snapshots
+	// without copying and keeps counts and hashes in its nodes.
+	SuffixBackend Backend = iota
+	// PatriciaBackend is the vendored go-patricia trie.
+	PatriciaBackend
+	// SortedMapBackend is a map next to a sorted key slice, a baseline
+	// that is cheap to read and slow to write.
+	SortedMapBackend
+)
+
+func (b Backend) String() string {
+	switch b {
+	case SuffixBackend:
+		return "suffix"
+	case PatriciaBackend:
+		return "patricia"
+	case SortedMapBackend:
+		return "sortedmap"
+	}
+	return fmt.Sprintf("Backend(%d)", int(b))
+}
+
+// Option configures a Trie at creation.
+type Option func(*options)
+
+type options struct {
+	backend Backend
+	striped bool
+	strict  bool
+	holders bool
+}
+
+func WithBackend(backend Backend) Option {
+	return func(o *options) {
+		o.backend = backend
+	}
+}
+
+func newIndex[V any](backend Backend, alphabet *trie.Alphabet) Index[V] {
+	switch backend {
+	case PatriciaBackend:
+		return newPatriciaIndex[V](alphabet)
+	case SortedMapBackend:
+		return newSortedMapIndex[V](alphabet)
+	}
+	return trie.NewTrie[V](alphabet)
+}
+
+// walkSkip runs walker over keys given in order, leaving out the keys
+// below one it answered SkipSubtree for. It returns StopWalk when the walk
+// should end there.
+type walkSkip[V any] struct {
+	walker trie.WalkFunc[V]
+	skip   string
+	skipOn bool
+}
+
+func (w *walkSkip[V]) visit(key string, value V) error {
+	if w.skipOn && len(key) >= len(w.skip) && key[:len(w.skip)] == w.skip {
+		return nil
+	}
+	w.skipOn = false
+	err := w.walker(key, value)
+	if err == trie.SkipSubtree {
+		w.skip, w.skipOn = key, true
+		return nil
+	}
+	return err
+}
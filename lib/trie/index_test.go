@@ -0,0 +1,226 @@
+package trie
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+
+	"gopkg.in/check.v1"
+	trie "trie/lib/suffix"
+)
+
+var _ = check.Suite(&IndexSuites{})
+
+type IndexSuites struct {
+}
+
+var backends = []Backend{SuffixBackend, PatriciaBackend, SortedMapBackend}
+
+func (is *IndexSuites) TestIndex(c *check.C) {
+	keys := []string{"00AA", "0F", "3FA9", "3FA9C1", "3FA9C2", "3FB", "A000"}
+	for _, backend := range backends {
+		comment := check.Commentf("backend %v", backend)
+		index := newIndex[int](backend, trie.HexAlphabet)
+		for i := len(keys) - 1; i >= 0; i-- {
+			isNew, err := index.Put(keys[i], i)
+			c.Assert(err, check.IsNil, comment)
+			c.Assert(isNew, check.Equals, true, comment)
+		}
+		isNew, err := index.Put("3fa9", 9)
+		c.Assert(err, check.IsNil, comment)
+		c.Assert(isNew, check.Equals, false, comment)
+		c.Assert(index.Len(), check.Equals, len(keys), comment)
+		v, ok, err := index.Get("3FA9")
+		c.Assert(err, check.IsNil, comment)
+		c.Assert(ok, check.Equals, true, comment)
+		c.Assert(v, check.Equals, 9, comment)
+		_, err = index.Put("XY", 0)
+		c.Assert(err, check.NotNil, comment)
+
+		var walked []string
+		err = index.Walk(func(key string, v int) error {
+			walked = append(walked, key)
+			if key == "3FA9" {
+				return SkipSubtree
+			}
+			return nil
+		})
+		c.Assert(err, check.IsNil, comment)
+		c.Assert(walked, check.DeepEquals, []string{"00AA", "0F", "3FA9", "3FB", "A000"}, comment)
+
+		walked = nil
+		err = index.WalkPrefix("3f", func(key string, v int) error {
+			walked = append(walked, key)
+			if len(walked) == 3 {
+				return StopWalk
+			}
+			return nil
+		})
+		c.Assert(err, check.IsNil, comment)
+		c.Assert(walked, check.DeepEquals, []string{"3FA9", "3FA9C1", "3FA9C2"}, comment)
+
+		deleted, err := index.Delete("3FA9")
+		c.Assert(err, check.IsNil, comment)
+		c.Assert(deleted, check.Equals, true, comment)
+		deleted, err = index.Delete("3FA9")
+		c.Assert(err, check.IsNil, comment)
+		c.Assert(deleted, check.Equals, false, comment)
+		_, ok, _ = index.Get("3FA9")
+		c.Assert(ok, check.Equals, false, comment)
+		c.Assert(index.Len(), check.Equals, len(keys)-1, comment)
+	}
+}
+
+func (is *IndexSuites) TestRandomIndex(c *check.C) {
+	for _, backend := range backends[1:] {
+		index := newIndex[int](backend, trie.HexAlphabet)
+		want := trie.NewTrie[int](trie.HexAlphabet)
+		for i := 0; i < 3000; i++ {
+			key := fmt.Sprintf("%05X", rand.Intn(1<<16))[:2+i%4]
+			if i%3 == 0 {
+				d1, err1 := index.Delete(key)
+				d2, err2 := want.Delete(key)
+				c.Assert([]interface{}{d1, err1}, check.DeepEquals, []interface{}{d2, err2})
+				continue
+			}
+			n1, _ := index.Put(key, i)
+			n2, _ := want.Put(key, i)
+			c.Assert(n1, check.Equals, n2)
+		}
+		c.Assert(index.Len(), check.Equals, want.Len())
+		var got, all []string
+		index.Walk(func(key string, v int) error {
+			got = append(got, fmt.Sprintf("%s=%d", key, v))
+			return nil
+		})
+		want.Walk(func(key string, v int) error {
+			all = append(all, fmt.Sprintf("%s=%d", key, v))
+			return nil
+		})
+		c.Assert(got, check.DeepEquals, all, check.Commentf("backend %v", backend))
+	}
+}
+
+func (is *IndexSuites) TestOrderOfAlphabet(c *check.C) {
+	// symbols out of byte order are walked in the order of the alphabet.
+	alphabet, err := trie.NewAlphabet("rev", "ba", false)
+	c.Assert(err, check.IsNil)
+	for _, backend := range backends {
+		index := newIndex[int](backend, alphabet)
+		for _, k := range []string{"a", "ab", "b", "ba"} {
+			_, err := index.Put(k, 0)
+			c.Assert(err, check.IsNil)
+		}
+		var walked []string
+		index.Walk(func(key string, v int) error {
+			walked = append(walked, key)
+			return nil
+		})
+		c.Assert(walked, check.DeepEquals, []string{"b", "ba", "a", "ab"}, check.Commentf("backend %v", backend))
+	}
+}
+
+func (is *IndexSuites) TestTrieBackends(c *check.C) {
+	for _, backend := range backends {
+		for _, striped := range []bool{false, true} {
+			comment := check.Commentf("backend %v striped %v", backend, striped)
+			opts := []Option{WithBackend(backend)}
+			if striped {
+				opts = append(opts, WithLockStriping())
+			}
+			tr := NewTrie[testPayload](opts...)
+			for _, k := range []string{"00AA", "0F", "3FA9", "3FA9", "3FA9C1", "A000"} {
+				c.Assert(tr.Insert(k), check.IsNil, comment)
+			}
+			c.Assert(tr.SetPayload("3FA9", testPayload{size: 7}), check.IsNil, comment)
+			c.Assert(tr.Len(), check.Equals, 5, comment)
+			count, err := tr.CountPrefix("3F")
+			c.Assert(err, check.IsNil, comment)
+			c.Assert(count, check.Equals, 2, comment)
+			rank, err := tr.Rank("3FA9C1")
+			c.Assert(err, check.IsNil, comment)
+			c.Assert(rank, check.Equals, 3, comment)
+			key, ref, err := tr.Nth(2)
+			c.Assert(err, check.IsNil, comment)
+			c.Assert([]interface{}{key, ref}, check.DeepEquals, []interface{}{"3FA9", 2}, comment)
+			_, _, err = tr.Nth(5)
+			c.Assert(errors.Is(err, ErrNotFound), check.Equals, true, comment)
+			c.Assert(tr.Sample(10), check.HasLen, 5, comment)
+			_, err = tr.Resolve("3FA")
+			c.Assert(errors.Is(err, ErrAmbiguous), check.Equals, true, comment)
+
+			// snapshots of every backend hold still while the trie changes.
+			snap := tr.Snapshot()
+			d, err := tr.Delete("0F")
+			c.Assert(err, check.IsNil, comment)
+			c.Assert(d, check.Equals, true, comment)
+			ref, err = snap.GetRef("0F")
+			c.Assert(err, check.IsNil, comment)
+			c.Assert(ref, check.Equals, 1, comment)
+			snap.Release()
+
+			it := tr.Iterator()
+			var keys []string
+			for ok := it.First(); ok; ok = it.Next() {
+				keys = append(keys, it.Key())
+			}
+			c.Assert(keys, check.DeepEquals, []string{"00AA", "3FA9", "3FA9C1", "A000"}, comment)
+
+			buf := &bytes.Buffer{}
+			c.Assert(tr.Save(buf), check.IsNil, comment)
+			for _, other := range backends {
+				loaded := NewTrie[testPayload](WithBackend(other))
+				c.Assert(loaded.Load(bytes.NewReader(buf.Bytes())), check.IsNil, comment)
+				payload, err := loaded.GetPayload("3FA9")
+				c.Assert(err, check.IsNil, comment)
+				c.Assert(payload.size, check.Equals, uint32(7), comment)
+				c.Assert(loaded.Merge(tr, MergeSum), check.IsNil, comment)
+				ref, err := loaded.GetRef("3FA9")
+				c.Assert(err, check.IsNil, comment)
+				c.Assert(ref, check.Equals, 4, comment)
+			}
+
+			err = tr.EnableHash()
+			if backend == SuffixBackend {
+				c.Assert(err, check.IsNil)
+			} else {
+				c.Assert(err, check.Equals, ErrUnsupported, comment)
+				c.Assert(tr.RootHash(), check.IsNil, comment)
+			}
+			tr.Cleanup()
+		}
+	}
+}
+
+func (is *IndexSuites) benchmarkBackend(c *check.C, backend Backend) {
+	keys := make([]string, 20000)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("%016X", rand.Uint64())
+	}
+	c.ResetTimer()
+	for i := 0; i < c.N; i++ {
+		tr := CreateTrie(WithBackend(backend))
+		for _, k := range keys {
+			tr.Insert(k)
+		}
+		for _, k := range keys {
+			tr.GetRef(k)
+		}
+		for _, k := range keys {
+			tr.Delete(k)
+		}
+	}
+}
+
+func (is *IndexSuites) BenchmarkSuffixBackend(c *check.C) {
+	is.benchmarkBackend(c, SuffixBackend)
+}
+
+func (is *IndexSuites) BenchmarkPatriciaBackend(c *check.C) {
+	is.benchmarkBackend(c, PatriciaBackend)
+}
+
+func (is *IndexSuites) BenchmarkSortedMapBackend(c *check.C) {
+	is.benchmarkBackend(c, SortedMapBackend)
+}
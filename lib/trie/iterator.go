@@ -0,0 +1,299 @@
+package trie
+
+import (
+	"sync"
+
+	trie "trie/lib/suffix"
+)
+
+// Iterator pages through the refs of a Trie in key order. Every move takes
+// the trie lock shared only for its own duration, so writers can go on between
+// calls; the iterator picks up after its last key when they did. Iterators
+// of a Snapshot take no lock.
+type Iterator[P any] struct {
+	mutex *sync.RWMutex
+	it    keyIterator[*NodeInfo[P]]
+	// snap is the snapshot an iterator of a Trie runs over and releases
+	// on Close.
+	snap    *Snapshot[P]
+	valid   bool
+	key     string
+	ref     int
+	payload P
+}
+
+// Iterator iterates over the live trie. On backends other than suffix or
+// with striping it iterates over a snapshot, so later writes are not seen,
+// which Close releases. Close every iterator of a Trie once done with it.
+// The iterator of a closed trie has no keys and Err returns ErrClosed.
+func (tr *Trie[P]) Iterator() *Iterator[P] {
+	if tr.closed() {
+		return &Iterator[P]{it: failedIterator[*NodeInfo[P]]{err: ErrClosed}}
+	}
+	s, ok := tr.single()
+	if !ok || tr.backend != SuffixBackend {
+		snap := tr.Snapshot()
+		it := snap.Iterator()
+		it.snap = snap
+		return it
+	}
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	root, _ := s.suffixRoot()
+	return &Iterator[P]{
+		mutex: &s.mutex,
+		it:    root.Iterator(),
+	}
+}
+
+// RangeIterator iterates over the keys in [start, end). An empty end
+// leaves the range open.
+func (tr *Trie[P]) RangeIterator(start, end string) (*Iterator[P], error) {
+	if tr.closed() {
+		return nil, ErrClosed
+	}
+	s, ok := tr.single()
+	if !ok || tr.backend != SuffixBackend {
+		snap := tr.Snapshot()
+		it, err := snap.RangeIterator(start, end)
+		if err != nil {
+			snap.Release()
+			return nil, err
+		}
+		it.snap = snap
+		return it, nil
+	}
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	root, _ := s.suffixRoot()
+	it, err := root.RangeIterator(start, end)
+	if err != nil {
+		return nil, err
+	}
+	return &Iterator[P]{
+		mutex: &s.mutex,
+		it:    it,
+	}, nil
+}
+
+// Close releases the snapshot an iterator of a Trie runs over, after which
+// it must not be used. Iterators of a Snapshot are done with when the
+// snapshot is released. Closing twice does nothing.
+func (it *Iterator[P]) Close() {
+	if it.snap != nil {
+		it.snap.Release()
+		it.snap = nil
+	}
+}
+
+func (it *Iterator[P]) First() bool {
+	return it.move(it.it.First)
+}
+
+func (it *Iterator[P]) Last() bool {
+	return it.move(it.it.Last)
+}
+
+func (it *Iterator[P]) Next() bool {
+	return it.move(it.it.Next)
+}
+
+func (it *Iterator[P]) Prev() bool {
+	return it.move(it.it.Prev)
+}
+
+func (it *Iterator[P]) Seek(key string) bool {
+	return it.move(func() bool {
+		return it.it.Seek(key)
+	})
+}
+
+func (it *Iterator[P]) Err() error {
+	return it.it.Err()
+}
+
+func (it *Iterator[P]) Valid() bool {
+	return it.valid
+}
+
+func (it *Iterator[P]) Key() string {
+	return it.key
+}
+
+func (it *Iterator[P]) Ref() int {
+	return it.ref
+}
+
+func (it *Iterator[P]) Payload() P {
+	return it.payload
+}
+
+func (it *Iterator[P]) move(step func() bool) bool {
+	if it.mutex != nil {
+		it.mutex.RLock()
+		defer it.mutex.RUnlock()
+	}
+	var payload P
+	it.key, it.ref, it.payload = "", 0, payload
+	if it.valid = step(); !it.valid {
+		return false
+	}
+	node := it.it.Value()
+	it.key, it.ref, it.payload = it.it.Key(), node.ref, node.payload
+	return true
+}
+
+// keyIterator is a suffix.Iterator or a stripeIterator.
+type keyIterator[V any] interface {
+	First() bool
+	Last() bool
+	Next() bool
+	Prev() bool
+	Seek(key string) bool
+	Err() error
+	Key() string
+	Value() V
+}
+
+// failedIterator has no keys, err kept it from having any.
+type failedIterator[V any] struct {
+	err error
+}
+
+func (fi failedIterator[V]) First() bool {
+	return false
+}
+
+func (fi failedIterator[V]) Last() bool {
+	return false
+}
+
+func (fi failedIterator[V]) Next() bool {
+	return false
+}
+
+func (fi failedIterator[V]) Prev() bool {
+	return false
+}
+
+func (fi failedIterator[V]) Seek(key string) bool {
+	return false
+}
+
+func (fi failedIterator[V]) Err() error {
+	return fi.err
+}
+
+func (fi failedIterator[V]) Key() string {
+	return ""
+}
+
+func (fi failedIterator[V]) Value() V {
+	var zero V
+	return zero
+}
+
+// stripeIterator runs through the iterators of the stripes of a snapshot
+// one after the other.
+type stripeIterator[V any] struct {
+	its      []*trie.Iterator[V]
+	alphabet *trie.Alphabet
+	cur      int
+	valid    bool
+	err      error
+}
+
+func (si *stripeIterator[V]) First() bool {
+	return si.forward(0, si.its[0].First)
+}
+
+func (si *stripeIterator[V]) Last() bool {
+	last := len(si.its) - 1
+	return si.backward(last, si.its[last].Last)
+}
+
+func (si *stripeIterator[V]) Next() bool {
+	if !si.valid {
+		return si.First()
+	}
+	return si.forward(si.cur, si.its[si.cur].Next)
+}
+
+func (si *stripeIterator[V]) Prev() bool {
+	if !si.valid {
+		return si.Last()
+	}
+	return si.backward(si.cur, si.its[si.cur].Prev)
+}
+
+// Seek looks in the stripe of key first: the keys of the stripes before
+// it all sort before key.
+func (si *stripeIterator[V]) Seek(key string) bool {
+	i := 0
+	if len(key) > 0 {
+		if i = si.alphabet.Index(key[0]); i < 0 {
+			i = 0
+		}
+	}
+	it := si.its[i]
+	ok := it.Seek(key)
+	if si.err = it.Err(); si.err != nil {
+		si.valid = false
+		return false
+	}
+	return si.forward(i, func() bool { return ok })
+}
+
+func (si *stripeIterator[V]) Err() error {
+	return si.err
+}
+
+func (si *stripeIterator[V]) Key() string {
+	if !si.valid {
+		return ""
+	}
+	return si.its[si.cur].Key()
+}
+
+func (si *stripeIterator[V]) Value() V {
+	if !si.valid {
+		var zero V
+		return zero
+	}
+	return si.its[si.cur].Value()
+}
+
+// forward makes the step in stripe i and moves on to the first key of the
+// stripes after it when the step finds no key; an error ends the move.
+func (si *stripeIterator[V]) forward(i int, step func() bool) bool {
+	si.err = nil
+	for ok := step(); !ok; ok = si.its[i].First() {
+		if si.err = si.its[i].Err(); si.err != nil {
+			si.valid = false
+			return false
+		}
+		if i++; i == len(si.its) {
+			si.valid = false
+			return false
+		}
+	}
+	si.cur, si.valid = i, true
+	return true
+}
+
+// backward is forward the other way round.
+func (si *stripeIterator[V]) backward(i int, step func() bool) bool {
+	si.err = nil
+	for ok := step(); !ok; ok = si.its[i].Last() {
+		if si.err = si.its[i].Err(); si.err != nil {
+			si.valid = false
+			return false
+		}
+		if i--; i < 0 {
+			si.valid = false
+			return false
+		}
+	}
+	si.cur, si.valid = i, true
+	return true
+}
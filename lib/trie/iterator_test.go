@@ -0,0 +1,109 @@
+package trie
+
+import (
+	"sort"
+
+	"gopkg.in/check.v1"
+)
+
+var _ = check.Suite(&IteratorSuites{})
+
+type IteratorSuites struct {
+	trie *RefTrie
+	keys []string
+}
+
+func (is *IteratorSuites) SetUpTest(c *check.C) {
+	is.trie = CreateTrie()
+	is.keys = []string{"00AA", "0F", "3FA9", "3FA9C1", "A000", "FFFF"}
+	for i, k := range is.keys {
+		err := is.trie.Update(k, i+1)
+		c.Assert(err, check.IsNil)
+	}
+	sort.Strings(is.keys)
+}
+
+func (is *IteratorSuites) TestPaging(c *check.C) {
+	it := is.trie.Iterator()
+	var keys []string
+	for it.Next() {
+		keys = append(keys, it.Key())
+		ref, err := is.trie.GetRef(it.Key())
+		c.Assert(err, check.IsNil)
+		c.Assert(it.Ref(), check.Equals, ref)
+		// writers are not blocked between two steps.
+		err = is.trie.Insert(it.Key())
+		c.Assert(err, check.IsNil)
+	}
+	c.Assert(keys, check.DeepEquals, is.keys)
+	c.Assert(it.Valid(), check.Equals, false)
+
+	c.Assert(it.Seek("3fa9c"), check.Equals, true)
+	c.Assert(it.Key(), check.Equals, "3FA9C1")
+	c.Assert(it.Ref(), check.Equals, 5)
+	c.Assert(it.Prev(), check.Equals, true)
+	c.Assert(it.Key(), check.Equals, "3FA9")
+}
+
+func (is *IteratorSuites) TestRange(c *check.C) {
+	it, err := is.trie.RangeIterator("0F", "A000")
+	c.Assert(err, check.IsNil)
+	var keys []string
+	for ok := it.Last(); ok; ok = it.Prev() {
+		keys = append(keys, it.Key())
+	}
+	c.Assert(keys, check.DeepEquals, []string{"3FA9C1", "3FA9", "0F"})
+
+	_, err = is.trie.RangeIterator("sha256:", "")
+	c.Assert(err, check.NotNil)
+}
+
+func (is *IteratorSuites) TestStripes(c *check.C) {
+	for _, opts := range [][]Option{{WithLockStriping()}, {WithLockStriping(), WithBackend(PatriciaBackend)}} {
+		tr := CreateTrie(opts...)
+		for i, k := range is.keys {
+			c.Assert(tr.Update(k, i+1), check.IsNil)
+		}
+		it := tr.Iterator()
+		defer it.Close()
+		var keys []string
+		for it.Next() {
+			keys = append(keys, it.Key())
+		}
+		c.Assert(keys, check.DeepEquals, is.keys)
+		keys = nil
+		for it.Prev() {
+			keys = append(keys, it.Key())
+		}
+		c.Assert(keys, check.HasLen, len(is.keys))
+		c.Assert(keys[0], check.Equals, "FFFF")
+
+		c.Assert(it.Seek("3fa9c"), check.Equals, true)
+		c.Assert(it.Key(), check.Equals, "3FA9C1")
+		c.Assert(it.Prev(), check.Equals, true)
+		c.Assert(it.Key(), check.Equals, "3FA9")
+		c.Assert(it.Seek("3FB"), check.Equals, true)
+		c.Assert(it.Key(), check.Equals, "A000")
+		c.Assert(it.Prev(), check.Equals, true)
+		c.Assert(it.Key(), check.Equals, "3FA9C1")
+		c.Assert(it.Seek("sha256:"), check.Equals, false)
+		c.Assert(it.Err(), check.NotNil)
+		// the next move starts over and clears the error.
+		c.Assert(it.Next(), check.Equals, true)
+		c.Assert(it.Key(), check.Equals, is.keys[0])
+		c.Assert(it.Err(), check.IsNil)
+		it.Close()
+		it.Close()
+
+		it, err := tr.RangeIterator("0F", "A000")
+		c.Assert(err, check.IsNil)
+		defer it.Close()
+		keys = nil
+		for ok := it.Last(); ok; ok = it.Prev() {
+			keys = append(keys, it.Key())
+		}
+		c.Assert(keys, check.DeepEquals, []string{"3FA9C1", "3FA9", "0F"})
+		c.Assert(it.Seek("00"), check.Equals, true)
+		c.Assert(it.Key(), check.Equals, "0F")
+	}
+}
@@ -0,0 +1,321 @@
+package trie
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	trie "trie/lib/suffix"
+)
+
+// LoadMode tells LoadWith what to do with the keys of the trie.
+type LoadMode int
+
+const (
+	// LoadOverwrite gives the keys of the file its refs and leaves the
+	// other keys alone. Keys at ref 0 in the file are deleted, as Update
+	// does. Load uses it.
+	LoadOverwrite LoadMode = iota
+	// LoadReplace empties the trie first.
+	LoadReplace
+	// LoadMergeSum adds the refs of the file to those of the trie. Keys
+	// held by both keep the payload and metadata of the trie, keys at ref
+	// 0 in the file change nothing.
+	LoadMergeSum
+	// LoadVerifyOnly decodes the file and reports what LoadOverwrite
+	// would do, without touching the trie.
+	LoadVerifyOnly
+)
+
+func (m LoadMode) String() string {
+	switch m {
+	case LoadOverwrite:
+		return "overwrite"
+	case LoadReplace:
+		return "replace"
+	case LoadMergeSum:
+		return "merge-sum"
+	case LoadVerifyOnly:
+		return "verify-only"
+	}
+	return fmt.Sprintf("LoadMode(%d)", int(m))
+}
+
+// LoadSummary counts the keys of a file against the trie it was loaded
+// into.
+type LoadSummary struct {
+	Records int
+	// Added keys were not in the trie.
+	Added int
+	// Updated keys were in the trie, Conflicting are those of them with a
+	// ref other than the one in the file.
+	Updated     int
+	Conflicting int
+	// Removed keys were dropped by LoadReplace or by records at ref 0.
+	Removed int
+	// Problems are the records which cannot be loaded: bad keys, refs or
+	// payloads and keys given twice. Unless verifying, any of them fails
+	// the load before the trie is changed.
+	Problems []error
+}
+
+// loadRecord is a decoded record keyed by its canonical key. A record at
+// ref 0 has no info and deletes its key.
+type loadRecord[P any] struct {
+	key  string
+	info *NodeInfo[P]
+}
+
+// LoadWith loads the records written with codec in mode and returns what
+// they did to the trie.
+func (tr *Trie[P]) LoadWith(reader io.Reader, codec Codec, mode LoadMode) (*LoadSummary, error) {
+	if mode < LoadOverwrite || mode > LoadVerifyOnly {
+		return nil, fmt.Errorf("Unknown load mode %v", mode)
+	}
+	if tr.closed() {
+		return nil, ErrClosed
+	}
+	fileNodes, err := readAll(codec, reader)
+	if err != nil {
+		return nil, err
+	}
+	records, problems := tr.decodeRecords(fileNodes)
+	if mode == LoadMergeSum {
+		records = withoutDeletions(records)
+	}
+	summary := &LoadSummary{Records: len(fileNodes), Problems: problems}
+	if mode == LoadVerifyOnly {
+		tr.rlockAll()
+		defer tr.runlockAll()
+		tr.compare(records, summary)
+		return summary, nil
+	}
+	if len(problems) > 0 {
+		return summary, fmt.Errorf("Failed to load %d of %d records, first err: %w", len(problems), len(fileNodes), problems[0])
+	}
+
+	defer tr.notifier.flush()
+	tr.lockAll()
+	defer tr.unlockAll()
+	tr.compare(records, summary)
+	if mode == LoadMergeSum {
+		for i := range records {
+			r := &records[i]
+			node, ok, err := tr.stripeOf(r.key).root.Get(r.key)
+			if err != nil {
+				return summary, err
+			}
+			if ok {
+				r.info = sumRefs(node, r.info)
+			}
+		}
+	}
+	changes := tr.loadChanges(records, mode == LoadReplace)
+	if mode == LoadReplace {
+		summary.Removed = tr.len() - summary.Updated
+		tr.clear()
+	}
+	defer tr.reindex()
+	if err := tr.load(records); err != nil {
+		return summary, err
+	}
+	tr.notifier.pushAll(changes)
+	return summary, nil
+}
+
+// decodeRecords turns the records of a file into keys and nodes, listing
+// the records which do not make one.
+func (tr *Trie[P]) decodeRecords(fileNodes []FileNode) ([]loadRecord[P], []error) {
+	records := make([]loadRecord[P], 0, len(fileNodes))
+	seen := make(map[string]bool, len(fileNodes))
+	var problems []error
+	for _, fileNode := range fileNodes {
+		key, err := tr.alphabet.Canonical(fileNode.Prefix)
+		if len(fileNode.Digest) > 0 {
+			key, err = tr.encodeBytes(fileNode.Digest)
+		}
+		if err != nil {
+			problems = append(problems, fmt.Errorf("Failed to load key %q%x, err: %w", fileNode.Prefix, fileNode.Digest, err))
+			continue
+		}
+		if fileNode.Ref < 0 {
+			problems = append(problems, fmt.Errorf("Failed to load %s with ref %d", key, fileNode.Ref))
+			continue
+		}
+		holders, err := loadHolders(fileNode.Holders)
+		if err == nil && fileNode.Ref < len(holders) {
+			err = fmt.Errorf("ref %d below %d holders", fileNode.Ref, len(holders))
+		}
+		if err != nil {
+			problems = append(problems, fmt.Errorf("Failed to load holders of %s, err: %w", key, err))
+			continue
+		}
+		if seen[key] {
+			problems = append(problems, fmt.Errorf("Failed to load %s given twice", key))
+			continue
+		}
+		seen[key] = true
+		if fileNode.Ref == 0 {
+			records = append(records, loadRecord[P]{key: key})
+			continue
+		}
+		info := &NodeInfo[P]{
+			ref:         fileNode.Ref,
+			size:        fileNode.Size,
+			mediaType:   fileNode.MediaType,
+			created:     fileNode.Created,
+			incremented: fileNode.LastIncrement,
+			decremented: fileNode.LastDecrement,
+		}
+		// a trie without holders counts them as plain refs.
+		if tr.keepsHolders() {
+			info.holders = holders
+		}
+		if err := unmarshalPayload(fileNode.Payload, &info.payload); err != nil {
+			problems = append(problems, fmt.Errorf("Failed to load payload of %s, err: %w", key, err))
+			continue
+		}
+		records = append(records, loadRecord[P]{key: key, info: info})
+	}
+	return records, problems
+}
+
+// withoutDeletions drops the records at ref 0, which add nothing to a sum.
+func withoutDeletions[P any](records []loadRecord[P]) []loadRecord[P] {
+	kept := records[:0]
+	for _, r := range records {
+		if r.info != nil {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
+
+// loadHolders returns the holders of a record sorted, they may come in
+// any order from text files.
+func loadHolders(holders []string) ([]string, error) {
+	if len(holders) == 0 {
+		return nil, nil
+	}
+	sorted := append([]string(nil), holders...)
+	sort.Strings(sorted)
+	for i, holder := range sorted {
+		if err := validHolder(holder); err != nil {
+			return nil, err
+		}
+		if i > 0 && holder == sorted[i-1] {
+			return nil, fmt.Errorf("holder %s given twice", holder)
+		}
+	}
+	return sorted, nil
+}
+
+// loadChanges returns the ref changes loading records makes, worked out
+// before they are loaded and queued once they were. Replacing drops the
+// keys of the trie the records do not hold.
+func (tr *Trie[P]) loadChanges(records []loadRecord[P], replace bool) []refChange {
+	if !tr.notifier.observed() {
+		return nil
+	}
+	var changes []refChange
+	loaded := make(map[string]bool, len(records))
+	for _, r := range records {
+		old, ref := 0, 0
+		if node, ok, err := tr.stripeOf(r.key).root.Get(r.key); err == nil && ok {
+			old = node.ref
+		}
+		if r.info != nil {
+			ref = r.info.ref
+		}
+		changes = append(changes, refChange{key: r.key, old: old, new: ref})
+		loaded[r.key] = true
+	}
+	if !replace {
+		return changes
+	}
+	for _, s := range tr.stripes {
+		s.root.Walk(func(key string, node *NodeInfo[P]) error {
+			if !loaded[key] {
+				changes = append(changes, refChange{key: key, old: node.ref})
+			}
+			return nil
+		})
+	}
+	return changes
+}
+
+// compare counts the records against the keys of the trie.
+func (tr *Trie[P]) compare(records []loadRecord[P], summary *LoadSummary) {
+	for _, r := range records {
+		node, ok, err := tr.stripeOf(r.key).root.Get(r.key)
+		switch {
+		case r.info == nil:
+			if err == nil && ok {
+				summary.Removed++
+			}
+		case err != nil || !ok:
+			summary.Added++
+		case node.ref != r.info.ref:
+			summary.Conflicting++
+			fallthrough
+		default:
+			summary.Updated++
+		}
+	}
+}
+
+// clear empties every stripe, leaving snapshots as they are.
+func (tr *Trie[P]) clear() {
+	for _, s := range tr.stripes {
+		if root, ok := s.suffixRoot(); ok {
+			trie.FreeTrie(root)
+			continue
+		}
+		s.root = newStripeIndex[P](tr.backend, tr.alphabet)
+	}
+}
+
+// load puts decoded records. Codecs write keys in order, so empty stripes
+// on the suffix backend are built bottom up instead of key by key. The
+// records at ref 0 are deleted first, they are never built.
+func (tr *Trie[P]) load(records []loadRecord[P]) error {
+	for _, r := range records {
+		if r.info != nil {
+			continue
+		}
+		if _, err := tr.stripeOf(r.key).root.Delete(r.key); err != nil {
+			return fmt.Errorf("Failed to delete prefix %s, err: %v", r.key, err)
+		}
+	}
+	builders := make(map[*stripe[P]]*trie.Builder[*NodeInfo[P]])
+	defer func() {
+		for _, builder := range builders {
+			builder.Finish()
+		}
+	}()
+	for _, r := range records {
+		if r.info == nil {
+			continue
+		}
+		s := tr.stripeOf(r.key)
+		root, ok := s.suffixRoot()
+		if !ok {
+			if _, err := s.root.Put(r.key, r.info); err != nil {
+				return fmt.Errorf("Failed to load prefix %s, err: %v", r.key, err)
+			}
+			continue
+		}
+		builder := builders[s]
+		if builder == nil {
+			var err error
+			if builder, err = trie.NewBuilder(root); err != nil {
+				return err
+			}
+			builders[s] = builder
+		}
+		if err := builder.Add(r.key, r.info); err != nil {
+			return fmt.Errorf("Failed to load prefix %s, err: %v", r.key, err)
+		}
+	}
+	return nil
+}
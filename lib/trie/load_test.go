@@ -0,0 +1,156 @@
+package trie
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+
+	"gopkg.in/check.v1"
+	trie "trie/lib/suffix"
+)
+
+var _ = check.Suite(&LoadSuites{})
+
+type LoadSuites struct {
+}
+
+// file saves a trie of refs and returns the file.
+func (ls *LoadSuites) file(c *check.C, refs map[string]int) []byte {
+	tr := CreateTrie()
+	for k, ref := range refs {
+		c.Assert(tr.Update(k, ref), check.IsNil)
+	}
+	buf := &bytes.Buffer{}
+	c.Assert(tr.Save(buf), check.IsNil)
+	return buf.Bytes()
+}
+
+func (ls *LoadSuites) refs(c *check.C, tr *RefTrie) map[string]int {
+	refs := make(map[string]int)
+	it := tr.Iterator()
+	for ok := it.First(); ok; ok = it.Next() {
+		refs[it.Key()] = it.Ref()
+	}
+	return refs
+}
+
+func (ls *LoadSuites) TestModes(c *check.C) {
+	data := ls.file(c, map[string]int{"00AA": 1, "3FA9": 2, "A000": 3})
+	before := map[string]int{"3FA9": 2, "A000": 1, "FF": 4}
+	want := map[LoadMode]map[string]int{
+		LoadOverwrite:  {"00AA": 1, "3FA9": 2, "A000": 3, "FF": 4},
+		LoadReplace:    {"00AA": 1, "3FA9": 2, "A000": 3},
+		LoadMergeSum:   {"00AA": 1, "3FA9": 4, "A000": 4, "FF": 4},
+		LoadVerifyOnly: before,
+	}
+	for _, opts := range [][]Option{nil, {WithLockStriping()}, {WithBackend(PatriciaBackend)}} {
+		for mode := LoadOverwrite; mode <= LoadVerifyOnly; mode++ {
+			comment := check.Commentf("mode %v", mode)
+			tr := CreateTrie(opts...)
+			for k, ref := range before {
+				c.Assert(tr.Update(k, ref), check.IsNil)
+			}
+			summary, err := tr.LoadWith(bytes.NewReader(data), GobCodec, mode)
+			c.Assert(err, check.IsNil, comment)
+			c.Assert(summary.Records, check.Equals, 3, comment)
+			c.Assert(summary.Added, check.Equals, 1, comment)
+			c.Assert(summary.Updated, check.Equals, 2, comment)
+			c.Assert(summary.Conflicting, check.Equals, 1, comment)
+			removed := 0
+			if mode == LoadReplace {
+				removed = 1
+			}
+			c.Assert(summary.Removed, check.Equals, removed, comment)
+			c.Assert(ls.refs(c, tr), check.DeepEquals, want[mode], comment)
+		}
+	}
+	_, err := CreateTrie().LoadWith(bytes.NewReader(data), GobCodec, LoadMode(9))
+	c.Assert(err, check.ErrorMatches, "Unknown load mode LoadMode\\(9\\)")
+}
+
+func (ls *LoadSuites) TestProblems(c *check.C) {
+	buf := &bytes.Buffer{}
+	enc := gob.NewEncoder(buf)
+	for _, fn := range []FileNode{
+		{Prefix: "00AA", Ref: 1},
+		{Prefix: "XYZ", Ref: 1},
+		{Prefix: "3fa9", Ref: 1},
+		{Digest: []byte{0x3f, 0xa9}, Ref: 2},
+		{Prefix: "A000", Ref: -1},
+	} {
+		c.Assert(enc.Encode(fn), check.IsNil)
+	}
+	data := buf.Bytes()
+
+	tr := CreateTrie()
+	c.Assert(tr.Insert("FF"), check.IsNil)
+	summary, err := tr.LoadWith(bytes.NewReader(data), GobCodec, LoadVerifyOnly)
+	c.Assert(err, check.IsNil)
+	c.Assert(summary.Records, check.Equals, 5)
+	c.Assert(summary.Added, check.Equals, 2)
+	c.Assert(summary.Problems, check.HasLen, 3)
+	var kerr *trie.InvalidKeyError
+	c.Assert(errors.As(summary.Problems[0], &kerr), check.Equals, true)
+	c.Assert(summary.Problems[1], check.ErrorMatches, "Failed to load 3FA9 given twice")
+	c.Assert(summary.Problems[2], check.ErrorMatches, "Failed to load A000 with ref -1")
+
+	// any problem leaves the trie as it was.
+	for _, mode := range []LoadMode{LoadOverwrite, LoadReplace, LoadMergeSum} {
+		summary, err = tr.LoadWith(bytes.NewReader(data), GobCodec, mode)
+		c.Assert(errors.As(err, &kerr), check.Equals, true)
+		c.Assert(summary.Problems, check.HasLen, 3)
+		c.Assert(ls.refs(c, tr), check.DeepEquals, map[string]int{"FF": 1})
+	}
+	err = tr.Load(bytes.NewReader(data))
+	c.Assert(err, check.ErrorMatches, "Failed to load 3 of 5 records, first err: .*")
+}
+
+func (ls *LoadSuites) TestZeroRefs(c *check.C) {
+	buf := &bytes.Buffer{}
+	enc := gob.NewEncoder(buf)
+	for _, fn := range []FileNode{{Prefix: "00AA", Ref: 0}, {Prefix: "3FA9", Ref: 0}, {Prefix: "A000", Ref: 2}} {
+		c.Assert(enc.Encode(fn), check.IsNil)
+	}
+	data := buf.Bytes()
+	want := map[LoadMode]map[string]int{
+		LoadOverwrite:  {"A000": 2, "FF": 1},
+		LoadReplace:    {"A000": 2},
+		LoadMergeSum:   {"3FA9": 1, "A000": 2, "FF": 1},
+		LoadVerifyOnly: {"3FA9": 1, "FF": 1},
+	}
+	removed := map[LoadMode]int{LoadOverwrite: 1, LoadReplace: 2, LoadVerifyOnly: 1}
+	for _, opts := range [][]Option{nil, {WithBackend(SortedMapBackend)}} {
+		for mode := LoadOverwrite; mode <= LoadVerifyOnly; mode++ {
+			comment := check.Commentf("mode %v", mode)
+			tr := CreateTrie(opts...)
+			c.Assert(tr.Insert("3FA9"), check.IsNil)
+			c.Assert(tr.Insert("FF"), check.IsNil)
+			summary, err := tr.LoadWith(bytes.NewReader(data), GobCodec, mode)
+			c.Assert(err, check.IsNil, comment)
+			c.Assert(summary.Added, check.Equals, 1, comment)
+			c.Assert(summary.Removed, check.Equals, removed[mode], comment)
+			c.Assert(ls.refs(c, tr), check.DeepEquals, want[mode], comment)
+		}
+	}
+}
+
+func (ls *LoadSuites) TestReplaceKeepsSnapshots(c *check.C) {
+	tr := CreateTrie()
+	c.Assert(tr.EnableHash(), check.IsNil)
+	c.Assert(tr.Insert("FF"), check.IsNil)
+	snap := tr.Snapshot()
+	defer snap.Release()
+	data := ls.file(c, map[string]int{"00AA": 1})
+	_, err := tr.LoadWith(bytes.NewReader(data), GobCodec, LoadReplace)
+	c.Assert(err, check.IsNil)
+	ref, err := snap.GetRef("FF")
+	c.Assert(err, check.IsNil)
+	c.Assert(ref, check.Equals, 1)
+	_, err = tr.GetRef("FF")
+	c.Assert(err, check.ErrorMatches, "Not found FF")
+
+	loaded := CreateTrie()
+	c.Assert(loaded.EnableHash(), check.IsNil)
+	c.Assert(loaded.Load(bytes.NewReader(data)), check.IsNil)
+	c.Assert(tr.RootHash(), check.DeepEquals, loaded.RootHash())
+}
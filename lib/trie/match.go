@@ -0,0 +1,46 @@
+package trie
+
+import (
+	trie "trie/lib/suffix"
+)
+
+// MatchFunc is called for every key matching a pattern. It may return
+// StopWalk to end the match.
+type MatchFunc[P any] func(key string, node *NodeInfo[P]) error
+
+// Pattern is a compiled glob over keys, see trie.Pattern of lib/suffix.
+type Pattern = trie.Pattern
+
+func CompilePattern(pattern string) (*Pattern, error) {
+	return trie.CompilePattern(trie.HexAlphabet, pattern)
+}
+
+// Match calls fn for the keys matching a glob such as "AB??3*" in key
+// order. It runs over a snapshot, so writers are not blocked.
+func (tr *Trie[P]) Match(pattern string, fn MatchFunc[P]) error {
+	if tr.closed() {
+		return ErrClosed
+	}
+	snap := tr.Snapshot()
+	defer snap.Release()
+	return snap.Match(pattern, fn)
+}
+
+func (s *Snapshot[P]) Match(pattern string, fn MatchFunc[P]) error {
+	p, err := trie.CompilePattern(s.roots[0].Alphabet(), pattern)
+	if err != nil {
+		return err
+	}
+	stopped := false
+	match := func(key string, node *NodeInfo[P]) error {
+		err := fn(key, node)
+		stopped = err == StopWalk
+		return err
+	}
+	for _, root := range s.roots {
+		if err := root.MatchPattern(p, match); err != nil || stopped {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package trie
+
+import (
+	"gopkg.in/check.v1"
+)
+
+var _ = check.Suite(&MatchSuites{})
+
+type MatchSuites struct {
+}
+
+func (ms *MatchSuites) TestMatch(c *check.C) {
+	tr := CreateTrie()
+	for _, k := range []string{"AB003", "AB0031", "AB013", "AB014", "AC003", "3FA9", "3FA9"} {
+		c.Assert(tr.Insert(k), check.IsNil)
+	}
+	refs := make(map[string]int)
+	err := tr.Match("ab??3*", func(key string, node *RefNodeInfo) error {
+		refs[key] = node.Ref()
+		return nil
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(refs, check.DeepEquals, map[string]int{"AB003": 1, "AB0031": 1, "AB013": 1})
+
+	refs = make(map[string]int)
+	err = tr.Match("[0-3]FA?", func(key string, node *RefNodeInfo) error {
+		refs[key] = node.Ref()
+		return StopWalk
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(refs, check.DeepEquals, map[string]int{"3FA9": 2})
+
+	_, err = CompilePattern("A*B")
+	c.Assert(err, check.NotNil)
+	c.Assert(tr.Match("G*", func(string, *RefNodeInfo) error { return nil }), check.NotNil)
+}
@@ -0,0 +1,166 @@
+package trie
+
+import (
+	"errors"
+	"fmt"
+
+	trie "trie/lib/suffix"
+)
+
+// MergePolicy decides the ref of a key held by both tries of a Merge.
+// Whatever the policy, the key keeps the holders of both and a ref of at
+// least their count.
+type MergePolicy int
+
+const (
+	// MergeSum adds the refs of both tries.
+	MergeSum MergePolicy = iota
+	// MergeMax keeps the larger ref.
+	MergeMax
+	// MergeTakeOther keeps the ref, payload and metadata of the other trie.
+	MergeTakeOther
+)
+
+func (p MergePolicy) String() string {
+	switch p {
+	case MergeSum:
+		return "sum"
+	case MergeMax:
+		return "max"
+	case MergeTakeOther:
+		return "take-other"
+	}
+	return fmt.Sprintf("MergePolicy(%d)", int(p))
+}
+
+// mergeByKeyRatio is how many times more keys tr has to hold than other
+// before Merge puts the keys of other one by one rather than rebuilding tr.
+const mergeByKeyRatio = 16
+
+// Merge adds the keys of a snapshot of other to tr. Keys held by both get
+// a ref by policy and keep the payload and metadata of tr unless policy
+// takes other. On the suffix backend without striping the tries are
+// walked side by side and the union is built back into tr in one pass,
+// so merging the halves of a split costs about the size of both; a
+// striped other is copied into one trie for the walk. A small
+// other is put key by key instead, which costs about the size of other.
+// Either way live iterators see the merged keys.
+func (tr *Trie[P]) Merge(other *Trie[P], policy MergePolicy) error {
+	osnap := other.Snapshot()
+	defer osnap.Release()
+
+	defer tr.notifier.flush()
+	tr.lockAll()
+	defer tr.unlockAll()
+	defer tr.reindex()
+	return tr.merge(osnap, policy)
+}
+
+func (tr *Trie[P]) merge(osnap *Snapshot[P], policy MergePolicy) error {
+	var merge trie.MergeFunc[*NodeInfo[P]]
+	switch policy {
+	case MergeSum:
+		merge = func(key string, a, b *NodeInfo[P]) *NodeInfo[P] {
+			return sumRefs(a, b)
+		}
+	case MergeMax:
+		merge = func(key string, a, b *NodeInfo[P]) *NodeInfo[P] {
+			if b.ref > a.ref {
+				info := a.clone()
+				info.ref = b.ref
+				return keepHolders(info, a, b)
+			}
+			return keepHolders(a, a, b)
+		}
+	case MergeTakeOther:
+		merge = func(key string, a, b *NodeInfo[P]) *NodeInfo[P] {
+			return keepHolders(b, a, b)
+		}
+	default:
+		return fmt.Errorf("Unknown merge policy %v", policy)
+	}
+
+	changes := tr.mergeChanges(osnap, merge)
+	if err := tr.mergeInto(osnap, policy, merge); err != nil {
+		return err
+	}
+	tr.notifier.pushAll(changes)
+	return nil
+}
+
+// mergeInto merges osnap into tr, rebuilding tr from the union of both
+// or putting the keys of a small osnap one by one.
+func (tr *Trie[P]) mergeInto(osnap *Snapshot[P], policy MergePolicy, merge trie.MergeFunc[*NodeInfo[P]]) error {
+	s, ok := tr.single()
+	root, isSuffix := s.suffixRoot()
+	if !ok || !isSuffix || osnap.len()*mergeByKeyRatio < root.Len() {
+		return tr.mergeByKey(osnap, merge)
+	}
+	// the snapshot keeps reading the old arena while FreeTrie gives root a
+	// new one to build the union into.
+	snap := root.Snapshot()
+	defer snap.Release()
+	trie.FreeTrie(root)
+	builder, err := trie.NewBuilder(root)
+	if err == nil {
+		err = trie.UnionInto(builder, snap, osnap.joined(), merge)
+		builder.Finish()
+	}
+	if err != nil {
+		err = fmt.Errorf("Failed to merge with policy %v, err: %w", policy, err)
+		if rerr := restore(root, snap); rerr != nil {
+			return errors.Join(err, fmt.Errorf("Failed to restore the trie, it lost keys, err: %w", rerr))
+		}
+		return err
+	}
+	return nil
+}
+
+// restore puts the keys of snap back into root after a failed merge.
+func restore[V any](root, snap *trie.Trie[V]) error {
+	trie.FreeTrie(root)
+	builder, err := trie.NewBuilder(root)
+	if err != nil {
+		return err
+	}
+	defer builder.Finish()
+	return snap.Walk(builder.Add)
+}
+
+// mergeChanges returns the ref changes merging osnap makes, worked out
+// before it is merged and queued once it was.
+func (tr *Trie[P]) mergeChanges(osnap *Snapshot[P], merge trie.MergeFunc[*NodeInfo[P]]) []refChange {
+	if !tr.notifier.observed() {
+		return nil
+	}
+	var changes []refChange
+	osnap.walk(func(key string, b *NodeInfo[P]) error {
+		old := 0
+		if a, ok, err := tr.stripeOf(key).root.Get(key); err == nil && ok {
+			old = a.ref
+			b = merge(key, a, b)
+		}
+		changes = append(changes, refChange{key: key, old: old, new: b.ref})
+		return nil
+	})
+	return changes
+}
+
+// mergeByKey merges key by key into the tries that cannot be rebuilt from
+// a Union.
+func (tr *Trie[P]) mergeByKey(osnap *Snapshot[P], merge trie.MergeFunc[*NodeInfo[P]]) error {
+	return osnap.walk(func(key string, b *NodeInfo[P]) error {
+		s := tr.stripeOf(key)
+		a, ok, err := s.root.Get(key)
+		if err != nil {
+			return err
+		}
+		if ok {
+			b = merge(key, a, b)
+		}
+		if _, err := s.root.Put(key, b); err != nil {
+			return fmt.Errorf("Failed to merge %s, err: %w", key, err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,133 @@
+package trie
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gopkg.in/check.v1"
+	trie "trie/lib/suffix"
+)
+
+var _ = check.Suite(&MergeSuites{})
+
+type MergeSuites struct {
+}
+
+func refsOf(c *check.C, tr *Trie[testPayload]) map[string]int {
+	refs := make(map[string]int)
+	snap := tr.Snapshot()
+	defer snap.Release()
+	err := snap.walk(func(key string, node *NodeInfo[testPayload]) error {
+		refs[key] = node.ref
+		return nil
+	})
+	c.Assert(err, check.IsNil)
+	return refs
+}
+
+func (ms *MergeSuites) build(c *check.C, refs map[string]int) *Trie[testPayload] {
+	tr := NewTrie[testPayload]()
+	for k, ref := range refs {
+		c.Assert(tr.Insert(k), check.IsNil)
+		c.Assert(tr.Update(k, ref), check.IsNil)
+	}
+	return tr
+}
+
+func (ms *MergeSuites) TestMerge(c *check.C) {
+	a := map[string]int{"00AA": 1, "3FA9": 2, "3FA9C1": 5}
+	b := map[string]int{"0F": 1, "3FA9": 3, "3FA9C1": 1}
+	cases := map[MergePolicy]map[string]int{
+		MergeSum:       {"00AA": 1, "0F": 1, "3FA9": 5, "3FA9C1": 6},
+		MergeMax:       {"00AA": 1, "0F": 1, "3FA9": 3, "3FA9C1": 5},
+		MergeTakeOther: {"00AA": 1, "0F": 1, "3FA9": 3, "3FA9C1": 1},
+	}
+	for policy, want := range cases {
+		x, y := ms.build(c, a), ms.build(c, b)
+		c.Assert(x.SetPayload("3FA9", testPayload{size: 1}), check.IsNil)
+		c.Assert(y.SetPayload("3FA9", testPayload{size: 2}), check.IsNil)
+		snap := x.Snapshot()
+
+		c.Assert(x.Merge(y, policy), check.IsNil, check.Commentf("policy %v", policy))
+		c.Assert(refsOf(c, x), check.DeepEquals, want, check.Commentf("policy %v", policy))
+		c.Assert(x.Len(), check.Equals, len(want))
+		payload, err := x.GetPayload("3FA9")
+		c.Assert(err, check.IsNil)
+		if policy == MergeTakeOther {
+			c.Assert(payload.size, check.Equals, uint32(2))
+		} else {
+			c.Assert(payload.size, check.Equals, uint32(1))
+		}
+		// other and earlier snapshots are left alone.
+		c.Assert(refsOf(c, y), check.DeepEquals, b)
+		ref, err := snap.GetRef("3FA9")
+		c.Assert(err, check.IsNil)
+		c.Assert(ref, check.Equals, 2)
+		snap.Release()
+	}
+
+	x := ms.build(c, a)
+	c.Assert(x.Merge(x, MergeSum), check.IsNil)
+	c.Assert(refsOf(c, x), check.DeepEquals, map[string]int{"00AA": 2, "3FA9": 4, "3FA9C1": 10})
+	c.Assert(x.Merge(x, MergePolicy(7)), check.NotNil)
+}
+
+func (ms *MergeSuites) TestMergeSmallOther(c *check.C) {
+	big := make(map[string]int)
+	for i := 0; i < 64; i++ {
+		big[fmt.Sprintf("%04X", i*97)] = 1
+	}
+	x := ms.build(c, big)
+	c.Assert(x.EnableHash(), check.IsNil)
+	c.Assert(x.Merge(ms.build(c, map[string]int{"0000": 2, "FF": 1}), MergeSum), check.IsNil)
+
+	big["0000"], big["FF"] = 3, 1
+	c.Assert(refsOf(c, x), check.DeepEquals, big)
+	want := ms.build(c, big)
+	c.Assert(want.EnableHash(), check.IsNil)
+	c.Assert(x.RootHash(), check.DeepEquals, want.RootHash())
+}
+
+func (ms *MergeSuites) TestMergeIterator(c *check.C) {
+	x := ms.build(c, map[string]int{"00": 1, "10": 1})
+	it := x.Iterator()
+	c.Assert(it.First(), check.Equals, true)
+	c.Assert(it.Key(), check.Equals, "00")
+	c.Assert(x.Merge(ms.build(c, map[string]int{"05": 1}), MergeSum), check.IsNil)
+	c.Assert(x.Insert("08"), check.IsNil)
+
+	var keys []string
+	for it.Next() {
+		keys = append(keys, it.Key())
+	}
+	c.Assert(it.Err(), check.IsNil)
+	c.Assert(keys, check.DeepEquals, []string{"05", "08", "10"})
+}
+
+func (ms *MergeSuites) TestMergeKeepsHash(c *check.C) {
+	x := ms.build(c, map[string]int{"00AA": 1, "3FA9": 2})
+	c.Assert(x.EnableHash(), check.IsNil)
+	c.Assert(x.Merge(ms.build(c, map[string]int{"0F": 1, "3FA9": 1}), MergeSum), check.IsNil)
+
+	want := ms.build(c, map[string]int{"00AA": 1, "0F": 1, "3FA9": 3})
+	c.Assert(want.EnableHash(), check.IsNil)
+	c.Assert(x.RootHash(), check.DeepEquals, want.RootHash())
+	c.Assert(x.Insert("0F"), check.IsNil)
+	c.Assert(want.Insert("0F"), check.IsNil)
+	c.Assert(x.RootHash(), check.DeepEquals, want.RootHash())
+}
+
+func (ms *MergeSuites) TestMergeFails(c *check.C) {
+	tr := CreateTrie()
+	c.Assert(tr.Update("3FA9", 2), check.IsNil)
+	other := CreateTrie()
+	c.Assert(other.Update("A0", 1), check.IsNil)
+	// a read-only root fails the union and the restore both.
+	s := tr.stripes[0]
+	root, _ := s.suffixRoot()
+	s.root = root.Snapshot()
+	err := tr.Merge(other, MergeSum)
+	c.Assert(errors.Is(err, trie.ErrReadOnly), check.Equals, true)
+	c.Assert(strings.Contains(err.Error(), "Failed to restore"), check.Equals, true)
+}
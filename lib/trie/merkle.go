@@ -0,0 +1,111 @@
+package trie
+
+import (
+	"encoding/binary"
+
+	trie "trie/lib/suffix"
+)
+
+// DiffFunc is called by Diff for every key whose ref or payload differs
+// between two tries. A key missing from one trie has a nil NodeInfo there.
+type DiffFunc[P any] func(key string, a, b *NodeInfo[P]) error
+
+// EnableHash makes the trie keep a hash of every subtree over the keys,
+// refs and payloads implementing encoding.BinaryMarshaler, so RootHash
+// tells replicas apart and Diff finds where they differ cheaply. Only the
+// suffix backend keeps hashes.
+func (tr *Trie[P]) EnableHash() error {
+	if tr.backend != SuffixBackend {
+		return ErrUnsupported
+	}
+	tr.lockAll()
+	defer tr.unlockAll()
+	for _, s := range tr.stripes {
+		root, ok := s.suffixRoot()
+		if !ok {
+			return ErrClosed
+		}
+		if err := root.EnableHash(hashNodeInfo[P]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RootHash returns the hash of all keys, or nil unless EnableHash was
+// called. Equal tries have equal root hashes, striped or not: a striped
+// trie joins the hashes of its stripes as one root over all of them would.
+func (tr *Trie[P]) RootHash() []byte {
+	if tr.backend != SuffixBackend {
+		return nil
+	}
+	tr.rlockAll()
+	defer tr.runlockAll()
+	roots := make([]*trie.Trie[*NodeInfo[P]], len(tr.stripes))
+	for i, s := range tr.stripes {
+		root, ok := s.suffixRoot()
+		if !ok {
+			return nil
+		}
+		roots[i] = root
+	}
+	if len(roots) == 1 {
+		return roots[0].RootHash()
+	}
+	return trie.JoinedRootHash(roots...)
+}
+
+// Diff compares snapshots of tr and other, which both have to keep hashes,
+// and calls fn for every key that differs in key order.
+func (tr *Trie[P]) Diff(other *Trie[P], fn DiffFunc[P]) error {
+	if tr.closed() || other.closed() {
+		return ErrClosed
+	}
+	snap, osnap := tr.Snapshot(), other.Snapshot()
+	defer snap.Release()
+	defer osnap.Release()
+	return snap.Diff(osnap, fn)
+}
+
+func (s *Snapshot[P]) RootHash() []byte {
+	if len(s.roots) == 1 {
+		return s.roots[0].RootHash()
+	}
+	return trie.JoinedRootHash(s.roots...)
+}
+
+// Diff compares the snapshots stripe by stripe. Snapshots of tries striped
+// differently are compared as copies holding all their keys.
+func (s *Snapshot[P]) Diff(other *Snapshot[P], fn DiffFunc[P]) error {
+	roots, oroots := s.roots, other.roots
+	if len(roots) != len(oroots) {
+		roots = []*trie.Trie[*NodeInfo[P]]{s.joined()}
+		oroots = []*trie.Trie[*NodeInfo[P]]{other.joined()}
+	}
+	stopped := false
+	diff := func(key string, a *NodeInfo[P], inA bool, b *NodeInfo[P], inB bool) error {
+		if !inA {
+			a = nil
+		}
+		if !inB {
+			b = nil
+		}
+		err := fn(key, a, b)
+		stopped = err == StopWalk
+		return err
+	}
+	for i := range roots {
+		if err := trie.Diff(roots[i], oroots[i], diff); err != nil || stopped {
+			return err
+		}
+	}
+	return nil
+}
+
+func hashNodeInfo[P any](node *NodeInfo[P]) []byte {
+	buf := binary.AppendVarint(nil, int64(node.ref))
+	if payload, err := marshalPayload(node.payload); err == nil {
+		buf = append(buf, payload...)
+	}
+	return buf
+}
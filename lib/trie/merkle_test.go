@@ -0,0 +1,54 @@
+package trie
+
+import (
+	"gopkg.in/check.v1"
+)
+
+var _ = check.Suite(&MerkleSuites{})
+
+type MerkleSuites struct {
+}
+
+func (ms *MerkleSuites) TestDiff(c *check.C) {
+	a := NewTrie[testPayload]()
+	b := NewTrie[testPayload]()
+	c.Assert(a.EnableHash(), check.IsNil)
+	c.Assert(a.RootHash(), check.NotNil)
+	for _, k := range []string{"00AA", "0F", "3FA9", "3FA9C1", "A000"} {
+		c.Assert(a.Insert(k), check.IsNil)
+		c.Assert(b.Insert(k), check.IsNil)
+	}
+	c.Assert(b.RootHash(), check.IsNil)
+	err := a.Diff(b, func(string, *NodeInfo[testPayload], *NodeInfo[testPayload]) error {
+		return nil
+	})
+	c.Assert(err, check.NotNil)
+	c.Assert(b.EnableHash(), check.IsNil)
+	c.Assert(a.RootHash(), check.DeepEquals, b.RootHash())
+
+	c.Assert(b.Insert("0F"), check.IsNil)
+	c.Assert(b.SetPayload("3FA9", testPayload{size: 9}), check.IsNil)
+	_, err = b.Delete("A000")
+	c.Assert(err, check.IsNil)
+	c.Assert(b.Insert("3FA"), check.IsNil)
+	c.Assert(a.RootHash(), check.Not(check.DeepEquals), b.RootHash())
+
+	var keys []string
+	err = a.Diff(b, func(key string, x, y *NodeInfo[testPayload]) error {
+		keys = append(keys, key)
+		switch key {
+		case "0F":
+			c.Assert(x.ref, check.Equals, 1)
+			c.Assert(y.ref, check.Equals, 2)
+		case "3FA":
+			c.Assert(x, check.IsNil)
+		case "3FA9":
+			c.Assert(y.Payload().size, check.Equals, uint32(9))
+		case "A000":
+			c.Assert(y, check.IsNil)
+		}
+		return nil
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(keys, check.DeepEquals, []string{"0F", "3FA", "3FA9", "A000"})
+}
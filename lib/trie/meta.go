@@ -0,0 +1,93 @@
+package trie
+
+import (
+	"fmt"
+	"time"
+)
+
+// timeNow stamps the changes of refs, tests replace it.
+var timeNow = time.Now
+
+// Size is the size of the blob behind the key, as given to SetMeta.
+func (n *NodeInfo[P]) Size() int64 {
+	return n.size
+}
+
+func (n *NodeInfo[P]) MediaType() string {
+	return n.mediaType
+}
+
+// Created is when the key was first inserted.
+func (n *NodeInfo[P]) Created() time.Time {
+	return n.created
+}
+
+// LastIncrement is when the ref of the key last went up.
+func (n *NodeInfo[P]) LastIncrement() time.Time {
+	return n.incremented
+}
+
+// LastDecrement is when the ref of the key last went down, zero if never.
+func (n *NodeInfo[P]) LastDecrement() time.Time {
+	return n.decremented
+}
+
+// clone returns a copy of the node to be changed and put back.
+func (n *NodeInfo[P]) clone() *NodeInfo[P] {
+	c := *n
+	return &c
+}
+
+// SetMeta records the size and media type of the blob behind a key which
+// is in the trie.
+func (tr *Trie[P]) SetMeta(key string, size int64, mediaType string) error {
+	s := tr.stripeOf(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	node, ok, err := s.root.Get(key)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w %s", ErrNotFound, key)
+	}
+	info := node.clone()
+	info.size, info.mediaType = size, mediaType
+	_, err = s.root.Put(key, info)
+	return err
+}
+
+// MetaSelector is a Selector handing the keys whose metadata match all of
+// its set fields to Visit.
+type MetaSelector[P any] struct {
+	MinSize, MaxSize int64
+	MediaType        string
+	// CreatedBefore picks keys older than the time.
+	CreatedBefore time.Time
+	// IdleSince picks keys whose ref has not gone up since the time.
+	IdleSince time.Time
+	Visit     func(prefix string, node *NodeInfo[P]) error
+}
+
+func (ms *MetaSelector[P]) Check(prefix string, node *NodeInfo[P]) bool {
+	switch {
+	case node.size < ms.MinSize:
+		return false
+	case ms.MaxSize > 0 && node.size > ms.MaxSize:
+		return false
+	case len(ms.MediaType) > 0 && node.mediaType != ms.MediaType:
+		return false
+	case !ms.CreatedBefore.IsZero() && !node.created.Before(ms.CreatedBefore):
+		return false
+	case !ms.IdleSince.IsZero() && node.incremented.After(ms.IdleSince):
+		return false
+	}
+	return true
+}
+
+func (ms *MetaSelector[P]) Get(prefix string, node *NodeInfo[P]) error {
+	if ms.Visit == nil {
+		return nil
+	}
+	return ms.Visit(prefix, node)
+}
@@ -0,0 +1,141 @@
+package trie
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+var _ = check.Suite(&MetaSuites{})
+
+type MetaSuites struct {
+	clock time.Time
+}
+
+func (ms *MetaSuites) SetUpTest(c *check.C) {
+	ms.clock = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time {
+		return ms.clock
+	}
+}
+
+func (ms *MetaSuites) TearDownTest(c *check.C) {
+	timeNow = time.Now
+}
+
+func (ms *MetaSuites) tick() time.Time {
+	ms.clock = ms.clock.Add(time.Hour)
+	return ms.clock
+}
+
+func (ms *MetaSuites) node(c *check.C, tr *RefTrie, key string) *RefNodeInfo {
+	var found *RefNodeInfo
+	err := tr.Select(&MetaSelector[struct{}]{Visit: func(prefix string, node *RefNodeInfo) error {
+		if prefix == key {
+			found = node
+			return StopWalk
+		}
+		return nil
+	}})
+	c.Assert(err, check.IsNil)
+	c.Assert(found, check.NotNil)
+	return found
+}
+
+func (ms *MetaSuites) TestTimes(c *check.C) {
+	tr := CreateTrie()
+	created := ms.clock
+	c.Assert(tr.Insert("3FA9"), check.IsNil)
+	inc := ms.tick()
+	c.Assert(tr.Insert("3FA9"), check.IsNil)
+	dec := ms.tick()
+	_, err := tr.Delete("3FA9")
+	c.Assert(err, check.IsNil)
+
+	node := ms.node(c, tr, "3FA9")
+	c.Assert(node.Ref(), check.Equals, 1)
+	c.Assert(node.Created(), check.Equals, created)
+	c.Assert(node.LastIncrement(), check.Equals, inc)
+	c.Assert(node.LastDecrement(), check.Equals, dec)
+
+	c.Assert(tr.Update("3FA9", 5), check.IsNil)
+	c.Assert(ms.node(c, tr, "3FA9").LastIncrement(), check.Equals, dec)
+	c.Assert(ms.node(c, tr, "3FA9").Created(), check.Equals, created)
+	c.Assert(tr.Update("00", 2), check.IsNil)
+	node = ms.node(c, tr, "00")
+	c.Assert(node.Created(), check.Equals, dec)
+	c.Assert(node.LastIncrement(), check.Equals, dec)
+	c.Assert(node.LastDecrement().IsZero(), check.Equals, true)
+}
+
+func (ms *MetaSuites) TestSelectAndSave(c *check.C) {
+	tr := CreateTrie(WithLockStriping())
+	err := tr.SetMeta("3FA9", 10, "text/plain")
+	c.Assert(errors.Is(err, ErrNotFound), check.Equals, true)
+	for i, k := range []string{"00AA", "3FA9", "A000"} {
+		c.Assert(tr.Insert(k), check.IsNil)
+		c.Assert(tr.SetMeta(k, int64(100*(i+1)), "application/octet-stream"), check.IsNil)
+		ms.tick()
+	}
+	c.Assert(tr.SetMeta("3FA9", 50, "text/plain"), check.IsNil)
+	c.Assert(tr.Insert("00AA"), check.IsNil)
+
+	sel := func(s MetaSelector[struct{}]) []string {
+		var keys []string
+		s.Visit = func(prefix string, node *RefNodeInfo) error {
+			keys = append(keys, prefix)
+			return nil
+		}
+		c.Assert(tr.Select(&s), check.IsNil)
+		return keys
+	}
+	c.Assert(sel(MetaSelector[struct{}]{MinSize: 100}), check.DeepEquals, []string{"00AA", "A000"})
+	c.Assert(sel(MetaSelector[struct{}]{MaxSize: 100}), check.DeepEquals, []string{"00AA", "3FA9"})
+	c.Assert(sel(MetaSelector[struct{}]{MediaType: "text/plain"}), check.DeepEquals, []string{"3FA9"})
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.Assert(sel(MetaSelector[struct{}]{CreatedBefore: start.Add(2 * time.Hour)}), check.DeepEquals, []string{"00AA", "3FA9"})
+	c.Assert(sel(MetaSelector[struct{}]{IdleSince: start.Add(time.Hour)}), check.DeepEquals, []string{"3FA9"})
+
+	buf := &bytes.Buffer{}
+	c.Assert(tr.Save(buf), check.IsNil)
+	loaded := CreateTrie()
+	c.Assert(loaded.Load(buf), check.IsNil)
+	for _, k := range []string{"00AA", "3FA9", "A000"} {
+		a, b := ms.node(c, tr, k), ms.node(c, loaded, k)
+		c.Assert(b.Ref(), check.Equals, a.Ref())
+		c.Assert(b.Size(), check.Equals, a.Size())
+		c.Assert(b.MediaType(), check.Equals, a.MediaType())
+		c.Assert(b.Created().Equal(a.Created()), check.Equals, true)
+		c.Assert(b.LastIncrement().Equal(a.LastIncrement()), check.Equals, true)
+		c.Assert(b.LastDecrement().Equal(a.LastDecrement()), check.Equals, true)
+	}
+
+	// merging keeps the metadata of the trie merged into.
+	c.Assert(loaded.SetMeta("3FA9", 1, "image/png"), check.IsNil)
+	c.Assert(tr.Merge(loaded, MergeSum), check.IsNil)
+	node := ms.node(c, tr, "3FA9")
+	c.Assert(node.Ref(), check.Equals, 2)
+	c.Assert(node.MediaType(), check.Equals, "text/plain")
+}
+
+func (ms *MetaSuites) TestLoadWithoutMeta(c *check.C) {
+	// records written before metadata was saved.
+	type oldFileNode struct {
+		Prefix  string
+		Ref     int
+		Digest  []byte
+		Payload []byte
+	}
+	buf := &bytes.Buffer{}
+	enc := gob.NewEncoder(buf)
+	c.Assert(enc.Encode(oldFileNode{Digest: []byte{0x3f, 0xa9}, Ref: 3}), check.IsNil)
+	tr := CreateTrie()
+	c.Assert(tr.Load(buf), check.IsNil)
+	node := ms.node(c, tr, "3FA9")
+	c.Assert(node.Ref(), check.Equals, 3)
+	c.Assert(node.Size(), check.Equals, int64(0))
+	c.Assert(node.Created().IsZero(), check.Equals, true)
+}
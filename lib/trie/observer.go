@@ -0,0 +1,149 @@
+package trie
+
+import (
+	"sync"
+)
+
+// Observer is told when refs change. Insert, Update, Delete and their
+// batch and bytes forms notify observers, and so do Load and Merge for
+// every key they change; the keys LoadReplace drops are orphaned.
+type Observer interface {
+	// OnReferenced is called when the ref of a key rises above 0.
+	OnReferenced(key string)
+	// OnOrphaned is called when the ref of a key drops to 0, whether the
+	// key is deleted or kept at 0.
+	OnOrphaned(key string)
+	// OnRefChanged is called for every change of a ref, before the two
+	// above. The ref of a missing key is 0.
+	OnRefChanged(key string, old, new int)
+}
+
+// ObserverFuncs is an Observer calling the functions that are set.
+type ObserverFuncs struct {
+	Referenced func(key string)
+	Orphaned   func(key string)
+	RefChanged func(key string, old, new int)
+}
+
+func (of ObserverFuncs) OnReferenced(key string) {
+	if of.Referenced != nil {
+		of.Referenced(key)
+	}
+}
+
+func (of ObserverFuncs) OnOrphaned(key string) {
+	if of.Orphaned != nil {
+		of.Orphaned(key)
+	}
+}
+
+func (of ObserverFuncs) OnRefChanged(key string, old, new int) {
+	if of.RefChanged != nil {
+		of.RefChanged(key, old, new)
+	}
+}
+
+// Observe adds an observer. Observers are called outside the locks of the
+// trie and may use it; they see the changes in the order they were made.
+// Changes made while observers run are delivered by the call already
+// delivering, so a call may return before its own changes are observed.
+func (tr *Trie[P]) Observe(observer Observer) {
+	tr.notifier.mutex.Lock()
+	defer tr.notifier.mutex.Unlock()
+	observers := make([]Observer, len(tr.notifier.observers), len(tr.notifier.observers)+1)
+	copy(observers, tr.notifier.observers)
+	tr.notifier.observers = append(observers, observer)
+}
+
+type refChange struct {
+	key      string
+	old, new int
+}
+
+// notifier queues the ref changes made under the stripe locks until flush
+// hands them to the observers, one caller at a time.
+type notifier struct {
+	mutex      sync.Mutex
+	observers  []Observer
+	queue      []refChange
+	delivering bool
+}
+
+// observed tells whether there is anyone to push changes for, so callers
+// can skip working them out.
+func (n *notifier) observed() bool {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	return len(n.observers) > 0
+}
+
+// push queues a change, the stripe of key is locked.
+func (n *notifier) push(key string, old, new int) {
+	if old == new {
+		return
+	}
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	if len(n.observers) > 0 {
+		n.queue = append(n.queue, refChange{key: key, old: old, new: new})
+	}
+}
+
+// pushAll queues changes worked out before they were made, once they were.
+func (n *notifier) pushAll(changes []refChange) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	if len(n.observers) == 0 {
+		return
+	}
+	for _, c := range changes {
+		if c.old != c.new {
+			n.queue = append(n.queue, c)
+		}
+	}
+}
+
+// flush delivers the queued changes unless another call is at it, which
+// then delivers them too. No stripe may be locked. When an observer
+// panics, the changes after the one it was told about go back to the
+// queue for the next call.
+func (n *notifier) flush() {
+	n.mutex.Lock()
+	if n.delivering || len(n.queue) == 0 {
+		n.mutex.Unlock()
+		return
+	}
+	n.delivering = true
+	delivered := false
+	var rest []refChange
+	defer func() {
+		if !delivered {
+			n.mutex.Lock()
+			n.queue = append(rest, n.queue...)
+			n.delivering = false
+			n.mutex.Unlock()
+		}
+	}()
+	for len(n.queue) > 0 {
+		queue, observers := n.queue, n.observers
+		n.queue = nil
+		n.mutex.Unlock()
+		for i, c := range queue {
+			rest = queue[i+1:]
+			for _, o := range observers {
+				o.OnRefChanged(c.key, c.old, c.new)
+				switch {
+				case c.old <= 0 && c.new > 0:
+					o.OnReferenced(c.key)
+				case c.old > 0 && c.new <= 0:
+					o.OnOrphaned(c.key)
+				}
+			}
+		}
+		rest = nil
+		n.mutex.Lock()
+	}
+	n.delivering = false
+	delivered = true
+	n.mutex.Unlock()
+}
@@ -0,0 +1,182 @@
+package trie
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+
+	"gopkg.in/check.v1"
+)
+
+var _ = check.Suite(&ObserverSuites{})
+
+type ObserverSuites struct {
+}
+
+type recorder struct {
+	mutex  sync.Mutex
+	events []string
+}
+
+func (r *recorder) add(format string, args ...interface{}) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.events = append(r.events, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) OnReferenced(key string) {
+	r.add("+%s", key)
+}
+
+func (r *recorder) OnOrphaned(key string) {
+	r.add("-%s", key)
+}
+
+func (r *recorder) OnRefChanged(key string, old, new int) {
+	r.add("%s:%d>%d", key, old, new)
+}
+
+func (os *ObserverSuites) TestEvents(c *check.C) {
+	for _, opts := range [][]Option{nil, {WithStrict(), WithLockStriping()}} {
+		tr := CreateTrie(opts...)
+		r := &recorder{}
+		tr.Observe(r)
+		c.Assert(tr.Insert("3FA9"), check.IsNil)
+		c.Assert(tr.Insert("3FA9"), check.IsNil)
+		c.Assert(tr.Update("00", 3), check.IsNil)
+		c.Assert(tr.Update("00", 3), check.IsNil)
+		_, err := tr.Delete("3FA9")
+		c.Assert(err, check.IsNil)
+		_, err = tr.Delete("3FA9")
+		c.Assert(err, check.IsNil)
+		_, err = tr.DeleteBatch([]string{"00", "A0"})
+		c.Assert(err == nil, check.Equals, opts == nil)
+		c.Assert(tr.Update("00", 0), check.IsNil)
+		c.Assert(r.events, check.DeepEquals, []string{
+			"3FA9:0>1", "+3FA9",
+			"3FA9:1>2",
+			"00:0>3", "+00",
+			"3FA9:2>1",
+			"3FA9:1>0", "-3FA9",
+			"00:3>2",
+			"00:2>0", "-00",
+		})
+	}
+}
+
+func (os *ObserverSuites) TestLoadAndMerge(c *check.C) {
+	for _, opts := range [][]Option{nil, {WithLockStriping()}} {
+		tr := CreateTrie(opts...)
+		c.Assert(tr.Update("3FA9", 2), check.IsNil)
+		c.Assert(tr.Update("00", 1), check.IsNil)
+		r := &recorder{}
+		tr.Observe(r)
+
+		src := CreateTrie()
+		c.Assert(src.Update("3FA9", 5), check.IsNil)
+		c.Assert(src.Update("A0", 1), check.IsNil)
+		var buf bytes.Buffer
+		c.Assert(src.SaveCodec(&buf, JSONLCodec), check.IsNil)
+		_, err := tr.LoadWith(&buf, JSONLCodec, LoadReplace)
+		c.Assert(err, check.IsNil)
+		c.Assert(r.events, check.DeepEquals, []string{
+			"3FA9:2>5",
+			"A0:0>1", "+A0",
+			"00:1>0", "-00",
+		})
+
+		r.events = nil
+		other := CreateTrie()
+		c.Assert(other.Update("A0", 2), check.IsNil)
+		c.Assert(other.Update("FF", 1), check.IsNil)
+		c.Assert(tr.Merge(other, MergeSum), check.IsNil)
+		c.Assert(r.events, check.DeepEquals, []string{
+			"A0:1>3",
+			"FF:0>1", "+FF",
+		})
+	}
+}
+
+func (os *ObserverSuites) TestFailedMerge(c *check.C) {
+	tr := CreateTrie()
+	c.Assert(tr.Update("3FA9", 2), check.IsNil)
+	r := &recorder{}
+	tr.Observe(r)
+	other := CreateTrie()
+	c.Assert(other.Update("3FA9", 1), check.IsNil)
+	c.Assert(other.Update("A0", 1), check.IsNil)
+	// a read-only root fails the union and every put.
+	s := tr.stripes[0]
+	root, _ := s.suffixRoot()
+	s.root = root.Snapshot()
+	c.Assert(tr.Merge(other, MergeSum), check.NotNil)
+	c.Assert(r.events, check.HasLen, 0)
+}
+
+func (os *ObserverSuites) TestPanic(c *check.C) {
+	tr := CreateTrie()
+	var keys []string
+	tr.Observe(ObserverFuncs{Referenced: func(key string) {
+		keys = append(keys, key)
+		if key == "00" {
+			panic(key)
+		}
+	}})
+	c.Assert(func() { tr.InsertBatch([]string{"00", "0F"}) }, check.PanicMatches, "00")
+	// the observer is called again, the change left over comes first.
+	c.Assert(tr.Insert("A0"), check.IsNil)
+	c.Assert(keys, check.DeepEquals, []string{"00", "0F", "A0"})
+}
+
+func (os *ObserverSuites) TestReentrant(c *check.C) {
+	tr := CreateTrie()
+	var orphans []string
+	// an observer may use the trie, its own changes come after the others.
+	tr.Observe(ObserverFuncs{
+		Orphaned: func(key string) {
+			orphans = append(orphans, key)
+			if key == "3FA9" {
+				c.Check(tr.Insert("A0"), check.IsNil)
+				_, err := tr.Delete("A0")
+				c.Check(err, check.IsNil)
+			}
+		},
+	})
+	c.Assert(tr.Insert("3FA9"), check.IsNil)
+	_, err := tr.Delete("3FA9")
+	c.Assert(err, check.IsNil)
+	c.Assert(orphans, check.DeepEquals, []string{"3FA9", "A0"})
+}
+
+func (os *ObserverSuites) TestConcurrent(c *check.C) {
+	keys := stripeKeys(200)
+	for _, opts := range [][]Option{nil, {WithLockStriping()}} {
+		tr := CreateTrie(opts...)
+		var mutex sync.Mutex
+		refs := make(map[string]int)
+		tr.Observe(ObserverFuncs{RefChanged: func(key string, old, new int) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			// changes of a key arrive in order, each starting where the
+			// last one ended.
+			c.Check(old, check.Equals, refs[key])
+			refs[key] = new
+		}})
+		var wg sync.WaitGroup
+		for g := 0; g < 8; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for _, k := range keys {
+					tr.Insert(k)
+					tr.Insert(k)
+					tr.Delete(k)
+				}
+			}()
+		}
+		wg.Wait()
+		for _, k := range keys {
+			c.Assert(refs[k], check.Equals, 8)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package trie
+
+import (
+	"sync"
+
+	"github.com/tchap/go-patricia/patricia"
+	trie "trie/lib/suffix"
+)
+
+// patriciaIndex keeps the keys in a go-patricia trie. Its child lists
+// are walked in byte order, so the keys of an alphabet declared out of
+// byte order are sorted before they are walked.
+type patriciaIndex[V any] struct {
+	alphabet *trie.Alphabet
+	trie     *patricia.Trie
+	len      int
+	// ordered is set when byte order is alphabet order.
+	ordered bool
+	// walks sort child lists in place, so they keep out the reads a
+	// shared trie lock lets in.
+	walkMutex sync.RWMutex
+}
+
+func newPatriciaIndex[V any](alphabet *trie.Alphabet) *patriciaIndex[V] {
+	symbols := alphabet.Symbols()
+	ordered := true
+	for i := 1; i < len(symbols); i++ {
+		ordered = ordered && symbols[i-1] < symbols[i]
+	}
+	return &patriciaIndex[V]{
+		alphabet: alphabet,
+		trie:     patricia.NewTrie(),
+		ordered:  ordered,
+	}
+}
+
+func (p *patriciaIndex[V]) Alphabet() *trie.Alphabet {
+	return p.alphabet
+}
+
+func (p *patriciaIndex[V]) Get(key string) (V, bool, error) {
+	var value V
+	key, err := p.alphabet.Canonical(key)
+	if err != nil {
+		return value, false, err
+	}
+	p.walkMutex.RLock()
+	item := p.trie.Get(patricia.Prefix(key))
+	p.walkMutex.RUnlock()
+	if item == nil {
+		return value, false, nil
+	}
+	return item.(V), true, nil
+}
+
+func (p *patriciaIndex[V]) Put(key string, value V) (bool, error) {
+	key, err := p.alphabet.Canonical(key)
+	if err != nil {
+		return false, err
+	}
+	isNew := p.trie.Insert(patricia.Prefix(key), value)
+	if isNew {
+		p.len++
+	} else {
+		p.trie.Set(patricia.Prefix(key), value)
+	}
+	return isNew, nil
+}
+
+func (p *patriciaIndex[V]) Delete(key string) (bool, error) {
+	key, err := p.alphabet.Canonical(key)
+	if err != nil {
+		return false, err
+	}
+	// Delete of the vendored version may report keys it does not hold.
+	if p.trie.Get(patricia.Prefix(key)) == nil {
+		return false, nil
+	}
+	p.trie.Delete(patricia.Prefix(key))
+	p.len--
+	return true, nil
+}
+
+func (p *patriciaIndex[V]) Walk(walker trie.WalkFunc[V]) error {
+	return p.WalkPrefix("", walker)
+}
+
+func (p *patriciaIndex[V]) WalkPrefix(prefix string, walker trie.WalkFunc[V]) error {
+	prefix, err := p.alphabet.Canonical(prefix)
+	if err != nil {
+		return err
+	}
+	p.walkMutex.Lock()
+	defer p.walkMutex.Unlock()
+	if !p.ordered {
+		return p.walkSorted(prefix, walker)
+	}
+	visitor := func(key patricia.Prefix, item patricia.Item) error {
+		err := walker(string(key), item.(V))
+		if err == trie.SkipSubtree {
+			return patricia.SkipSubtree
+		}
+		return err
+	}
+	if err := p.trie.VisitSubtree(patricia.Prefix(prefix), visitor); err != trie.StopWalk {
+		return err
+	}
+	return nil
+}
+
+// walkSorted walks the keys starting with prefix in alphabet order by
+// sorting them first.
+func (p *patriciaIndex[V]) walkSorted(prefix string, walker trie.WalkFunc[V]) error {
+	m := newSortedMapIndex[V](p.alphabet)
+	err := p.trie.VisitSubtree(patricia.Prefix(prefix), func(key patricia.Prefix, item patricia.Item) error {
+		_, err := m.Put(string(key), item.(V))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return m.Walk(walker)
+}
+
+func (p *patriciaIndex[V]) Len() int {
+	return p.len
+}
@@ -0,0 +1,271 @@
+package trie
+
+import (
+	"fmt"
+	"io"
+
+	trie "trie/lib/suffix"
+)
+
+// Snapshot is an immutable point-in-time view of a Trie. Reading it takes
+// no lock: the trie copies the nodes it changes after the snapshot was
+// taken, so it can be saved or scanned while writers go on.
+type Snapshot[P any] struct {
+	// roots holds a snapshot of every stripe in key order.
+	roots []*trie.Trie[*NodeInfo[P]]
+}
+
+// Snapshot takes a snapshot of every stripe at once. Suffix stripes share
+// their nodes with the snapshot; other backends share one copy of their
+// keys between the snapshots taken until their next write, see
+// copiedIndex. It takes the stripe locks shared, so it only waits for
+// writers, and the snapshots taken between two writes share one
+// generation of the suffix stripes.
+func (tr *Trie[P]) Snapshot() *Snapshot[P] {
+	tr.rlockAll()
+	defer tr.runlockAll()
+	roots := make([]*trie.Trie[*NodeInfo[P]], len(tr.stripes))
+	for i, s := range tr.stripes {
+		roots[i] = s.snapshot(tr.alphabet)
+	}
+	return &Snapshot[P]{roots: roots}
+}
+
+// copyIndexes builds a suffix.Trie holding the keys of indexes given in
+// key order. It keeps hashes when hashValue is set.
+func copyIndexes[V any](hashValue func(V) []byte, indexes ...Index[V]) *trie.Trie[V] {
+	t := trie.NewTrie[V](indexes[0].Alphabet())
+	if hashValue != nil {
+		t.EnableHash(hashValue)
+	}
+	// the keys are valid and come in order, so neither can fail.
+	builder, _ := trie.NewBuilder(t)
+	defer builder.Finish()
+	for _, index := range indexes {
+		index.Walk(builder.Add)
+	}
+	return t
+}
+
+// Release lets the trie reuse the memory only the snapshot still reads.
+// The owner of a snapshot must call it once done; the garbage collector
+// only catches snapshots dropped without it from Go 1.24 on. A released
+// snapshot must not be used any more.
+func (s *Snapshot[P]) Release() {
+	for _, root := range s.roots {
+		root.Release()
+	}
+}
+
+// rootOf returns the root holding key, like stripeOf.
+func (s *Snapshot[P]) rootOf(key string) *trie.Trie[*NodeInfo[P]] {
+	if len(s.roots) == 1 || len(key) == 0 {
+		return s.roots[0]
+	}
+	idx := s.roots[0].Alphabet().Index(key[0])
+	if idx < 0 {
+		return s.roots[0]
+	}
+	return s.roots[idx]
+}
+
+func (s *Snapshot[P]) len() int {
+	total := 0
+	for _, root := range s.roots {
+		total += root.Len()
+	}
+	return total
+}
+
+// walk walks the roots in key order. StopWalk ends the walk in all of
+// them.
+func (s *Snapshot[P]) walk(walker trie.WalkFunc[*NodeInfo[P]]) error {
+	stopped := false
+	stopWalker := func(key string, node *NodeInfo[P]) error {
+		err := walker(key, node)
+		stopped = err == StopWalk
+		return err
+	}
+	for _, root := range s.roots {
+		if err := root.Walk(stopWalker); err != nil || stopped {
+			return err
+		}
+	}
+	return nil
+}
+
+// joined returns one suffix.Trie of all keys, which is a copy when the
+// snapshot has more than one root.
+func (s *Snapshot[P]) joined() *trie.Trie[*NodeInfo[P]] {
+	if len(s.roots) == 1 {
+		return s.roots[0]
+	}
+	var hashValue func(*NodeInfo[P]) []byte
+	if s.roots[0].HashEnabled() {
+		hashValue = hashNodeInfo[P]
+	}
+	indexes := make([]Index[*NodeInfo[P]], len(s.roots))
+	for i, root := range s.roots {
+		indexes[i] = root
+	}
+	return copyIndexes(hashValue, indexes...)
+}
+
+func (s *Snapshot[P]) GetRef(key string) (int, error) {
+	return getRef(s.rootOf(key), key)
+}
+
+func (s *Snapshot[P]) GetPayload(key string) (P, error) {
+	return getPayload(s.rootOf(key), key)
+}
+
+func (s *Snapshot[P]) Resolve(abbrev string) (string, error) {
+	if len(abbrev) > 0 {
+		return resolve(abbrev, Index[*NodeInfo[P]](s.rootOf(abbrev)))
+	}
+	roots := make([]Index[*NodeInfo[P]], len(s.roots))
+	for i, root := range s.roots {
+		roots[i] = root
+	}
+	return resolve(abbrev, roots...)
+}
+
+func (s *Snapshot[P]) Select(selector Selector[P]) error {
+	vistor := func(prefix string, node *NodeInfo[P]) error {
+		if selector.Check(prefix, node) {
+			if err := selector.Get(prefix, node); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return s.walk(vistor)
+}
+
+func (s *Snapshot[P]) Save(writer io.Writer) error {
+	return s.SaveCodec(writer, GobCodec)
+}
+
+func (s *Snapshot[P]) SaveCodec(writer io.Writer, codec Codec) error {
+	rw, err := codec.NewWriter(writer, s.len())
+	if err != nil {
+		return fmt.Errorf("Failed to start %s snapshot, err: %v", codec.Name(), err)
+	}
+	alphabet := s.roots[0].Alphabet()
+	vistor := func(prefix string, node *NodeInfo[P]) error {
+		fileNode := FileNode{
+			Ref:           node.ref,
+			Size:          node.size,
+			MediaType:     node.mediaType,
+			Created:       node.created,
+			LastIncrement: node.incremented,
+			LastDecrement: node.decremented,
+			Holders:       node.holders,
+		}
+		if digest, err := alphabet.DecodeBytes(prefix); err == nil {
+			fileNode.Digest = digest
+		} else {
+			fileNode.Prefix = prefix
+		}
+		payload, err := marshalPayload(node.payload)
+		if err != nil {
+			return fmt.Errorf("Failed to encode payload of %s, err: %v", prefix, err)
+		}
+		fileNode.Payload = payload
+		if err := rw.Write(&fileNode); err != nil {
+			return fmt.Errorf("Failed to encode prefix %s with ref %d, err: %v", prefix, node.ref, err)
+		}
+		return nil
+	}
+	if err := s.walk(vistor); err != nil {
+		return err
+	}
+	return rw.Close()
+}
+
+func (s *Snapshot[P]) Iterator() *Iterator[P] {
+	if len(s.roots) == 1 {
+		return &Iterator[P]{
+			it: s.roots[0].Iterator(),
+		}
+	}
+	its := make([]*trie.Iterator[*NodeInfo[P]], len(s.roots))
+	for i, root := range s.roots {
+		its[i] = root.Iterator()
+	}
+	return &Iterator[P]{
+		it: &stripeIterator[*NodeInfo[P]]{its: its, alphabet: s.roots[0].Alphabet()},
+	}
+}
+
+func (s *Snapshot[P]) RangeIterator(start, end string) (*Iterator[P], error) {
+	its := make([]*trie.Iterator[*NodeInfo[P]], len(s.roots))
+	for i, root := range s.roots {
+		it, err := root.RangeIterator(start, end)
+		if err != nil {
+			return nil, err
+		}
+		its[i] = it
+	}
+	if len(its) == 1 {
+		return &Iterator[P]{
+			it: its[0],
+		}, nil
+	}
+	return &Iterator[P]{
+		it: &stripeIterator[*NodeInfo[P]]{its: its, alphabet: s.roots[0].Alphabet()},
+	}, nil
+}
+
+func getRef[P any](root Index[*NodeInfo[P]], key string) (int, error) {
+	node, ok, err := root.Get(key)
+	if err != nil {
+		return -1, err
+	}
+	if ok {
+		return node.ref, nil
+	}
+	return -1, fmt.Errorf("%w %s", ErrNotFound, key)
+}
+
+func getPayload[P any](root Index[*NodeInfo[P]], key string) (P, error) {
+	node, ok, err := root.Get(key)
+	if err != nil || !ok {
+		var payload P
+		if err == nil {
+			err = fmt.Errorf("%w %s", ErrNotFound, key)
+		}
+		return payload, err
+	}
+	return node.payload, nil
+}
+
+// resolve looks for the keys starting with abbrev in indexes given in key
+// order.
+func resolve[V any](abbrev string, roots ...Index[V]) (string, error) {
+	var candidates []string
+	vistor := func(key string, value V) error {
+		candidates = append(candidates, key)
+		if len(candidates) == MaxCandidates {
+			return StopWalk
+		}
+		return nil
+	}
+	for _, root := range roots {
+		if err := root.WalkPrefix(abbrev, vistor); err != nil {
+			return "", err
+		}
+		if len(candidates) == MaxCandidates {
+			break
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		return "", fmt.Errorf("%w %s", ErrNotFound, abbrev)
+	case 1:
+		return candidates[0], nil
+	}
+	return "", &AmbiguousError{Abbrev: abbrev, Candidates: candidates}
+}
@@ -0,0 +1,167 @@
+package trie
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+
+	"gopkg.in/check.v1"
+	"trie/lib/util"
+)
+
+var _ = check.Suite(&SnapshotSuites{})
+
+type SnapshotSuites struct {
+	rand *util.RandString
+}
+
+func (ss *SnapshotSuites) SetUpSuite(c *check.C) {
+	ss.rand = &util.RandString{
+		Sets: "0123456789ABCDEF",
+		Len:  64,
+	}
+}
+
+func (ss *SnapshotSuites) TestPointInTime(c *check.C) {
+	tr := CreateTrie()
+	prefixes := make([]string, 1024)
+	for i := range prefixes {
+		prefixes[i] = ss.rand.String()
+		err := tr.Insert(prefixes[i])
+		c.Assert(err, check.IsNil)
+	}
+	snap := tr.Snapshot()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for _, prefix := range prefixes {
+			tr.Insert(prefix)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1024; i++ {
+			tr.Insert(ss.rand.String())
+		}
+	}()
+
+	buf := &bytes.Buffer{}
+	err := snap.Save(buf)
+	c.Assert(err, check.IsNil)
+	wg.Wait()
+
+	for _, prefix := range prefixes {
+		ref, err := snap.GetRef(prefix)
+		c.Assert(err, check.IsNil)
+		c.Assert(ref, check.Equals, 1)
+		ref, err = tr.GetRef(prefix)
+		c.Assert(err, check.IsNil)
+		c.Assert(ref, check.Equals, 2)
+	}
+
+	loaded := CreateTrie()
+	err = loaded.Load(buf)
+	c.Assert(err, check.IsNil)
+	tsl := &testSelector{}
+	err = loaded.Select(tsl)
+	c.Assert(err, check.IsNil)
+	c.Assert(len(tsl.trash), check.Equals, len(prefixes))
+
+	it := snap.Iterator()
+	count := 0
+	for it.Next() {
+		c.Assert(it.Ref(), check.Equals, 1)
+		count++
+	}
+	c.Assert(count, check.Equals, len(prefixes))
+}
+
+func (ss *SnapshotSuites) TestDeleteAfterSnapshot(c *check.C) {
+	tr := CreateTrie()
+	prefix := ss.rand.String()
+	err := tr.Update(prefix, 2)
+	c.Assert(err, check.IsNil)
+	snap := tr.Snapshot()
+
+	d, err := tr.Delete(prefix)
+	c.Assert(err, check.IsNil)
+	c.Assert(d, check.Equals, false)
+	d, err = tr.Delete(prefix)
+	c.Assert(err, check.IsNil)
+	c.Assert(d, check.Equals, true)
+
+	ref, err := snap.GetRef(prefix)
+	c.Assert(err, check.IsNil)
+	c.Assert(ref, check.Equals, 2)
+	key, err := snap.Resolve(prefix[:8])
+	c.Assert(err, check.IsNil)
+	c.Assert(key, check.Equals, prefix)
+	_, err = tr.Resolve(prefix[:8])
+	c.Assert(err, check.NotNil)
+}
+
+func (ss *SnapshotSuites) TestSnapshotShared(c *check.C) {
+	for _, opts := range [][]Option{nil, {WithLockStriping()}, {WithBackend(PatriciaBackend)}} {
+		tr := CreateTrie(opts...)
+		c.Assert(tr.Insert("3FA9"), check.IsNil)
+		// readers do not keep a snapshot from being taken.
+		tr.rlockAll()
+		snap := tr.Snapshot()
+		tr.runlockAll()
+		ref, err := snap.GetRef("3FA9")
+		c.Assert(err, check.IsNil)
+		c.Assert(ref, check.Equals, 1)
+		snap.Release()
+
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					tr.Snapshot().Release()
+				}
+			}()
+		}
+		for i := 0; i < 100; i++ {
+			c.Assert(tr.Insert(ss.rand.String()), check.IsNil)
+		}
+		wg.Wait()
+		c.Assert(tr.Len(), check.Equals, 101)
+	}
+}
+
+func (ss *SnapshotSuites) TestSharedStripes(c *check.C) {
+	for _, opts := range [][]Option{{WithLockStriping()}, {WithBackend(PatriciaBackend)}, {WithLockStriping(), WithBackend(SortedMapBackend)}} {
+		tr := CreateTrie(opts...)
+		for _, k := range []string{"00AA", "3FA9", "3FA9C1", "A000"} {
+			c.Assert(tr.Insert(k), check.IsNil)
+		}
+		snap := tr.Snapshot()
+		c.Assert(snap.roots, check.HasLen, len(tr.stripes))
+		c.Assert(tr.Insert("A0"), check.IsNil)
+		again := tr.Snapshot()
+
+		// only the stripe written since shares nothing with the first
+		// snapshot.
+		changed := tr.stripeOf("A0")
+		for i, s := range tr.stripes {
+			if root, ok := s.root.(*copiedIndex[*RefNodeInfo]); ok {
+				c.Assert(again.roots[i] == root.copy, check.Equals, true)
+				c.Assert(snap.roots[i] == again.roots[i], check.Equals, s != changed)
+			}
+		}
+		_, err := snap.GetRef("A0")
+		c.Assert(errors.Is(err, ErrNotFound), check.Equals, true)
+		ref, err := again.GetRef("A0")
+		c.Assert(err, check.IsNil)
+		c.Assert(ref, check.Equals, 1)
+		cs := &countSelector{}
+		c.Assert(again.Select(cs), check.IsNil)
+		c.Assert(cs.count, check.Equals, 5)
+		snap.Release()
+		again.Release()
+	}
+}
@@ -0,0 +1,107 @@
+package trie
+
+import (
+	"sort"
+	"strings"
+
+	trie "trie/lib/suffix"
+)
+
+// sortedMapIndex keeps the values in a map and the keys in a sorted slice
+// for walks. Reads are a map lookup, every new or deleted key moves the
+// keys after it.
+type sortedMapIndex[V any] struct {
+	alphabet *trie.Alphabet
+	values   map[string]V
+	keys     []string
+}
+
+func newSortedMapIndex[V any](alphabet *trie.Alphabet) *sortedMapIndex[V] {
+	return &sortedMapIndex[V]{
+		alphabet: alphabet,
+		values:   make(map[string]V),
+	}
+}
+
+func (m *sortedMapIndex[V]) Alphabet() *trie.Alphabet {
+	return m.alphabet
+}
+
+func (m *sortedMapIndex[V]) Get(key string) (V, bool, error) {
+	key, err := m.alphabet.Canonical(key)
+	if err != nil {
+		var value V
+		return value, false, err
+	}
+	value, ok := m.values[key]
+	return value, ok, nil
+}
+
+func (m *sortedMapIndex[V]) Put(key string, value V) (bool, error) {
+	key, err := m.alphabet.Canonical(key)
+	if err != nil {
+		return false, err
+	}
+	_, ok := m.values[key]
+	m.values[key] = value
+	if ok {
+		return false, nil
+	}
+	i := m.search(key)
+	m.keys = append(m.keys, "")
+	copy(m.keys[i+1:], m.keys[i:])
+	m.keys[i] = key
+	return true, nil
+}
+
+func (m *sortedMapIndex[V]) Delete(key string) (bool, error) {
+	key, err := m.alphabet.Canonical(key)
+	if err != nil {
+		return false, err
+	}
+	if _, ok := m.values[key]; !ok {
+		return false, nil
+	}
+	delete(m.values, key)
+	i := m.search(key)
+	m.keys = append(m.keys[:i], m.keys[i+1:]...)
+	return true, nil
+}
+
+func (m *sortedMapIndex[V]) Walk(walker trie.WalkFunc[V]) error {
+	return m.walk(0, "", walker)
+}
+
+func (m *sortedMapIndex[V]) WalkPrefix(prefix string, walker trie.WalkFunc[V]) error {
+	prefix, err := m.alphabet.Canonical(prefix)
+	if err != nil {
+		return err
+	}
+	return m.walk(m.search(prefix), prefix, walker)
+}
+
+func (m *sortedMapIndex[V]) Len() int {
+	return len(m.keys)
+}
+
+// walk visits the keys from offset i on while they start with prefix.
+func (m *sortedMapIndex[V]) walk(i int, prefix string, walker trie.WalkFunc[V]) error {
+	w := &walkSkip[V]{walker: walker}
+	for ; i < len(m.keys) && strings.HasPrefix(m.keys[i], prefix); i++ {
+		key := m.keys[i]
+		if err := w.visit(key, m.values[key]); err != nil {
+			if err == trie.StopWalk {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// search returns the offset of the first key not before key.
+func (m *sortedMapIndex[V]) search(key string) int {
+	return sort.Search(len(m.keys), func(i int) bool {
+		return m.alphabet.Compare(m.keys[i], key) >= 0
+	})
+}
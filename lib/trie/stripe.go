@@ -0,0 +1,159 @@
+package trie
+
+import (
+	"sync"
+
+	trie "trie/lib/suffix"
+)
+
+// stripe is the part of a trie behind one lock. A trie without striping
+// is a single stripe; with striping every leading symbol of the alphabet
+// has its own, so writers to different subtrees do not wait for each
+// other. Reads take the lock shared.
+type stripe[P any] struct {
+	mutex    sync.RWMutex
+	root     Index[*NodeInfo[P]]
+	strict   bool
+	holders  bool
+	notifier *notifier
+	// held maps holders to the keys they reference when the trie keeps
+	// holders. It is guarded by mutex, unlike the flags above which never
+	// change.
+	held map[string]map[string]struct{}
+}
+
+// WithLockStriping splits the trie into one stripe per leading symbol,
+// 16 for hex keys. Reads and writes of one key lock only its stripe,
+// while whole-trie reads and snapshots lock all stripes.
+func WithLockStriping() Option {
+	return func(o *options) {
+		o.striped = true
+	}
+}
+
+func newStripes[P any](o options, alphabet *trie.Alphabet, n *notifier) []*stripe[P] {
+	num := 1
+	if o.striped {
+		num = alphabet.Size()
+	}
+	stripes := make([]*stripe[P], num)
+	for i := range stripes {
+		stripes[i] = &stripe[P]{
+			root:     newStripeIndex[P](o.backend, alphabet),
+			strict:   o.strict,
+			holders:  o.holders,
+			notifier: n,
+		}
+		if o.holders {
+			stripes[i].held = make(map[string]map[string]struct{})
+		}
+	}
+	return stripes
+}
+
+// newStripeIndex returns an empty index of a stripe. Backends without
+// copy-on-write are wrapped in a copiedIndex.
+func newStripeIndex[P any](backend Backend, alphabet *trie.Alphabet) Index[*NodeInfo[P]] {
+	index := newIndex[*NodeInfo[P]](backend, alphabet)
+	if backend == SuffixBackend {
+		return index
+	}
+	return &copiedIndex[*NodeInfo[P]]{Index: index}
+}
+
+// stripeOf returns the stripe holding key. Keys the alphabet rejects go to
+// the first stripe, whose index reports them.
+func (tr *Trie[P]) stripeOf(key string) *stripe[P] {
+	if len(tr.stripes) == 1 || len(key) == 0 {
+		return tr.stripes[0]
+	}
+	idx := tr.alphabet.Index(key[0])
+	if idx < 0 {
+		return tr.stripes[0]
+	}
+	return tr.stripes[idx]
+}
+
+// single returns the only stripe of a trie without striping.
+func (tr *Trie[P]) single() (*stripe[P], bool) {
+	return tr.stripes[0], len(tr.stripes) == 1
+}
+
+// lockAll locks every stripe in order.
+func (tr *Trie[P]) lockAll() {
+	for _, s := range tr.stripes {
+		s.mutex.Lock()
+	}
+}
+
+func (tr *Trie[P]) unlockAll() {
+	for _, s := range tr.stripes {
+		s.mutex.Unlock()
+	}
+}
+
+func (tr *Trie[P]) rlockAll() {
+	for _, s := range tr.stripes {
+		s.mutex.RLock()
+	}
+}
+
+func (tr *Trie[P]) runlockAll() {
+	for _, s := range tr.stripes {
+		s.mutex.RUnlock()
+	}
+}
+
+// suffixRoot returns the index of a stripe when it is a suffix.Trie.
+func (s *stripe[P]) suffixRoot() (*trie.Trie[*NodeInfo[P]], bool) {
+	root, ok := s.root.(*trie.Trie[*NodeInfo[P]])
+	return root, ok
+}
+
+// snapshot returns a read-only suffix.Trie of the keys of the stripe. The
+// caller holds the stripe locked.
+func (s *stripe[P]) snapshot(alphabet *trie.Alphabet) *trie.Trie[*NodeInfo[P]] {
+	switch root := s.root.(type) {
+	case *trie.Trie[*NodeInfo[P]]:
+		return root.Snapshot()
+	case *copiedIndex[*NodeInfo[P]]:
+		return root.snapshot()
+	}
+	// closed, see Cleanup.
+	return trie.NewTrie[*NodeInfo[P]](alphabet)
+}
+
+// copiedIndex is the index of a backend that cannot snapshot itself. The
+// suffix.Trie copy of its keys a snapshot reads is kept and handed to the
+// snapshots after it until the next write, so a stripe nobody writes is
+// copied once. It is guarded by the lock of its stripe, and copy also by
+// mutex, as snapshots are taken under the shared lock.
+type copiedIndex[V any] struct {
+	Index[V]
+	mutex sync.Mutex
+	copy  *trie.Trie[V]
+}
+
+func (ci *copiedIndex[V]) Put(key string, value V) (bool, error) {
+	ci.copy = nil
+	return ci.Index.Put(key, value)
+}
+
+func (ci *copiedIndex[V]) Delete(key string) (bool, error) {
+	deleted, err := ci.Index.Delete(key)
+	if deleted {
+		ci.copy = nil
+	}
+	return deleted, err
+}
+
+// snapshot returns the copy of the keys, taken again after a write. The
+// copy is read-only, so all snapshots until then share it.
+func (ci *copiedIndex[V]) snapshot() *trie.Trie[V] {
+	ci.mutex.Lock()
+	defer ci.mutex.Unlock()
+	if ci.copy == nil {
+		ci.copy = copyIndexes[V](nil, ci.Index).Snapshot()
+	}
+	return ci.copy
+}
@@ -0,0 +1,144 @@
+package trie
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+
+	"gopkg.in/check.v1"
+)
+
+var _ = check.Suite(&StripeSuites{})
+
+type StripeSuites struct {
+}
+
+type countSelector struct {
+	count int
+}
+
+func (cs *countSelector) Check(prefix string, node *RefNodeInfo) bool {
+	return true
+}
+
+func (cs *countSelector) Get(prefix string, node *RefNodeInfo) error {
+	cs.count++
+	return nil
+}
+
+func stripeKeys(num int) []string {
+	keys := make([]string, num)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("%016X", rand.Uint64())
+	}
+	return keys
+}
+
+func (ss *StripeSuites) TestConcurrent(c *check.C) {
+	keys := stripeKeys(4000)
+	for _, opts := range [][]Option{nil, {WithLockStriping()}, {WithLockStriping(), WithBackend(PatriciaBackend)}} {
+		tr := CreateTrie(opts...)
+		var wg sync.WaitGroup
+		for g := 0; g < 8; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for i, k := range keys {
+					switch {
+					case i%8 == g:
+						c.Check(tr.Insert(k), check.IsNil)
+						c.Check(tr.Insert(k), check.IsNil)
+						_, err := tr.Delete(k)
+						c.Check(err, check.IsNil)
+					case i%97 == g:
+						tr.Select(&countSelector{})
+						tr.Len()
+					default:
+						tr.GetRef(k)
+					}
+				}
+			}(g)
+		}
+		wg.Wait()
+		c.Assert(tr.Len(), check.Equals, len(keys))
+		cs := &countSelector{}
+		c.Assert(tr.Select(cs), check.IsNil)
+		c.Assert(cs.count, check.Equals, len(keys))
+		for _, k := range keys[:100] {
+			ref, err := tr.GetRef(k)
+			c.Assert(err, check.IsNil)
+			c.Assert(ref, check.Equals, 1)
+		}
+	}
+}
+
+func (ss *StripeSuites) TestStripedHash(c *check.C) {
+	keys := stripeKeys(500)
+	plain, striped := CreateTrie(), CreateTrie(WithLockStriping())
+	c.Assert(plain.EnableHash(), check.IsNil)
+	c.Assert(striped.EnableHash(), check.IsNil)
+	for _, k := range keys {
+		c.Assert(plain.Insert(k), check.IsNil)
+		c.Assert(striped.Insert(k), check.IsNil)
+	}
+	c.Assert(striped.RootHash(), check.DeepEquals, plain.RootHash())
+
+	c.Assert(striped.Insert(keys[7]), check.IsNil)
+	var diffs []string
+	err := plain.Diff(striped, func(key string, a, b *RefNodeInfo) error {
+		diffs = append(diffs, key)
+		return nil
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(diffs, check.DeepEquals, []string{keys[7]})
+
+	key, err := striped.Resolve("")
+	c.Assert(err, check.ErrorMatches, "Ambiguous prefix.*")
+	c.Assert(key, check.Equals, "")
+}
+
+// benchmarkMixed runs c.N operations over 16 goroutines, one in every
+// writes of them a write and the others reads.
+func (ss *StripeSuites) benchmarkMixed(c *check.C, writes int, opts ...Option) {
+	keys := stripeKeys(1 << 14)
+	tr := CreateTrie(opts...)
+	for _, k := range keys {
+		tr.Insert(k)
+	}
+	const workers = 16
+	c.ResetTimer()
+	var wg sync.WaitGroup
+	for g := 0; g < workers; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(int64(g)))
+			for i := g; i < c.N; i += workers {
+				k := keys[r.Intn(len(keys))]
+				if i%writes == 0 {
+					tr.Insert(k)
+					tr.Delete(k)
+				} else {
+					tr.GetRef(k)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+func (ss *StripeSuites) BenchmarkReadMostlyOneLock(c *check.C) {
+	ss.benchmarkMixed(c, 10)
+}
+
+func (ss *StripeSuites) BenchmarkReadMostlyStriped(c *check.C) {
+	ss.benchmarkMixed(c, 10, WithLockStriping())
+}
+
+func (ss *StripeSuites) BenchmarkWriteHeavyOneLock(c *check.C) {
+	ss.benchmarkMixed(c, 2)
+}
+
+func (ss *StripeSuites) BenchmarkWriteHeavyStriped(c *check.C) {
+	ss.benchmarkMixed(c, 2, WithLockStriping())
+}
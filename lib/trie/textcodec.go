@@ -0,0 +1,252 @@
+package trie
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	trie "trie/lib/suffix"
+)
+
+// The text codecs spell every key out in hex and the payload in base64,
+// times are RFC 3339 and left empty when unset. They have no count or
+// checksum, a file cut between two records loads without error. Holders
+// are listed apart by spaces in CSV.
+
+// textKey returns the key of a record, which Save may have stored as
+// digest.
+func textKey(fileNode *FileNode) (string, error) {
+	if len(fileNode.Digest) > 0 {
+		return trie.HexAlphabet.EncodeBytes(fileNode.Digest)
+	}
+	return fileNode.Prefix, nil
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+func parseTime(s string) (time.Time, error) {
+	if len(s) == 0 {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339Nano, s)
+}
+
+// jsonRecord is one line of a JSON Lines file.
+type jsonRecord struct {
+	Key           string   `json:"key"`
+	Ref           int      `json:"ref"`
+	Size          int64    `json:"size,omitempty"`
+	MediaType     string   `json:"media_type,omitempty"`
+	Created       string   `json:"created,omitempty"`
+	LastIncrement string   `json:"last_increment,omitempty"`
+	LastDecrement string   `json:"last_decrement,omitempty"`
+	Payload       []byte   `json:"payload,omitempty"`
+	Holders       []string `json:"holders,omitempty"`
+}
+
+type jsonlCodec struct{}
+
+func (jsonlCodec) Name() string {
+	return "jsonl"
+}
+
+func (jsonlCodec) NewWriter(writer io.Writer, count int) (RecordWriter, error) {
+	return &jsonlWriter{enc: json.NewEncoder(writer)}, nil
+}
+
+func (jsonlCodec) NewReader(reader io.Reader) (RecordReader, error) {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(nil, maxField)
+	return &jsonlReader{scanner: scanner}, nil
+}
+
+type jsonlWriter struct {
+	enc *json.Encoder
+}
+
+func (jw *jsonlWriter) Write(fileNode *FileNode) error {
+	key, err := textKey(fileNode)
+	if err != nil {
+		return err
+	}
+	return jw.enc.Encode(jsonRecord{
+		Key:           key,
+		Ref:           fileNode.Ref,
+		Size:          fileNode.Size,
+		MediaType:     fileNode.MediaType,
+		Created:       formatTime(fileNode.Created),
+		LastIncrement: formatTime(fileNode.LastIncrement),
+		LastDecrement: formatTime(fileNode.LastDecrement),
+		Payload:       fileNode.Payload,
+		Holders:       fileNode.Holders,
+	})
+}
+
+func (jw *jsonlWriter) Close() error {
+	return nil
+}
+
+type jsonlReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func (jr *jsonlReader) Read(fileNode *FileNode) error {
+	for jr.scanner.Scan() {
+		jr.line++
+		if len(jr.scanner.Bytes()) == 0 {
+			continue
+		}
+		var record jsonRecord
+		if err := json.Unmarshal(jr.scanner.Bytes(), &record); err != nil {
+			return fmt.Errorf("%w, failed to decode line %d, err: %v", ErrCorrupt, jr.line, err)
+		}
+		*fileNode = FileNode{
+			Prefix:    record.Key,
+			Ref:       record.Ref,
+			Payload:   record.Payload,
+			Size:      record.Size,
+			MediaType: record.MediaType,
+			Holders:   record.Holders,
+		}
+		err := parseTimes(fileNode, record.Created, record.LastIncrement, record.LastDecrement)
+		if err != nil {
+			return fmt.Errorf("%w, failed to decode line %d, err: %v", ErrCorrupt, jr.line, err)
+		}
+		return nil
+	}
+	if err := jr.scanner.Err(); err != nil {
+		return err
+	}
+	return io.EOF
+}
+
+func parseTimes(fileNode *FileNode, created, incremented, decremented string) error {
+	var err error
+	if fileNode.Created, err = parseTime(created); err != nil {
+		return err
+	}
+	if fileNode.LastIncrement, err = parseTime(incremented); err != nil {
+		return err
+	}
+	fileNode.LastDecrement, err = parseTime(decremented)
+	return err
+}
+
+// csvHeader names the columns, files written before holders lack the last.
+var csvHeader = []string{"key", "ref", "size", "media_type", "created", "last_increment", "last_decrement", "payload", "holders"}
+
+type csvCodec struct{}
+
+func (csvCodec) Name() string {
+	return "csv"
+}
+
+func (csvCodec) NewWriter(writer io.Writer, count int) (RecordWriter, error) {
+	cw := csv.NewWriter(writer)
+	if err := cw.Write(csvHeader); err != nil {
+		return nil, err
+	}
+	return &csvWriter{writer: cw}, nil
+}
+
+func (csvCodec) NewReader(reader io.Reader) (RecordReader, error) {
+	// the rows have as many columns as the header.
+	cr := csv.NewReader(reader)
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%w, no csv header", ErrCorrupt)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w, failed to read csv header, err: %v", ErrCorrupt, err)
+	}
+	if len(header) != len(csvHeader) && len(header) != len(csvHeader)-1 {
+		return nil, fmt.Errorf("%w, %d csv columns, want %d", ErrCorrupt, len(header), len(csvHeader))
+	}
+	for i, name := range csvHeader[:len(header)] {
+		if header[i] != name {
+			return nil, fmt.Errorf("%w, column %d is %s, want %s", ErrCorrupt, i, header[i], name)
+		}
+	}
+	return &csvReader{reader: cr}, nil
+}
+
+type csvWriter struct {
+	writer *csv.Writer
+}
+
+func (cw *csvWriter) Write(fileNode *FileNode) error {
+	key, err := textKey(fileNode)
+	if err != nil {
+		return err
+	}
+	return cw.writer.Write([]string{
+		key,
+		strconv.Itoa(fileNode.Ref),
+		strconv.FormatInt(fileNode.Size, 10),
+		fileNode.MediaType,
+		formatTime(fileNode.Created),
+		formatTime(fileNode.LastIncrement),
+		formatTime(fileNode.LastDecrement),
+		base64.StdEncoding.EncodeToString(fileNode.Payload),
+		strings.Join(fileNode.Holders, " "),
+	})
+}
+
+func (cw *csvWriter) Close() error {
+	cw.writer.Flush()
+	return cw.writer.Error()
+}
+
+type csvReader struct {
+	reader *csv.Reader
+}
+
+func (cr *csvReader) Read(fileNode *FileNode) error {
+	row, err := cr.reader.Read()
+	if err == io.EOF {
+		return err
+	}
+	if err == nil {
+		err = decodeRow(fileNode, row)
+	}
+	if err != nil {
+		line, _ := cr.reader.FieldPos(0)
+		return fmt.Errorf("%w, failed to decode line %d, err: %v", ErrCorrupt, line, err)
+	}
+	return nil
+}
+
+func decodeRow(fileNode *FileNode, row []string) error {
+	ref, err := strconv.Atoi(row[1])
+	if err != nil {
+		return err
+	}
+	size, err := strconv.ParseInt(row[2], 10, 64)
+	if err != nil {
+		return err
+	}
+	payload, err := base64.StdEncoding.DecodeString(row[7])
+	if err != nil {
+		return err
+	}
+	if len(payload) == 0 {
+		payload = nil
+	}
+	*fileNode = FileNode{Prefix: row[0], Ref: ref, Size: size, MediaType: row[3], Payload: payload}
+	if len(row) > 8 {
+		fileNode.Holders = strings.Fields(row[8])
+	}
+	return parseTimes(fileNode, row[4], row[5], row[6])
+}
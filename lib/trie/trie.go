@@ -1,164 +1,378 @@
 package trie
 
 import (
-	"encoding/gob"
+	"encoding"
+	"errors"
 	"fmt"
 	"io"
-	"sync"
+	"strings"
+	"time"
 
 	trie "trie/lib/suffix"
+	"trie/lib/util"
 )
 
-type Trie struct {
-	root  *trie.Trie
-	mutex *sync.Mutex
+// MaxCandidates bounds the number of keys an AmbiguousError lists.
+const MaxCandidates = 16
+
+var (
+	// ErrNotFound, ErrRefUnderflow, ErrClosed and ErrInvalidKey are those
+	// of lib/util, which the dbs and storage drivers wrap as well.
+	ErrNotFound     = util.ErrNotFound
+	ErrRefUnderflow = util.ErrRefUnderflow
+	ErrClosed       = util.ErrClosed
+	ErrInvalidKey   = util.ErrInvalidKey
+	ErrAmbiguous    = errors.New("Ambiguous prefix")
+	// SkipSubtree and StopWalk may be returned by Selector.Get to skip
+	// the keys extending the current one or to end the selection.
+	SkipSubtree = trie.SkipSubtree
+	StopWalk    = trie.StopWalk
+)
+
+// AmbiguousError is returned by Resolve when more than one key starts with
+// the abbreviation. It matches ErrAmbiguous with errors.Is.
+type AmbiguousError struct {
+	Abbrev     string
+	Candidates []string
+}
+
+func (e *AmbiguousError) Error() string {
+	return fmt.Sprintf("Ambiguous prefix %s, candidates: %s", e.Abbrev, strings.Join(e.Candidates, ", "))
+}
+
+func (e *AmbiguousError) Unwrap() error {
+	return ErrAmbiguous
+}
+
+// Trie counts references to keys. Next to the count every key may carry
+// a payload of type P; RefTrie is the plain counting trie without one.
+type Trie[P any] struct {
+	alphabet *trie.Alphabet
+	backend  Backend
+	stripes  []*stripe[P]
+	notifier *notifier
 }
 
-type NodeInfo struct {
-	ref int
+// NodeInfo is the state of one key. Snapshots share NodeInfo values with
+// the trie, so they are replaced on every change and never modified.
+type NodeInfo[P any] struct {
+	ref         int
+	payload     P
+	size        int64
+	mediaType   string
+	created     time.Time
+	incremented time.Time
+	decremented time.Time
+	holders     []string
 }
 
+type (
+	RefTrie     = Trie[struct{}]
+	RefNodeInfo = NodeInfo[struct{}]
+)
+
+// FileNode is one record of a saved trie. Keys that end on a byte
+// boundary are stored as the bytes in Digest, other keys in Prefix.
+// Payloads implementing encoding.BinaryMarshaler are kept in Payload.
+// Files written before the metadata fields load with them zero.
 type FileNode struct {
-	Prefix string
-	Ref    int
+	Prefix        string
+	Ref           int
+	Digest        []byte
+	Payload       []byte
+	Size          int64
+	MediaType     string
+	Created       time.Time
+	LastIncrement time.Time
+	LastDecrement time.Time
+	Holders       []string
 }
 
-type Selector interface {
-	Check(prefix string, node *NodeInfo) bool
-	Get(prefix string, node *NodeInfo) error
+type Selector[P any] interface {
+	Check(prefix string, node *NodeInfo[P]) bool
+	Get(prefix string, node *NodeInfo[P]) error
 }
 
-func CreateTrie() *Trie {
-	return &Trie{
-		root:  trie.NewTrie(),
-		mutex: &sync.Mutex{},
-	}
+func (n *NodeInfo[P]) Ref() int {
+	return n.ref
 }
 
-func (tr *Trie) Insert(key string) error {
-	tr.mutex.Lock()
-	defer tr.mutex.Unlock()
-	item := tr.root.Get(key)
-	if item != nil {
-		node := tr.getNode(item)
-		node.ref++
-		//fmt.Printf("Got prefix %s, update ref to %d\n", key, node.ref)
-		return nil
+func (n *NodeInfo[P]) Payload() P {
+	return n.payload
+}
+
+func CreateTrie(opts ...Option) *RefTrie {
+	return NewTrie[struct{}](opts...)
+}
+
+// NewTrie creates a trie on the suffix backend under one lock unless
+// WithBackend or WithLockStriping say otherwise.
+func NewTrie[P any](opts ...Option) *Trie[P] {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
 	}
-	if ret := tr.root.Put(key, &NodeInfo{ref: 1}); ret {
-		return nil
+	n := &notifier{}
+	return &Trie[P]{
+		alphabet: trie.HexAlphabet,
+		backend:  o.backend,
+		stripes:  newStripes[P](o, trie.HexAlphabet, n),
+		notifier: n,
 	}
-
-	return fmt.Errorf("Failed to insert %s", key)
 }
 
-func (tr *Trie) GetRef(key string) (int, error) {
-	tr.mutex.Lock()
-	defer tr.mutex.Unlock()
-	if item := tr.root.Get(key); item != nil {
-		node := tr.getNode(item)
-		return node.ref, nil
+// WithStrict makes dropping a reference which is not there an error:
+// Delete or Update to ref 0 of a missing key fails with ErrNotFound.
+func WithStrict() Option {
+	return func(o *options) {
+		o.strict = true
 	}
-	return -1, fmt.Errorf("Not found %s", key)
 }
 
-func (tr *Trie) Update(key string, ref int) error {
-	tr.mutex.Lock()
-	defer tr.mutex.Unlock()
+// Alphabet returns the alphabet of the keys, which never changes.
+func (tr *Trie[P]) Alphabet() *trie.Alphabet {
+	return tr.alphabet
+}
 
-	if item := tr.root.Get(key); item != nil {
-		node := tr.getNode(item)
-		node.ref = ref
-		return nil
-	}
+func (tr *Trie[P]) Insert(key string) error {
+	s := tr.stripeOf(key)
+	defer tr.notifier.flush()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, err := s.insert(key)
+	return err
+}
 
-	if ret := tr.root.Put(key, &NodeInfo{ref: ref}); ret {
-		return nil
+// insert takes one more reference to key and returns its ref.
+func (s *stripe[P]) insert(key string) (int, error) {
+	node, ok, err := s.root.Get(key)
+	if err != nil {
+		return -1, err
+	}
+	now := timeNow()
+	info := &NodeInfo[P]{ref: 1, created: now}
+	if ok {
+		info = node.clone()
+		info.ref++
 	}
-	return fmt.Errorf("Failed to update %s with ref %d", key, ref)
+	info.incremented = now
+	if _, err := s.root.Put(key, info); err != nil {
+		return -1, err
+	}
+	s.notifier.push(key, info.ref-1, info.ref)
+	return info.ref, nil
 }
 
-func (tr *Trie) Delete(key string) (bool, error) {
-	tr.mutex.Lock()
-	defer tr.mutex.Unlock()
+func (tr *Trie[P]) GetRef(key string) (int, error) {
+	s := tr.stripeOf(key)
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return getRef(s.root, key)
+}
 
-	if item := tr.root.Get(key); item != nil {
-		node := tr.getNode(item)
-		node.ref--
-		if node.ref <= 0 {
-			if d := tr.root.Delete(key); d {
-				return true, nil
-			}
-			return false, fmt.Errorf("Failed to delete %s", key)
-		}
+// Update sets the ref of key. Ref 0 deletes the key, a negative ref fails
+// with ErrRefUnderflow.
+func (tr *Trie[P]) Update(key string, ref int) error {
+	if ref < 0 {
+		return fmt.Errorf("%w updating %s to %d", ErrRefUnderflow, key, ref)
 	}
-	return false, nil
-}
+	s := tr.stripeOf(key)
+	defer tr.notifier.flush()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 
-func (tr *Trie) Select(selector Selector) error {
-	tr.mutex.Lock()
-	defer tr.mutex.Unlock()
-	vistor := func(prefix string, item interface{}) error {
-		node := tr.getNode(item)
-		if selector.Check(prefix, node) {
-			if err := selector.Get(prefix, node); err != nil {
-				return err
+	node, ok, err := s.root.Get(key)
+	if err != nil {
+		return fmt.Errorf("Failed to update %s with ref %d, err: %w", key, ref, err)
+	}
+	old := 0
+	if ok {
+		old = node.ref
+	}
+	if s.holders && ok && ref < len(node.holders) {
+		return fmt.Errorf("%w updating %s to %d, held by %d", ErrRefUnderflow, key, ref, len(node.holders))
+	}
+	if ref == 0 {
+		if !ok {
+			if s.strict {
+				return fmt.Errorf("%w %s", ErrNotFound, key)
 			}
+			return nil
 		}
+		if _, err := s.root.Delete(key); err != nil {
+			return fmt.Errorf("Failed to update %s with ref %d, err: %w", key, ref, err)
+		}
+		s.notifier.push(key, old, 0)
 		return nil
 	}
+	now := timeNow()
+	info := &NodeInfo[P]{created: now}
+	if ok {
+		info = node.clone()
+	}
+	switch {
+	case ref > info.ref:
+		info.incremented = now
+	case ref < info.ref:
+		info.decremented = now
+	}
+	info.ref = ref
+	if _, err := s.root.Put(key, info); err != nil {
+		return fmt.Errorf("Failed to update %s with ref %d, err: %w", key, ref, err)
+	}
+	s.notifier.push(key, old, ref)
+	return nil
+}
 
-	return tr.root.Walk(vistor)
+func (tr *Trie[P]) Delete(key string) (bool, error) {
+	s := tr.stripeOf(key)
+	defer tr.notifier.flush()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, deleted, err := s.delete(key)
+	return deleted, err
 }
 
-func (tr *Trie) Save(writer io.Writer) error {
-	tr.mutex.Lock()
-	defer tr.mutex.Unlock()
-	enc := gob.NewEncoder(writer)
-	vistor := func(prefix string, item interface{}) error {
-		node := tr.getNode(item)
-		fileNode := FileNode{
-			Prefix: prefix,
-			Ref:    node.ref,
+// delete drops one reference to key and returns the ref left and whether
+// the key went with the last one. A missing key is left alone, which
+// strict stripes report.
+func (s *stripe[P]) delete(key string) (int, bool, error) {
+	node, ok, err := s.root.Get(key)
+	if err != nil {
+		return 0, false, err
+	}
+	if !ok {
+		if s.strict {
+			return 0, false, fmt.Errorf("%w %s", ErrNotFound, key)
+		}
+		return 0, false, nil
+	}
+	if s.strict && node.ref <= 0 {
+		return node.ref, false, fmt.Errorf("%w deleting %s at ref %d", ErrRefUnderflow, key, node.ref)
+	}
+	if s.holders && len(node.holders) > 0 && node.anonymous() <= 0 {
+		return node.ref, false, fmt.Errorf("%w deleting %s, held by %d", ErrRefUnderflow, key, len(node.holders))
+	}
+	if node.ref > 1 {
+		info := node.clone()
+		info.ref--
+		info.decremented = timeNow()
+		if _, err := s.root.Put(key, info); err != nil {
+			return node.ref, false, err
 		}
-		if err := enc.Encode(fileNode); err != nil {
-			return fmt.Errorf("Failed to encode prefix %s with ref %d, err: %v", prefix, node.ref, err)
+		s.notifier.push(key, node.ref, info.ref)
+		return info.ref, false, nil
+	}
+	if d, err := s.root.Delete(key); d || err != nil {
+		if d {
+			s.notifier.push(key, node.ref, 0)
 		}
-		return nil
+		return 0, d, err
 	}
-	return tr.root.Walk(vistor)
+	return 0, false, fmt.Errorf("Failed to delete %s", key)
+}
+
+func (tr *Trie[P]) GetPayload(key string) (P, error) {
+	s := tr.stripeOf(key)
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return getPayload(s.root, key)
 }
 
-func (tr *Trie) Load(reader io.Reader) error {
-	tr.mutex.Lock()
-	defer tr.mutex.Unlock()
-	decoder := gob.NewDecoder(reader)
-	var fileNode FileNode
-	for {
-		err := decoder.Decode(&fileNode)
-		if err == io.EOF {
-			break
+// SetPayload replaces the payload of a key which is in the trie.
+func (tr *Trie[P]) SetPayload(key string, payload P) error {
+	s := tr.stripeOf(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	node, ok, err := s.root.Get(key)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w %s", ErrNotFound, key)
+	}
+	info := node.clone()
+	info.payload = payload
+	_, err = s.root.Put(key, info)
+	return err
+}
+
+// Resolve expands an abbreviated key to the only key starting with it.
+// An empty abbreviation looks into every stripe.
+func (tr *Trie[P]) Resolve(abbrev string) (string, error) {
+	if len(abbrev) > 0 {
+		s := tr.stripeOf(abbrev)
+		s.mutex.RLock()
+		defer s.mutex.RUnlock()
+		return resolve(abbrev, s.root)
+	}
+	tr.rlockAll()
+	defer tr.runlockAll()
+	return resolve(abbrev, tr.roots()...)
+}
+
+// Select runs selector over a snapshot of the trie, so writers are not
+// blocked while it runs.
+func (tr *Trie[P]) Select(selector Selector[P]) error {
+	if tr.closed() {
+		return ErrClosed
+	}
+	snap := tr.Snapshot()
+	defer snap.Release()
+	return snap.Select(selector)
+}
+
+// Save writes a snapshot of the trie with GobCodec, so writers are not
+// blocked while it is encoded and written.
+func (tr *Trie[P]) Save(writer io.Writer) error {
+	return tr.SaveCodec(writer, GobCodec)
+}
+
+// Load puts the records written by Save over the trie, see LoadOverwrite.
+// A file which is truncated or fails its checksum is rejected with
+// ErrCorrupt before any key is added.
+func (tr *Trie[P]) Load(reader io.Reader) error {
+	return tr.LoadCodec(reader, GobCodec)
+}
+
+// Cleanup frees the keys and closes the trie, which answers ErrClosed
+// from then on.
+func (tr *Trie[P]) Cleanup() {
+	tr.lockAll()
+	defer tr.unlockAll()
+	for _, s := range tr.stripes {
+		if root, ok := s.suffixRoot(); ok {
+			trie.FreeTrie(root)
 		}
-		if err != nil {
-			return fmt.Errorf("Failed to decode %v, err: %v", reader, err)
+		s.root = closedIndex[*NodeInfo[P]]{alphabet: tr.alphabet}
+		if s.holders {
+			s.held = make(map[string]map[string]struct{})
 		}
-		tr.root.Put(fileNode.Prefix, &NodeInfo{ref: fileNode.Ref})
 	}
+}
 
-	return nil
+// roots returns the indexes of all stripes in key order.
+func (tr *Trie[P]) roots() []Index[*NodeInfo[P]] {
+	roots := make([]Index[*NodeInfo[P]], len(tr.stripes))
+	for i, s := range tr.stripes {
+		roots[i] = s.root
+	}
+	return roots
 }
 
-func (tr *Trie) Cleanup() {
-	tr.mutex.Lock()
-	defer tr.mutex.Unlock()
-	trie.FreeTrie(tr.root)
-	tr.root = nil
+func marshalPayload(payload interface{}) ([]byte, error) {
+	if m, ok := payload.(encoding.BinaryMarshaler); ok {
+		return m.MarshalBinary()
+	}
+	return nil, nil
 }
 
-func (tr *Trie) getNode(item interface{}) *NodeInfo {
-	node, ok := item.(*NodeInfo)
-	if !ok {
+func unmarshalPayload(data []byte, payload interface{}) error {
+	if len(data) == 0 {
 		return nil
 	}
-	return node
+	if u, ok := payload.(encoding.BinaryUnmarshaler); ok {
+		return u.UnmarshalBinary(data)
+	}
+	return fmt.Errorf("%T cannot be unmarshaled", payload)
 }
@@ -1,6 +1,9 @@
 package trie
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -15,7 +18,7 @@ func Test(t *testing.T) { check.TestingT(t) }
 var _ = check.Suite(&TrieSuites{})
 
 type TrieSuites struct {
-	trie     *Trie
+	trie     *RefTrie
 	rand     *util.RandString
 	prefixes map[string]int
 }
@@ -57,7 +60,7 @@ func (ts *TrieSuites) TestInsertDelete(c *check.C) {
 	c.Assert(d, check.Equals, true)
 }
 
-func (ts *TrieSuites) insertDeleteMany(c *check.C, trie *Trie) {
+func (ts *TrieSuites) insertDeleteMany(c *check.C, trie *RefTrie) {
 	prefixes := ts.prefixes
 	for k, _ := range prefixes {
 		err := trie.Insert(k)
@@ -126,16 +129,40 @@ func (ts *TrieSuites) TestSaveLoad(c *check.C) {
 	}
 }
 
+func (ts *TrieSuites) TestLoadIntoFilled(c *check.C) {
+	saved := CreateTrie()
+	for _, k := range []string{"00", "3FA9", "3FA9", "A0"} {
+		c.Assert(saved.Insert(k), check.IsNil)
+	}
+	var buf bytes.Buffer
+	c.Assert(saved.Save(&buf), check.IsNil)
+	data := buf.Bytes()
+
+	c.Assert(ts.trie.Load(bytes.NewReader(data)), check.IsNil)
+	c.Assert(ts.trie.Len(), check.Equals, 3)
+	// loading into a filled trie replaces the refs of the keys it holds.
+	c.Assert(ts.trie.Insert("3FA9"), check.IsNil)
+	c.Assert(ts.trie.Insert("FF"), check.IsNil)
+	c.Assert(ts.trie.Load(bytes.NewReader(data)), check.IsNil)
+	c.Assert(ts.trie.Len(), check.Equals, 4)
+	ref, err := ts.trie.GetRef("3FA9")
+	c.Assert(err, check.IsNil)
+	c.Assert(ref, check.Equals, 2)
+	count, err := ts.trie.CountPrefix("3")
+	c.Assert(err, check.IsNil)
+	c.Assert(count, check.Equals, 1)
+}
+
 type testSelector struct {
 	ref   int
 	trash []string
 }
 
-func (tsl *testSelector) Check(prefix string, node *NodeInfo) bool {
+func (tsl *testSelector) Check(prefix string, node *RefNodeInfo) bool {
 	return node.ref == node.ref
 }
 
-func (tsl *testSelector) Get(prefix string, node *NodeInfo) error {
+func (tsl *testSelector) Get(prefix string, node *RefNodeInfo) error {
 	tsl.trash = append(tsl.trash, prefix)
 	return nil
 }
@@ -145,6 +172,7 @@ func (ts *TrieSuites) TestZeroSelector(c *check.C) {
 	num := 200000
 	prefixes := make(map[string]int)
 
+	buf := &bytes.Buffer{}
 	for count := 0; count < num; {
 		var ok bool
 		prefix := ts.rand.String()
@@ -153,8 +181,9 @@ func (ts *TrieSuites) TestZeroSelector(c *check.C) {
 		}
 		count++
 		prefixes[prefix] = count
-		err := ts.trie.Update(prefix, 0)
+		err := ts.trie.Update(prefix, 1)
 		c.Assert(err, check.IsNil)
+		fmt.Fprintf(buf, "{\"key\":%q,\"ref\":0}\n", prefix)
 	}
 
 	err := ts.trie.Select(tsl)
@@ -163,8 +192,137 @@ func (ts *TrieSuites) TestZeroSelector(c *check.C) {
 	for _, prefix := range tsl.trash {
 		delete(prefixes, prefix)
 	}
-
 	c.Assert(len(prefixes), check.Equals, 0)
+
+	// records at ref 0 delete their keys like Update does.
+	c.Assert(ts.trie.LoadCodec(buf, JSONLCodec), check.IsNil)
+	c.Assert(ts.trie.Len(), check.Equals, 0)
+}
+
+func (ts *TrieSuites) TestResolve(c *check.C) {
+	keys := []string{"3FA9C1AA", "3FA9C2BB", "3FB0"}
+	for _, k := range keys {
+		err := ts.trie.Insert(k)
+		c.Assert(err, check.IsNil)
+	}
+
+	key, err := ts.trie.Resolve("3fa9c1")
+	c.Assert(err, check.IsNil)
+	c.Assert(key, check.Equals, "3FA9C1AA")
+	key, err = ts.trie.Resolve("3FB0")
+	c.Assert(err, check.IsNil)
+	c.Assert(key, check.Equals, "3FB0")
+
+	_, err = ts.trie.Resolve("3FA9")
+	c.Assert(errors.Is(err, ErrAmbiguous), check.Equals, true)
+	var aerr *AmbiguousError
+	c.Assert(errors.As(err, &aerr), check.Equals, true)
+	c.Assert(aerr.Candidates, check.DeepEquals, []string{"3FA9C1AA", "3FA9C2BB"})
+
+	_, err = ts.trie.Resolve("3FA9C3")
+	c.Assert(errors.Is(err, ErrNotFound), check.Equals, true)
+	_, err = ts.trie.Resolve("3G")
+	c.Assert(err, check.NotNil)
+}
+
+type stopSelector struct {
+	keys []string
+	err  error
+}
+
+func (ssl *stopSelector) Check(prefix string, node *RefNodeInfo) bool {
+	return node.ref > 1
+}
+
+func (ssl *stopSelector) Get(prefix string, node *RefNodeInfo) error {
+	ssl.keys = append(ssl.keys, prefix)
+	return ssl.err
+}
+
+func (ts *TrieSuites) TestSelectorControl(c *check.C) {
+	refs := map[string]int{"10": 2, "10A": 2, "10B": 1, "2": 1, "20": 3, "21": 3}
+	for k, ref := range refs {
+		err := ts.trie.Update(k, ref)
+		c.Assert(err, check.IsNil)
+	}
+
+	sl := &stopSelector{err: SkipSubtree}
+	err := ts.trie.Select(sl)
+	c.Assert(err, check.IsNil)
+	c.Assert(sl.keys, check.DeepEquals, []string{"10", "20", "21"})
+
+	sl = &stopSelector{err: StopWalk}
+	err = ts.trie.Select(sl)
+	c.Assert(err, check.IsNil)
+	c.Assert(sl.keys, check.DeepEquals, []string{"10"})
+
+	failed := errors.New("failed")
+	sl = &stopSelector{err: failed}
+	err = ts.trie.Select(sl)
+	c.Assert(err, check.Equals, failed)
+	c.Assert(sl.keys, check.DeepEquals, []string{"10"})
+}
+
+type testPayload struct {
+	size uint32
+}
+
+func (tp testPayload) MarshalBinary() ([]byte, error) {
+	return []byte{byte(tp.size >> 8), byte(tp.size)}, nil
+}
+
+func (tp *testPayload) UnmarshalBinary(data []byte) error {
+	tp.size = uint32(data[0])<<8 | uint32(data[1])
+	return nil
+}
+
+type payloadSelector struct {
+	sizes map[string]uint32
+}
+
+func (psl *payloadSelector) Check(prefix string, node *NodeInfo[testPayload]) bool {
+	return node.Payload().size > 0
+}
+
+func (psl *payloadSelector) Get(prefix string, node *NodeInfo[testPayload]) error {
+	psl.sizes[prefix] = node.Payload().size
+	return nil
+}
+
+func (ts *TrieSuites) TestPayload(c *check.C) {
+	tr := NewTrie[testPayload]()
+	err := tr.SetPayload("3FA9", testPayload{size: 1})
+	c.Assert(errors.Is(err, ErrNotFound), check.Equals, true)
+
+	for _, k := range []string{"3FA9", "3FA9", "00"} {
+		err := tr.Insert(k)
+		c.Assert(err, check.IsNil)
+	}
+	err = tr.SetPayload("3fa9", testPayload{size: 300})
+	c.Assert(err, check.IsNil)
+	err = tr.Insert("3FA9")
+	c.Assert(err, check.IsNil)
+	d, err := tr.Delete("3FA9")
+	c.Assert(err, check.IsNil)
+	c.Assert(d, check.Equals, false)
+	payload, err := tr.GetPayload("3FA9")
+	c.Assert(err, check.IsNil)
+	c.Assert(payload.size, check.Equals, uint32(300))
+
+	buf := &bytes.Buffer{}
+	err = tr.Save(buf)
+	c.Assert(err, check.IsNil)
+	loaded := NewTrie[testPayload]()
+	err = loaded.Load(buf)
+	c.Assert(err, check.IsNil)
+	ref, err := loaded.GetRef("3FA9")
+	c.Assert(err, check.IsNil)
+	c.Assert(ref, check.Equals, 2)
+
+	psl := &payloadSelector{sizes: make(map[string]uint32)}
+	err = loaded.Select(psl)
+	c.Assert(err, check.IsNil)
+	c.Assert(psl.sizes, check.DeepEquals, map[string]uint32{"3FA9": 300})
 }
 
 func (ts *TrieSuites) BenchmarkInsertDeleteMany(c *check.C) {
@@ -200,3 +358,77 @@ func (ts *TrieSuites) getStrings(num int, diff bool) map[string]int {
 
 	return prefixes
 }
+
+func (ts *TrieSuites) TestTypedErrors(c *check.C) {
+	ref, err := ts.trie.GetRef("3FA9")
+	c.Assert(errors.Is(err, ErrNotFound), check.Equals, true)
+	c.Assert(ref, check.Equals, -1)
+	_, err = ts.trie.GetPayload("3FA9")
+	c.Assert(errors.Is(err, ErrNotFound), check.Equals, true)
+	err = ts.trie.Insert("sha256:3FA9")
+	c.Assert(errors.Is(err, ErrInvalidKey), check.Equals, true)
+	err = ts.trie.Update("XY", 1)
+	c.Assert(errors.Is(err, ErrInvalidKey), check.Equals, true)
+
+	// without strict mode releasing a missing key goes unnoticed.
+	d, err := ts.trie.Delete("3FA9")
+	c.Assert(err, check.IsNil)
+	c.Assert(d, check.Equals, false)
+	c.Assert(ts.trie.Update("3FA9", 0), check.IsNil)
+	c.Assert(ts.trie.Len(), check.Equals, 0)
+}
+
+func (ts *TrieSuites) TestUpdateNonPositive(c *check.C) {
+	for _, opts := range [][]Option{nil, {WithLockStriping(), WithBackend(PatriciaBackend)}} {
+		tr := CreateTrie(opts...)
+		err := tr.Update("CC", -2)
+		c.Assert(errors.Is(err, ErrRefUnderflow), check.Equals, true)
+		c.Assert(tr.Len(), check.Equals, 0)
+
+		c.Assert(tr.Update("CC", 2), check.IsNil)
+		err = tr.Update("CC", -1)
+		c.Assert(errors.Is(err, ErrRefUnderflow), check.Equals, true)
+		ref, err := tr.GetRef("CC")
+		c.Assert(err, check.IsNil)
+		c.Assert(ref, check.Equals, 2)
+
+		c.Assert(tr.Update("CC", 0), check.IsNil)
+		_, err = tr.GetRef("CC")
+		c.Assert(errors.Is(err, ErrNotFound), check.Equals, true)
+		c.Assert(tr.Len(), check.Equals, 0)
+	}
+}
+
+func (ts *TrieSuites) TestStrict(c *check.C) {
+	for _, opts := range [][]Option{{WithStrict()}, {WithStrict(), WithLockStriping(), WithBackend(SortedMapBackend)}} {
+		tr := CreateTrie(opts...)
+		c.Assert(tr.Insert("3FA9"), check.IsNil)
+		d, err := tr.Delete("3FA9")
+		c.Assert(err, check.IsNil)
+		c.Assert(d, check.Equals, true)
+		d, err = tr.Delete("3FA9")
+		c.Assert(errors.Is(err, ErrNotFound), check.Equals, true)
+		c.Assert(d, check.Equals, false)
+
+		err = tr.Update("3FA9", -1)
+		c.Assert(errors.Is(err, ErrRefUnderflow), check.Equals, true)
+		c.Assert(tr.Update("3FA9", 2), check.IsNil)
+		c.Assert(tr.Update("3FA9", 0), check.IsNil)
+		_, err = tr.GetRef("3FA9")
+		c.Assert(errors.Is(err, ErrNotFound), check.Equals, true)
+
+		err = tr.Update("3FA9", 0)
+		c.Assert(errors.Is(err, ErrNotFound), check.Equals, true)
+
+		// a key loaded at ref 0 is deleted, not kept for an underflow.
+		c.Assert(tr.Insert("00"), check.IsNil)
+		buf := bytes.NewBufferString("{\"key\":\"00\",\"ref\":0}\n")
+		c.Assert(tr.LoadCodec(buf, JSONLCodec), check.IsNil)
+		_, err = tr.Delete("00")
+		c.Assert(errors.Is(err, ErrNotFound), check.Equals, true)
+
+		results, err := tr.DeleteBatch([]string{"00", "3FA9"})
+		c.Assert(errors.Is(err, ErrNotFound), check.Equals, true)
+		c.Assert(errors.Is(results[1].Err, ErrNotFound), check.Equals, true)
+	}
+}
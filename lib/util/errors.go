@@ -0,0 +1,14 @@
+package util
+
+import "errors"
+
+// The errors shared by the tries, the dbs and the storage drivers, which
+// wrap them so that errors.Is finds them at every layer.
+var (
+	ErrNotFound = errors.New("Not found")
+	// ErrRefUnderflow is returned when a ref would drop below zero.
+	ErrRefUnderflow = errors.New("Ref underflow")
+	// ErrClosed is returned by a trie, db or writer after it is closed.
+	ErrClosed     = errors.New("Closed")
+	ErrInvalidKey = errors.New("Invalid key")
+)